@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+type authContextKey struct{}
+
+// requireAuth wraps a write handler so that, when auth tokens are configured,
+// only requests presenting a valid token are accepted. The token's user ID is
+// stored in the request context for ingestUserID. With no tokens configured
+// the handler is left open, preserving single-user setups.
+func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokens := s.config.AuthTokens()
+		if tokens == nil {
+			next(w, r)
+			return
+		}
+
+		userID, ok := lookupToken(tokens, requestToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="whence"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), authContextKey{}, userID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requestToken extracts an API token from a request.
+// Accepts "Authorization: Bearer <token>", HTTP Basic auth with the token as
+// password (the OwnTracks HTTP mode scheme), or a "token" query param for
+// clients like GPSLogger that can only configure a URL.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return r.URL.Query().Get("token")
+}
+
+// lookupToken finds the user ID for a token using constant-time comparisons
+func lookupToken(tokens map[string]string, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	var userID string
+	found := false
+	for t, u := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			userID, found = u, true
+		}
+	}
+	return userID, found
+}
+
+// ingestUserID returns the user to attribute written locations to: the
+// authenticated token's user if auth is enabled, otherwise fallback
+func ingestUserID(r *http.Request, fallback string) string {
+	if userID, ok := r.Context().Value(authContextKey{}).(string); ok {
+		return userID
+	}
+	return fallback
+}
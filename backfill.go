@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -15,7 +18,9 @@ type ImportConfig struct {
 	After   *time.Time `json:"after,omitempty"`
 	Before  *time.Time `json:"before,omitempty"`
 	Cameras []string   `json:"cameras,omitempty"` // Empty means all cameras
+	Album   string     `json:"album,omitempty"`   // Immich album ID; empty means all assets
 	UserID  string     `json:"user_id"`
+	DryRun  bool       `json:"dry_run,omitempty"` // Report what would be imported instead of importing
 }
 
 // CameraPreview holds aggregated stats for a camera during preview
@@ -48,30 +53,33 @@ type ImportProgress struct {
 	Errors    int     `json:"errors"`
 	Percent   float64 `json:"percent"`
 	Error     string  `json:"error,omitempty"`
+	// ErrorSamples holds the reasons for the first maxImportErrorSamples errors
+	ErrorSamples []string `json:"error_samples,omitempty"`
 }
 
 // BackfillManager manages import jobs
 type BackfillManager struct {
-	db      *DB
-	client  *ImmichClient
-	jobs    map[string]context.CancelFunc
-	streams map[string][]chan ImportProgress // SSE subscribers per job
-	mu      sync.RWMutex
+	db          *DB
+	client      *ImmichClient
+	concurrency int // Search pages fetched in parallel
+	jobs        map[string]context.CancelCauseFunc
+	streams     map[string][]chan ImportProgress // SSE subscribers per job
+	syncJobID   string                           // Most recent incremental sync job
+	closed      bool                             // Set by Shutdown; no new jobs start
+	running     sync.WaitGroup                   // runImport goroutines
+	mu          sync.RWMutex
 }
 
 // NewBackfillManager creates a new backfill manager
-func NewBackfillManager(db *DB, client *ImmichClient) *BackfillManager {
-	bm := &BackfillManager{
-		db:      db,
-		client:  client,
-		jobs:    make(map[string]context.CancelFunc),
-		streams: make(map[string][]chan ImportProgress),
+// concurrency is the number of search pages fetched in parallel.
+func NewBackfillManager(db *DB, client *ImmichClient, concurrency int) *BackfillManager {
+	return &BackfillManager{
+		db:          db,
+		client:      client,
+		concurrency: max(concurrency, 1),
+		jobs:        make(map[string]context.CancelCauseFunc),
+		streams:     make(map[string][]chan ImportProgress),
 	}
-
-	// Mark any previously running jobs as interrupted
-	bm.markInterruptedJobs()
-
-	return bm
 }
 
 // Subscribe returns a channel that receives progress updates for a job.
@@ -129,26 +137,6 @@ func (bm *BackfillManager) closeStreams(jobID string) {
 	}
 }
 
-// markInterruptedJobs marks any running jobs from previous sessions as interrupted
-func (bm *BackfillManager) markInterruptedJobs() {
-	jobs, err := bm.db.ListImportJobs()
-	if err != nil {
-		log.Printf("failed to list import jobs: %v", err)
-		return
-	}
-
-	for _, job := range jobs {
-		if job.Status == "running" {
-			job.Status = "interrupted"
-			errMsg := "server restarted"
-			job.LastError = &errMsg
-			if err := bm.db.UpdateImportJob(job); err != nil {
-				log.Printf("failed to mark job %s as interrupted: %v", job.ID, err)
-			}
-		}
-	}
-}
-
 // PreviewCallback is called with progress updates during preview
 type PreviewCallback func(progress PreviewProgress)
 
@@ -163,23 +151,13 @@ func (bm *BackfillManager) Preview(ctx context.Context, config ImportConfig, cal
 	opts := SearchOptions{
 		After:    config.After,
 		Before:   config.Before,
+		AlbumID:  config.Album,
 		PageSize: 200,
 		WithExif: true,
 	}
 
-	for page := 1; ; page++ {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-
-		opts.Page = page
-		assets, hasMore, err := bm.client.SearchAssets(ctx, opts)
-		if err != nil {
-			callback(PreviewProgress{Error: err.Error()})
-			return
-		}
+	err := bm.fetchPages(ctx, opts, func(assets []ImmichAsset, nextPage string) error {
+		hasMore := nextPage != ""
 
 		for _, asset := range assets {
 			scanned++
@@ -234,10 +212,122 @@ func (bm *BackfillManager) Preview(ctx context.Context, config ImportConfig, cal
 			Cameras:        camerasToSlice(cameras),
 			Complete:       !hasMore,
 		})
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		callback(PreviewProgress{Error: err.Error()})
+	}
+}
+
+// assetPage is the result of fetching one page of search results
+type assetPage struct {
+	number   int // Page number fetched ahead
+	assets   []ImmichAsset
+	nextPage string
+	err      error
+}
 
-		if !hasMore {
-			break
+// fetchPages walks the search results starting at opts.PageToken, calling handle
+// for each page in order from the calling goroutine, so handle may write to the DB
+// without further synchronization. handle receives the token of the following page
+// ("" on the last page).
+//
+// Up to bm.concurrency pages are fetched ahead in parallel. This relies on Immich's
+// tokens being page numbers, so the first page is fetched alone to learn the token
+// format; any other token falls back to fetching sequentially.
+// Returns the first error from fetching or handle, or ctx.Err() if cancelled.
+func (bm *BackfillManager) fetchPages(ctx context.Context, opts SearchOptions, handle func(assets []ImmichAsset, nextPage string) error) error {
+	if bm.concurrency <= 1 {
+		return bm.fetchPagesSequential(ctx, opts, handle)
+	}
+
+	if opts.PageToken == "" {
+		assets, nextPage, err := bm.client.SearchAssets(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if err := handle(assets, nextPage); err != nil {
+			return err
+		}
+		if nextPage == "" {
+			return nil
 		}
+		opts.PageToken = nextPage
+	}
+
+	startPage, err := strconv.Atoi(opts.PageToken)
+	if err != nil {
+		return bm.fetchPagesSequential(ctx, opts, handle)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops the dispatcher and in-flight fetches past the last page
+
+	// Each queued channel carries one page's result. The queue preserves page order
+	// and its capacity bounds how far fetchers run ahead of handle.
+	queue := make(chan chan assetPage, bm.concurrency-1)
+	go func() {
+		defer close(queue)
+		for page := startPage; ; page++ {
+			result := make(chan assetPage, 1)
+			select {
+			case queue <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			pageOpts := opts
+			pageOpts.PageToken = strconv.Itoa(page)
+			go func() {
+				assets, nextPage, err := bm.client.SearchAssets(ctx, pageOpts)
+				result <- assetPage{number: page, assets: assets, nextPage: nextPage, err: err}
+			}()
+		}
+	}()
+
+	for result := range queue {
+		var page assetPage
+		select {
+		case page = <-result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if page.err != nil {
+			return page.err
+		}
+		if err := handle(page.assets, page.nextPage); err != nil {
+			return err
+		}
+		if page.nextPage == "" {
+			return nil
+		}
+		// The pages fetched ahead are only valid while tokens keep counting up
+		if page.nextPage != strconv.Itoa(page.number+1) {
+			opts.PageToken = page.nextPage
+			return bm.fetchPagesSequential(ctx, opts, handle)
+		}
+	}
+	return ctx.Err()
+}
+
+// fetchPagesSequential is fetchPages without read-ahead, following each nextPage token
+func (bm *BackfillManager) fetchPagesSequential(ctx context.Context, opts SearchOptions, handle func(assets []ImmichAsset, nextPage string) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		assets, nextPage, err := bm.client.SearchAssets(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if err := handle(assets, nextPage); err != nil {
+			return err
+		}
+		if nextPage == "" {
+			return nil
+		}
+		opts.PageToken = nextPage
 	}
 }
 
@@ -261,13 +351,13 @@ func (bm *BackfillManager) StartImport(config ImportConfig) (string, error) {
 
 	job := ImportJob{
 		ID:         jobID,
+		Source:     "immich",
 		Status:     "running",
 		StartedAt:  time.Now().Unix(),
 		Processed:  0,
 		Imported:   0,
 		Skipped:    0,
 		Errors:     0,
-		LastPage:   0,
 		ConfigJSON: string(configJSON),
 	}
 
@@ -275,16 +365,121 @@ func (bm *BackfillManager) StartImport(config ImportConfig) (string, error) {
 		return "", err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	if err := bm.launch(jobID, config, ""); err != nil {
+		return "", err
+	}
+
+	return jobID, nil
+}
+
+// launch runs an import job in the background, registered so it can be cancelled
+func (bm *BackfillManager) launch(jobID string, config ImportConfig, pageToken string) error {
 	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.closed {
+		// The job row stays "running" and is marked interrupted on the next start
+		return ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
 	bm.jobs[jobID] = cancel
+	bm.running.Add(1)
+	go func() {
+		defer bm.running.Done()
+		bm.runImport(ctx, jobID, config, pageToken)
+	}()
+	return nil
+}
+
+// Shutdown cancels all running jobs so they checkpoint and mark themselves interrupted
+// (resumable), then waits for them to finish or ctx to expire. No new jobs start afterwards.
+func (bm *BackfillManager) Shutdown(ctx context.Context) error {
+	bm.mu.Lock()
+	bm.closed = true
+	for _, cancel := range bm.jobs {
+		cancel(ErrShuttingDown)
+	}
 	bm.mu.Unlock()
 
-	go bm.runImport(ctx, jobID, config, 1)
+	done := make(chan struct{})
+	go func() {
+		bm.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartSync starts an incremental import of assets added since the last sync and
+// advances the stored sync time. Only one sync runs at a time; returns ErrSyncRunning
+// while the previous one is still in progress.
+func (bm *BackfillManager) StartSync(userID string) (string, error) {
+	bm.mu.RLock()
+	_, running := bm.jobs[bm.syncJobID]
+	bm.mu.RUnlock()
+	if running {
+		return "", ErrSyncRunning
+	}
+
+	lastSync, err := bm.db.GetSyncState()
+	if err != nil {
+		return "", err
+	}
+
+	config := ImportConfig{UserID: userID}
+	if lastSync != nil {
+		t := time.Unix(*lastSync, 0)
+		config.After = &t
+	}
+
+	jobID, err := bm.StartImport(config)
+	if err != nil {
+		return "", err
+	}
+
+	bm.mu.Lock()
+	bm.syncJobID = jobID
+	bm.mu.Unlock()
+
+	// Update sync state to now
+	if err := bm.db.SetSyncState(time.Now().Unix()); err != nil {
+		// Log but don't fail
+		log.Printf("warning: failed to update sync state: %v", err)
+	}
 
 	return jobID, nil
 }
 
+// RunSync starts an incremental sync every interval until ctx is done.
+// Ticks are skipped while the previous sync is in progress; Shutdown interrupts a sync in flight.
+func (bm *BackfillManager) RunSync(ctx context.Context, userID string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			jobID, err := bm.StartSync(userID)
+			switch {
+			case err == ErrSyncRunning:
+				log.Printf("immich sync: previous sync still running, skipping")
+			case err != nil:
+				log.Printf("immich sync: failed to start: %v", err)
+			default:
+				log.Printf("immich sync: started job %s", jobID)
+			}
+		}
+	}
+}
+
 // ResumeImport resumes an interrupted import job
 func (bm *BackfillManager) ResumeImport(jobID string) error {
 	job, err := bm.db.GetImportJob(jobID)
@@ -294,7 +489,7 @@ func (bm *BackfillManager) ResumeImport(jobID string) error {
 	if job == nil {
 		return ErrJobNotFound
 	}
-	if job.Status != "interrupted" && job.Status != "failed" {
+	if job.Source != "immich" || (job.Status != "interrupted" && job.Status != "failed") {
 		return ErrJobNotResumable
 	}
 
@@ -309,15 +504,8 @@ func (bm *BackfillManager) ResumeImport(jobID string) error {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	bm.mu.Lock()
-	bm.jobs[jobID] = cancel
-	bm.mu.Unlock()
-
-	// Resume from last_page + 1
-	go bm.runImport(ctx, jobID, config, job.LastPage+1)
-
-	return nil
+	// Resume from the checkpointed page token
+	return bm.launch(jobID, config, job.NextPageToken)
 }
 
 // CancelImport cancels a running import job
@@ -325,7 +513,7 @@ func (bm *BackfillManager) CancelImport(jobID string) error {
 	bm.mu.Lock()
 	cancel, exists := bm.jobs[jobID]
 	if exists {
-		cancel()
+		cancel(nil)
 		delete(bm.jobs, jobID)
 	}
 	bm.mu.Unlock()
@@ -348,7 +536,7 @@ func (bm *BackfillManager) CancelImport(jobID string) error {
 }
 
 // runImport executes the import job
-func (bm *BackfillManager) runImport(ctx context.Context, jobID string, config ImportConfig, startPage int) {
+func (bm *BackfillManager) runImport(ctx context.Context, jobID string, config ImportConfig, pageToken string) {
 	defer func() {
 		bm.mu.Lock()
 		delete(bm.jobs, jobID)
@@ -362,118 +550,120 @@ func (bm *BackfillManager) runImport(ctx context.Context, jobID string, config I
 		return
 	}
 
-	// Helper to build and broadcast current progress
-	broadcastProgress := func() {
-		bm.broadcast(jobID, ImportProgress{
-			JobID:    jobID,
-			Status:   job.Status,
-			Imported: job.Imported,
-			Skipped:  job.Skipped,
-			Errors:   job.Errors,
-		})
+	// Path buckets touched by this run, recomputed once the run stops
+	touched := make(map[UserDate]bool)
+	rebuildPaths := func() {
+		if len(touched) == 0 {
+			return
+		}
+		pairs := make([]UserDate, 0, len(touched))
+		for ud := range touched {
+			pairs = append(pairs, ud)
+		}
+		log.Printf("import job %s: rebuilding paths for %d user-days...", jobID, len(pairs))
+		if err := bm.db.RebuildPathsForDates(pairs); err != nil {
+			log.Printf("import job %s: failed to rebuild paths: %v", jobID, err)
+		} else {
+			log.Printf("import job %s: paths rebuilt successfully", jobID)
+		}
 	}
 
-	// Build camera filter set
-	allowedCameras := make(map[string]bool)
-	for _, cam := range config.Cameras {
-		allowedCameras[cam] = true
+	// Helper to build and broadcast current progress
+	broadcastProgress := func() {
+		bm.broadcast(jobID, jobProgress(job))
 	}
-	filterCameras := len(config.Cameras) > 0
 
-	opts := SearchOptions{
-		After:    config.After,
-		Before:   config.Before,
-		PageSize: 200,
-		WithExif: true,
-	}
+	opts := config.searchOptions()
 
-	for page := startPage; ; page++ {
-		select {
-		case <-ctx.Done():
-			job.Status = "cancelled"
-			now := time.Now().Unix()
-			job.CompletedAt = &now
-			bm.db.UpdateImportJob(*job)
+	// Count the assets up front so progress has a percentage. A resumed job keeps its
+	// original total, since Processed carries over too.
+	if job.Total == nil {
+		total, err := bm.client.CountAssets(ctx, opts)
+		if err != nil {
+			// Older Immich versions lack the statistics endpoint; import without a percentage
+			log.Printf("import job %s: failed to count assets: %v", jobID, err)
+		} else {
+			job.Total = &total
+			if err := bm.db.UpdateImportJob(*job); err != nil {
+				log.Printf("import job %s: failed to save total: %v", jobID, err)
+			}
 			broadcastProgress()
-			return
-		default:
 		}
+	}
 
-		opts.Page = page
-		assets, hasMore, err := bm.client.SearchAssets(ctx, opts)
-		if err != nil {
-			job.Status = "failed"
-			errMsg := err.Error()
-			job.LastError = &errMsg
-			now := time.Now().Unix()
-			job.CompletedAt = &now
-			bm.db.UpdateImportJob(*job)
-			bm.broadcast(jobID, ImportProgress{
-				JobID:  jobID,
-				Status: job.Status,
-				Error:  errMsg,
-			})
-			log.Printf("import job %s: search failed on page %d: %v", jobID, page, err)
-			return
+	opts.PageToken = pageToken
+	err = bm.fetchPages(ctx, opts, func(assets []ImmichAsset, nextPage string) error {
+		// Accumulate the page and insert it in one transaction
+		job.Processed += len(assets)
+		locs, sources, errs := config.assetLocations(assets, bm.client.BaseURL)
+		for _, err := range errs {
+			job.AddError(err)
+			log.Printf("import job %s: skipping %v", jobID, err)
 		}
 
-		for _, asset := range assets {
-			job.Processed++
-
-			if !asset.HasGPS() {
-				continue
-			}
-
-			deviceID := asset.DeviceIDFromExif()
-
-			// Filter by camera if specified
-			if filterCameras && !allowedCameras[deviceID] {
-				continue
-			}
-
-			ts := asset.GetTimestamp()
-			loc := Location{
-				Timestamp: ts.Unix(),
-				UserID:    config.UserID,
-				DeviceID:  deviceID,
-				Lat:       *asset.ExifInfo.Latitude,
-				Lon:       *asset.ExifInfo.Longitude,
-			}
-
-			source := LocationSource{
-				Timestamp:  ts.Unix(),
-				DeviceID:   deviceID,
-				SourceType: "immich",
-				SourceID:   asset.ID,
-				Metadata:   buildSourceMetadata(asset, bm.client.BaseURL),
-			}
-
-			inserted, err := bm.db.InsertLocationWithSource(loc, source)
+		if len(locs) > 0 {
+			result, err := bm.db.InsertLocationsWithSourcesBatch(locs, sources)
 			if err != nil {
-				job.Errors++
-				log.Printf("import job %s: failed to insert location: %v", jobID, err)
-				continue
+				// The whole page was rolled back; retrying resumes from the previous checkpoint
+				return fmt.Errorf("failed to insert page: %w", err)
 			}
-
-			if inserted {
-				job.Imported++
-			} else {
-				job.Skipped++
+			for i, rowErr := range result.Errors {
+				job.AddError(fmt.Errorf("asset %s: %w", sources[i].SourceID, rowErr))
+				log.Printf("import job %s: failed to insert asset %s: %v", jobID, sources[i].SourceID, rowErr)
 			}
+			for i, isNew := range result.New {
+				if isNew {
+					touched[UserDateForLocation(locs[i])] = true
+				}
+			}
+			job.Imported += result.Inserted
+			job.Skipped += result.Skipped
 		}
 
-		// Checkpoint: save progress after each page
-		job.LastPage = page
+		// Checkpoint: save the token for the next page after each page.
+		// Pages are handled in order, so everything before this token is imported.
+		job.NextPageToken = nextPage
 		if err := bm.db.UpdateImportJob(*job); err != nil {
 			log.Printf("import job %s: failed to checkpoint: %v", jobID, err)
 		}
 
 		// Broadcast progress to SSE subscribers
 		broadcastProgress()
+		return nil
+	})
 
-		if !hasMore {
-			break
+	if ctx.Err() != nil {
+		if context.Cause(ctx) == ErrShuttingDown {
+			// Leave it resumable from the last checkpointed page
+			job.Status = "interrupted"
+			msg := "server shut down"
+			job.LastError = &msg
+		} else {
+			job.Status = "cancelled"
+			now := time.Now().Unix()
+			job.CompletedAt = &now
 		}
+		bm.db.UpdateImportJob(*job)
+		broadcastProgress()
+		rebuildPaths()
+		log.Printf("import job %s: %s at page token %q", jobID, job.Status, job.NextPageToken)
+		return
+	}
+	if err != nil {
+		job.Status = "failed"
+		errMsg := err.Error()
+		job.LastError = &errMsg
+		now := time.Now().Unix()
+		job.CompletedAt = &now
+		bm.db.UpdateImportJob(*job)
+		bm.broadcast(jobID, ImportProgress{
+			JobID:  jobID,
+			Status: job.Status,
+			Error:  errMsg,
+		})
+		log.Printf("import job %s: search failed (page token %q): %v", jobID, job.NextPageToken, err)
+		rebuildPaths()
+		return
 	}
 
 	// Mark as completed
@@ -487,20 +677,88 @@ func (bm *BackfillManager) runImport(ctx context.Context, jobID string, config I
 	// Final broadcast
 	broadcastProgress()
 
-	// Rebuild paths after import
-	if job.Imported > 0 {
-		log.Printf("import job %s: rebuilding paths...", jobID)
-		if err := bm.db.RebuildAllPaths(); err != nil {
-			log.Printf("import job %s: failed to rebuild paths: %v", jobID, err)
-		} else {
-			log.Printf("import job %s: paths rebuilt successfully", jobID)
-		}
-	}
+	// Recompute only the paths for days this import touched
+	rebuildPaths()
 
 	log.Printf("import job %s: completed - imported=%d, skipped=%d, errors=%d",
 		jobID, job.Imported, job.Skipped, job.Errors)
 }
 
+// searchOptions returns the Immich search covering the import's assets
+func (config ImportConfig) searchOptions() SearchOptions {
+	return SearchOptions{
+		After:    config.After,
+		Before:   config.Before,
+		AlbumID:  config.Album,
+		PageSize: 200,
+		WithExif: true,
+	}
+}
+
+// assetLocations converts a page of assets to the locations and sources to store.
+// Assets without GPS or from cameras not selected are left out; assets with invalid
+// coordinates are reported as errors.
+func (config ImportConfig) assetLocations(assets []ImmichAsset, baseURL string) ([]Location, []LocationSource, []error) {
+	var locs []Location
+	var sources []LocationSource
+	var errs []error
+	for _, asset := range assets {
+		if !asset.HasGPS() {
+			continue
+		}
+
+		deviceID := asset.DeviceIDFromExif()
+
+		// Filter by camera if specified
+		if len(config.Cameras) > 0 && !slices.Contains(config.Cameras, deviceID) {
+			continue
+		}
+
+		if err := validateCoords(*asset.ExifInfo.Latitude, *asset.ExifInfo.Longitude); err != nil {
+			errs = append(errs, fmt.Errorf("asset %s: %w", asset.ID, err))
+			continue
+		}
+
+		ts := asset.GetTimestamp()
+		locs = append(locs, Location{
+			Timestamp: ts.Unix(),
+			UserID:    config.UserID,
+			DeviceID:  deviceID,
+			Lat:       *asset.ExifInfo.Latitude,
+			Lon:       *asset.ExifInfo.Longitude,
+			AltitudeM: asset.ExifInfo.Altitude, // EXIF has no accuracy, so AccuracyM stays nil
+		})
+		sources = append(sources, LocationSource{
+			Timestamp:  ts.Unix(),
+			DeviceID:   deviceID,
+			SourceType: "immich",
+			SourceID:   asset.ID,
+			Metadata:   buildSourceMetadata(asset, baseURL),
+		})
+	}
+	return locs, sources, errs
+}
+
+// DryRunImport scans the assets an import would cover and reports what it would store,
+// without storing anything
+func (bm *BackfillManager) DryRunImport(ctx context.Context, config ImportConfig) (*ImportDryRun, error) {
+	dr, err := newDryRun(bm.db)
+	if err != nil {
+		return nil, err
+	}
+	err = bm.fetchPages(ctx, config.searchOptions(), func(assets []ImmichAsset, nextPage string) error {
+		locs, _, errs := config.assetLocations(assets, bm.client.BaseURL)
+		for _, err := range errs {
+			dr.addError(err)
+		}
+		return dr.add(locs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dr.result(), nil
+}
+
 // buildSourceMetadata creates JSON metadata for a location source
 func buildSourceMetadata(asset ImmichAsset, baseURL string) string {
 	meta := map[string]string{
@@ -514,11 +772,44 @@ func buildSourceMetadata(asset ImmichAsset, baseURL string) string {
 		if asset.ExifInfo.Model != nil {
 			meta["model"] = *asset.ExifInfo.Model
 		}
+		if asset.ExifInfo.City != nil {
+			meta["city"] = *asset.ExifInfo.City
+		}
+		if asset.ExifInfo.State != nil {
+			meta["state"] = *asset.ExifInfo.State
+		}
+		if asset.ExifInfo.Country != nil {
+			meta["country"] = *asset.ExifInfo.Country
+		}
 	}
 	data, _ := json.Marshal(meta)
 	return string(data)
 }
 
+// jobProgress builds a job's progress. Percent is only set when the job's total is known;
+// otherwise Total is what has been processed so far.
+func jobProgress(job *ImportJob) ImportProgress {
+	var percent float64
+	total := job.Processed
+	if job.Total != nil && *job.Total > 0 {
+		total = *job.Total
+		// Assets added to Immich mid-import can push Processed past the count
+		percent = min(float64(job.Processed)/float64(total)*100, 100)
+	}
+
+	return ImportProgress{
+		JobID:        job.ID,
+		Status:       job.Status,
+		Total:        total,
+		Processed:    job.Processed,
+		Imported:     job.Imported,
+		Skipped:      job.Skipped,
+		Errors:       job.Errors,
+		Percent:      percent,
+		ErrorSamples: job.ErrorSamples,
+	}
+}
+
 // GetJobProgress returns current progress for a job
 func (bm *BackfillManager) GetJobProgress(jobID string) (*ImportProgress, error) {
 	job, err := bm.db.GetImportJob(jobID)
@@ -529,28 +820,12 @@ func (bm *BackfillManager) GetJobProgress(jobID string) (*ImportProgress, error)
 		return nil, ErrJobNotFound
 	}
 
-	var percent float64
-	total := job.Processed
-	if job.Total != nil && *job.Total > 0 {
-		total = *job.Total
-		percent = float64(job.Processed) / float64(total) * 100
-	}
-
-	progress := &ImportProgress{
-		JobID:     job.ID,
-		Status:    job.Status,
-		Total:     total,
-		Processed: job.Processed,
-		Imported:  job.Imported,
-		Skipped:   job.Skipped,
-		Errors:    job.Errors,
-		Percent:   percent,
-	}
+	progress := jobProgress(job)
 	if job.LastError != nil {
 		progress.Error = *job.LastError
 	}
 
-	return progress, nil
+	return &progress, nil
 }
 
 // Custom errors
@@ -561,4 +836,6 @@ func (e backfillError) Error() string { return string(e) }
 const (
 	ErrJobNotFound     = backfillError("job not found")
 	ErrJobNotResumable = backfillError("job cannot be resumed")
+	ErrSyncRunning     = backfillError("a sync is already running")
+	ErrShuttingDown    = backfillError("server is shutting down")
 )
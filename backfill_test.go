@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// newFakeImmich serves /api/search/metadata from pages of asset IDs. pages[i] is returned
+// for tokens[i] (the first page for ""), with tokens[i+1] as its nextPage. Unknown tokens
+// get an empty last page, as Immich returns past the end.
+func newFakeImmich(t *testing.T, tokens []string, pages [][]string) *ImmichClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/search/metadata" {
+			http.NotFound(w, r)
+			return
+		}
+		var body struct {
+			Page any `json:"page"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token := ""
+		if body.Page != nil {
+			token = fmt.Sprint(body.Page)
+		}
+
+		var resp MetadataSearchResponse
+		resp.Assets.Items = []ImmichAsset{}
+		if i := slices.Index(tokens, token); i >= 0 {
+			for _, id := range pages[i] {
+				resp.Assets.Items = append(resp.Assets.Items, ImmichAsset{ID: id})
+			}
+			if i+1 < len(tokens) {
+				resp.Assets.NextPage = &tokens[i+1]
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return NewImmichClient(srv.URL, "key")
+}
+
+func TestFetchPagesVisitsEachAssetOnce(t *testing.T) {
+	pages := [][]string{{"a1", "a2"}, {"a3", "a4"}, {"a5"}}
+	tests := []struct {
+		name        string
+		tokens      []string
+		concurrency int
+		start       string
+		want        []string
+	}{
+		{"numeric tokens sequential", []string{"", "2", "3"}, 1, "", []string{"a1", "a2", "a3", "a4", "a5"}},
+		{"numeric tokens read ahead", []string{"", "2", "3"}, 4, "", []string{"a1", "a2", "a3", "a4", "a5"}},
+		{"opaque tokens", []string{"", "xyz", "abc"}, 4, "", []string{"a1", "a2", "a3", "a4", "a5"}},
+		{"numeric then opaque tokens", []string{"", "2", "abc"}, 4, "", []string{"a1", "a2", "a3", "a4", "a5"}},
+		{"resume from numeric token", []string{"", "2", "3"}, 4, "2", []string{"a3", "a4", "a5"}},
+		{"resume from opaque token", []string{"", "xyz", "abc"}, 4, "xyz", []string{"a3", "a4", "a5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bm := NewBackfillManager(nil, newFakeImmich(t, tt.tokens, pages), tt.concurrency)
+
+			var visited []string
+			err := bm.fetchPages(context.Background(), SearchOptions{PageToken: tt.start}, func(assets []ImmichAsset, nextPage string) error {
+				for _, asset := range assets {
+					visited = append(visited, asset.ID)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("fetchPages: %v", err)
+			}
+			if !slices.Equal(visited, tt.want) {
+				t.Errorf("visited %v, want %v", visited, tt.want)
+			}
+		})
+	}
+}
+
+// immichAssetWithAltitude is a search result asset as Immich returns it, trimmed to the
+// fields imports read
+const immichAssetWithAltitude = `{
+	"id": "4a6b1c2e-0000-4000-8000-000000000001",
+	"deviceId": "WEB",
+	"fileCreatedAt": "2024-06-01T12:00:00.000Z",
+	"originalPath": "/photos/IMG_0001.jpg",
+	"exifInfo": {
+		"latitude": 46.5586,
+		"longitude": 7.8356,
+		"altitude": 3454.2,
+		"dateTimeOriginal": "2024-06-01T11:59:58.000Z",
+		"make": "Apple",
+		"model": "iPhone 15"
+	}
+}`
+
+func TestImportKeepsAltitude(t *testing.T) {
+	var asset ImmichAsset
+	if err := json.Unmarshal([]byte(immichAssetWithAltitude), &asset); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	locs, sources, errs := ImportConfig{UserID: "alice"}.assetLocations([]ImmichAsset{asset}, "https://immich.example.com")
+	if len(errs) != 0 || len(locs) != 1 {
+		t.Fatalf("assetLocations returned %d locations, errors %v; want 1 location", len(locs), errs)
+	}
+
+	db := openTestDB(t)
+	if _, err := db.InsertLocationWithSource(locs[0], sources[0]); err != nil {
+		t.Fatalf("InsertLocationWithSource: %v", err)
+	}
+
+	stored, err := db.LatestLocation("alice")
+	if err != nil || stored == nil {
+		t.Fatalf("LatestLocation = %v, %v", stored, err)
+	}
+	if stored.AltitudeM == nil || *stored.AltitudeM != 3454.2 {
+		t.Errorf("stored altitude = %v, want 3454.2", stored.AltitudeM)
+	}
+	if stored.AccuracyM != nil {
+		t.Errorf("stored accuracy = %v, want nil", *stored.AccuracyM)
+	}
+}
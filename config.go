@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -11,21 +16,186 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Immich      *ImmichConfig `yaml:"immich,omitempty"`
-	DefaultUser string        `yaml:"default_user,omitempty"`
-	Sync        *SyncConfig   `yaml:"sync,omitempty"`
+	Immich        *ImmichConfig        `yaml:"immich,omitempty"`
+	DefaultUser   string               `yaml:"default_user,omitempty"`
+	Addr          string               `yaml:"addr,omitempty"` // Listen address, as -addr
+	Sync          *SyncConfig          `yaml:"sync,omitempty"`
+	Overland      *OverlandConfig      `yaml:"overland,omitempty"`
+	HomeAssistant *HomeAssistantConfig `yaml:"homeassistant,omitempty"`
+	Geocoding     *GeocodingConfig     `yaml:"geocoding,omitempty"`
+	Auth          *AuthConfig          `yaml:"auth,omitempty"`
+	Places        *PlacesConfig        `yaml:"places,omitempty"`
+	Database      *DatabaseConfig      `yaml:"database,omitempty"`
+	Retention     *RetentionConfig     `yaml:"retention,omitempty"`
+	Webhooks      []WebhookConfig      `yaml:"webhooks,omitempty"`
+	Ingest        *IngestConfig        `yaml:"ingest,omitempty"`
+	Import        *ImportFileConfig    `yaml:"import,omitempty"`
+	Log           *LogConfig           `yaml:"log,omitempty"`
+	// Default device ID per ingestion endpoint (owntracks, gpslogger, overland, homeassistant,
+	// api, google-timeline, google-takeout, kml), used when a request doesn't name its device
+	Devices map[string]string `yaml:"devices,omitempty"`
+	// Friendly name and map color per device ID, e.g. "Apple iPhone 15 Pro": {name: iPhone, color: "#1e88e5"}
+	DeviceMeta map[string]DeviceMeta `yaml:"device_meta,omitempty"`
+}
+
+// DeviceMeta is the display name and color assigned to a device ID
+type DeviceMeta struct {
+	Name  string `yaml:"name,omitempty" json:"name,omitempty"`
+	Color string `yaml:"color,omitempty" json:"color,omitempty"` // Any CSS color
 }
 
 // ImmichConfig holds Immich server connection details
 type ImmichConfig struct {
-	URL    string `yaml:"url"`
-	APIKey string `yaml:"api_key"`
+	URL               string `yaml:"url"`
+	APIKey            string `yaml:"api_key"`
+	ThumbnailCacheDir string `yaml:"thumbnail_cache_dir,omitempty"` // Empty = $XDG_CACHE_HOME/whence/thumbnails
+	ThumbnailCacheMB  *int   `yaml:"thumbnail_cache_mb,omitempty"`  // Size cap in MB (default 500, 0 = disabled)
+	ImportConcurrency int    `yaml:"import_concurrency,omitempty"`  // Search pages fetched in parallel (default 4)
+	MaxRetries        *int   `yaml:"max_retries,omitempty"`         // Retries on 5xx/network errors (default 3, 0 = none)
 }
 
 // SyncConfig holds continuous sync settings
 type SyncConfig struct {
 	Enabled  bool          `yaml:"enabled"`
-	Interval time.Duration `yaml:"interval"`
+	Interval time.Duration `yaml:"interval"` // Time between incremental syncs (0 or unset = default 1h)
+}
+
+// OverlandConfig holds Overland iOS app ingestion settings
+type OverlandConfig struct {
+	Token string `yaml:"token"` // Required X-Overland-Token value (empty = open)
+}
+
+// HomeAssistantConfig holds Home Assistant webhook settings
+type HomeAssistantConfig struct {
+	DeviceHeader string `yaml:"device_header"` // Request header carrying the HA device name
+}
+
+// GeocodingConfig selects the reverse geocoding provider
+type GeocodingConfig struct {
+	Provider  string         `yaml:"provider"`             // "nominatim" (default) or "photon"
+	URL       string         `yaml:"url"`                  // Provider base URL (empty = public instance)
+	RateLimit *time.Duration `yaml:"rate_limit,omitempty"` // Minimum interval between requests (default 1s, 0 = unlimited)
+	CacheTTL  *time.Duration `yaml:"cache_ttl,omitempty"`  // Age after which cached place names are refetched (default 180 days, 0 = never)
+	// Accept-Language for place names, e.g. "en" (empty = the provider's local-script default)
+	Language string `yaml:"language,omitempty"`
+	// Nominatim only: detail level 3-18 (default 18 = building, 16 = street, 14 = neighbourhood)
+	Zoom *int `yaml:"zoom,omitempty"`
+	// Nominatim only: name places by neighbourhood/suburb before amenity, building, or street
+	PreferArea bool `yaml:"prefer_area,omitempty"`
+}
+
+// AuthConfig holds API tokens for ingestion endpoints
+type AuthConfig struct {
+	Tokens map[string]string `yaml:"tokens"` // Token -> user ID
+}
+
+// PlacesConfig tunes home/work detection. Hours are local time, 0-23.
+type PlacesConfig struct {
+	NightStart *int `yaml:"night_start,omitempty"` // Start of the "home" window (default 22)
+	NightEnd   *int `yaml:"night_end,omitempty"`   // End of the "home" window (default 6)
+	WorkStart  *int `yaml:"work_start,omitempty"`  // Start of the weekday "work" window (default 9)
+	WorkEnd    *int `yaml:"work_end,omitempty"`    // End of the weekday "work" window (default 17)
+	MinVisits  int  `yaml:"min_visits,omitempty"`  // Visits needed to count as significant (default 3)
+}
+
+// DatabaseConfig tunes the SQLite connection
+type DatabaseConfig struct {
+	Path         string         `yaml:"path,omitempty"`           // Database file, as -db
+	BusyTimeout  *time.Duration `yaml:"busy_timeout,omitempty"`   // Lock wait before "database is locked" (default 5s)
+	Synchronous  string         `yaml:"synchronous,omitempty"`    // OFF, NORMAL (default), FULL, or EXTRA
+	MaxOpenConns int            `yaml:"max_open_conns,omitempty"` // Connection pool size (default 8)
+}
+
+// RetentionConfig limits how long raw locations are kept. Pre-computed paths are kept forever.
+type RetentionConfig struct {
+	RawMaxAge string `yaml:"raw_max_age,omitempty"` // e.g. "730d" or "8760h" (empty = keep forever)
+}
+
+// WebhookConfig is a URL notified of events as JSON POSTs
+type WebhookConfig struct {
+	URL    string   `yaml:"url"`
+	Events []string `yaml:"events,omitempty"` // geofence_enter, geofence_exit, location (empty = all)
+	Secret string   `yaml:"secret,omitempty"` // Key for the X-Whence-Signature HMAC-SHA256 header
+}
+
+// IngestConfig tunes points received from tracking apps (owntracks, gpslogger, traccar,
+// overland, homeassistant). File imports and the batch API are not affected.
+type IngestConfig struct {
+	// Skip a point within both min_spacing_m and min_spacing_s of its device's previous point.
+	// Both must be set to enable it (default off).
+	MinSpacingM float64 `yaml:"min_spacing_m,omitempty"`
+	MinSpacingS int64   `yaml:"min_spacing_s,omitempty"`
+	// Requests accepted per device per second, with bursts of up to rate_burst; more get
+	// HTTP 429. Defaults to 5/s with bursts of 30; a negative rate_limit disables it.
+	RateLimit float64 `yaml:"rate_limit,omitempty"`
+	RateBurst int     `yaml:"rate_burst,omitempty"`
+}
+
+// ImportFileConfig tunes file imports (timeline, KML, takeout)
+type ImportFileConfig struct {
+	// Locations inserted per transaction (default 1000). Smaller batches use less memory and
+	// hold the write lock for less time; larger ones import faster.
+	BatchSize         int `yaml:"batch_size,omitempty"`
+	ProgressPerSecond int `yaml:"progress_per_second,omitempty"` // Max progress updates sent per second (default 4)
+}
+
+// LogConfig controls server logging
+type LogConfig struct {
+	// Log every HTTP request with its status, size, and duration (default off).
+	// Tracking apps post often, so this can be noisy.
+	AccessLog bool `yaml:"access_log,omitempty"`
+}
+
+// DefaultGeocodeCacheTTL is how long cached place names are trusted before refetching
+const DefaultGeocodeCacheTTL = 180 * 24 * time.Hour
+
+// DefaultGeocodingZoom is the Nominatim reverse geocoding detail level (building)
+const DefaultGeocodingZoom = 18
+
+// DefaultSyncInterval is the default time between automatic Immich syncs
+const DefaultSyncInterval = time.Hour
+
+// DefaultThumbnailCacheMB is the default size cap of the on-disk thumbnail cache
+const DefaultThumbnailCacheMB = 500
+
+// DefaultImportConcurrency is the default number of Immich search pages fetched in parallel
+const DefaultImportConcurrency = 4
+
+// DefaultImportBatchSize is the default number of locations a file import inserts per batch
+const DefaultImportBatchSize = 1000
+
+// MinImportBatchSize and MaxImportBatchSize bound import.batch_size
+const (
+	MinImportBatchSize = 10
+	MaxImportBatchSize = 100000
+)
+
+// DefaultImportProgressPerSecond is the default cap on file import progress updates per second
+const DefaultImportProgressPerSecond = 4
+
+// DefaultImmichMaxRetries is the default number of retries for transient Immich errors
+const DefaultImmichMaxRetries = 3
+
+// DefaultIngestRateLimit and DefaultIngestRateBurst are the default per-device ingestion
+// limits: generous for any real tracker, but enough to stop one posting in a tight loop
+const (
+	DefaultIngestRateLimit = 5
+	DefaultIngestRateBurst = 30
+)
+
+// DefaultDBBusyTimeout is how long a statement waits on a locked database by default
+const DefaultDBBusyTimeout = 5 * time.Second
+
+// DefaultDBMaxOpenConns is the default SQLite connection pool size
+const DefaultDBMaxOpenConns = 8
+
+// DefaultSignificantPlaceOptions are the home/work detection defaults
+var DefaultSignificantPlaceOptions = SignificantPlaceOptions{
+	NightStartHour: 22,
+	NightEndHour:   6,
+	WorkStartHour:  9,
+	WorkEndHour:    17,
+	MinVisits:      3,
 }
 
 // DefaultConfigPath returns the default config file path following XDG spec
@@ -41,31 +211,411 @@ func DefaultConfigPath() string {
 	return filepath.Join(configDir, "whence", "config.yaml")
 }
 
-// LoadConfig loads configuration from the specified path
-// Returns nil config (not error) if file doesn't exist
+// LoadConfig loads configuration from the specified path, then applies WHENCE_*
+// environment variable overrides (see applyEnv).
+// Returns nil config (not error) if the file doesn't exist and no overrides are set.
 func LoadConfig(path string) (*Config, error) {
 	if path == "" {
 		path = DefaultConfigPath()
 	}
 
+	var cfg Config
 	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Config file is optional
+	switch {
+	case os.IsNotExist(err):
+		// Config file is optional
+		if !cfg.applyEnv() {
 			return nil, nil
 		}
+		return &cfg, nil
+	case err != nil:
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	// Reject unknown keys, so a typo is reported instead of silently leaving a setting unset
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
 	}
 
+	cfg.applyEnv()
 	return &cfg, nil
 }
 
+// applyEnv overrides config file values with any set WHENCE_* environment variables,
+// so containers can pass secrets without mounting a file. Reports whether any were set.
+func (c *Config) applyEnv() bool {
+	applied := false
+	env := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			*dst = v
+			applied = true
+		}
+	}
+
+	immich := c.Immich
+	if immich == nil {
+		immich = &ImmichConfig{}
+	}
+	database := c.Database
+	if database == nil {
+		database = &DatabaseConfig{}
+	}
+
+	env("WHENCE_IMMICH_URL", &immich.URL)
+	env("WHENCE_IMMICH_API_KEY", &immich.APIKey)
+	env("WHENCE_DEFAULT_USER", &c.DefaultUser)
+	env("WHENCE_ADDR", &c.Addr)
+	env("WHENCE_DB", &database.Path)
+
+	// Only add sections an override actually filled in
+	if c.Immich == nil && (immich.URL != "" || immich.APIKey != "") {
+		c.Immich = immich
+	}
+	if c.Database == nil && database.Path != "" {
+		c.Database = database
+	}
+	return applied
+}
+
+// ListenAddr returns the configured listen address, or empty if unset
+func (c *Config) ListenAddr() string {
+	if c == nil {
+		return ""
+	}
+	return c.Addr
+}
+
+// DBPath returns the configured database path, or empty if unset
+func (c *Config) DBPath() string {
+	if c == nil || c.Database == nil {
+		return ""
+	}
+	return c.Database.Path
+}
+
+// Validate checks settings that parse but can't work, such as a relative Immich URL
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.Immich != nil {
+		if c.Immich.URL == "" {
+			return fmt.Errorf("immich.url is required")
+		}
+		u, err := url.Parse(c.Immich.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("immich.url %q must be an absolute http(s) URL", c.Immich.URL)
+		}
+		if c.Immich.APIKey == "" {
+			return fmt.Errorf("immich.api_key is required when immich.url is set")
+		}
+	}
+
+	if c.Sync != nil && c.Sync.Enabled {
+		if !c.ImmichConfigured() {
+			return fmt.Errorf("sync.enabled requires the immich section")
+		}
+		// Zero means unset, so the default applies
+		if c.Sync.Interval < 0 {
+			return fmt.Errorf("sync.interval must not be negative, got %s", c.Sync.Interval)
+		}
+	}
+
+	return nil
+}
+
 // ImmichConfigured returns true if Immich is configured
 func (c *Config) ImmichConfigured() bool {
 	return c != nil && c.Immich != nil && c.Immich.URL != "" && c.Immich.APIKey != ""
 }
+
+// OverlandToken returns the configured Overland token, or empty if unset
+func (c *Config) OverlandToken() string {
+	if c == nil || c.Overland == nil {
+		return ""
+	}
+	return c.Overland.Token
+}
+
+// HomeAssistantDeviceHeader returns the header used for HA device names, or empty if unset
+func (c *Config) HomeAssistantDeviceHeader() string {
+	if c == nil || c.HomeAssistant == nil {
+		return ""
+	}
+	return c.HomeAssistant.DeviceHeader
+}
+
+// MinSpacing returns the ingest spacing thresholds, with ok=false when spacing is disabled
+func (c *Config) MinSpacing() (meters float64, seconds int64, ok bool) {
+	if c == nil || c.Ingest == nil || c.Ingest.MinSpacingM <= 0 || c.Ingest.MinSpacingS <= 0 {
+		return 0, 0, false
+	}
+	return c.Ingest.MinSpacingM, c.Ingest.MinSpacingS, true
+}
+
+// IngestRateLimit returns the per-device ingestion rate (requests per second) and burst,
+// with ok=false when rate limiting is disabled
+func (c *Config) IngestRateLimit() (rate float64, burst int, ok bool) {
+	rate, burst = DefaultIngestRateLimit, DefaultIngestRateBurst
+	if c != nil && c.Ingest != nil {
+		if c.Ingest.RateLimit < 0 {
+			return 0, 0, false
+		}
+		if c.Ingest.RateLimit > 0 {
+			rate = c.Ingest.RateLimit
+		}
+		if c.Ingest.RateBurst > 0 {
+			burst = c.Ingest.RateBurst
+		}
+	}
+	return rate, burst, true
+}
+
+// DefaultDeviceID returns the device ID for an ingestion endpoint's requests that don't
+// name one: the configured default, or the endpoint name itself
+func (c *Config) DefaultDeviceID(endpoint string) string {
+	if c != nil {
+		if deviceID := c.Devices[endpoint]; deviceID != "" {
+			return deviceID
+		}
+	}
+	return endpoint
+}
+
+// DeviceMetas returns the configured device names and colors by device ID (never nil)
+func (c *Config) DeviceMetas() map[string]DeviceMeta {
+	if c == nil || c.DeviceMeta == nil {
+		return map[string]DeviceMeta{}
+	}
+	return c.DeviceMeta
+}
+
+// DeviceColor returns the configured color for a device, or empty if none
+func (c *Config) DeviceColor(deviceID string) string {
+	return c.DeviceMetas()[deviceID].Color
+}
+
+// AccessLogEnabled reports whether HTTP requests should be logged
+func (c *Config) AccessLogEnabled() bool {
+	return c != nil && c.Log != nil && c.Log.AccessLog
+}
+
+// SyncEnabled reports whether automatic Immich sync is configured
+func (c *Config) SyncEnabled() bool {
+	return c.ImmichConfigured() && c.Sync != nil && c.Sync.Enabled
+}
+
+// SyncInterval returns the time between automatic Immich syncs
+func (c *Config) SyncInterval() time.Duration {
+	if c == nil || c.Sync == nil || c.Sync.Interval <= 0 {
+		return DefaultSyncInterval
+	}
+	return c.Sync.Interval
+}
+
+// GeocodingProvider returns the configured geocoding provider name, defaulting to nominatim
+func (c *Config) GeocodingProvider() string {
+	if c == nil || c.Geocoding == nil || c.Geocoding.Provider == "" {
+		return "nominatim"
+	}
+	return c.Geocoding.Provider
+}
+
+// GeocodingURL returns the configured geocoding base URL, or empty for the provider default
+func (c *Config) GeocodingURL() string {
+	if c == nil || c.Geocoding == nil {
+		return ""
+	}
+	return c.Geocoding.URL
+}
+
+// GeocodingRateLimit returns the minimum interval between geocoding requests
+// Defaults to 1s to respect the public Nominatim usage policy
+func (c *Config) GeocodingRateLimit() time.Duration {
+	if c == nil || c.Geocoding == nil || c.Geocoding.RateLimit == nil {
+		return time.Second
+	}
+	return *c.Geocoding.RateLimit
+}
+
+// GeocodingCacheTTL returns how long cached place names stay fresh
+func (c *Config) GeocodingCacheTTL() time.Duration {
+	if c == nil || c.Geocoding == nil || c.Geocoding.CacheTTL == nil {
+		return DefaultGeocodeCacheTTL
+	}
+	return *c.Geocoding.CacheTTL
+}
+
+// GeocodingLanguage returns the configured place name language, or empty for the provider default
+func (c *Config) GeocodingLanguage() string {
+	if c == nil || c.Geocoding == nil {
+		return ""
+	}
+	return c.Geocoding.Language
+}
+
+// GeocodingZoom returns the Nominatim reverse geocoding detail level
+func (c *Config) GeocodingZoom() int {
+	if c == nil || c.Geocoding == nil || c.Geocoding.Zoom == nil {
+		return DefaultGeocodingZoom
+	}
+	return *c.Geocoding.Zoom
+}
+
+// GeocodingPreferArea reports whether place names should prefer neighbourhood/suburb
+func (c *Config) GeocodingPreferArea() bool {
+	return c != nil && c.Geocoding != nil && c.Geocoding.PreferArea
+}
+
+// AuthTokens returns the configured token -> user ID map, or nil if auth is disabled
+func (c *Config) AuthTokens() map[string]string {
+	if c == nil || c.Auth == nil || len(c.Auth.Tokens) == 0 {
+		return nil
+	}
+	return c.Auth.Tokens
+}
+
+// ThumbnailCacheDir returns the directory for cached Immich thumbnails
+// Defaults to a whence subdirectory of the user cache dir, or "" if that can't be determined.
+func (c *Config) ThumbnailCacheDir() string {
+	if c != nil && c.Immich != nil && c.Immich.ThumbnailCacheDir != "" {
+		return c.Immich.ThumbnailCacheDir
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "whence", "thumbnails")
+}
+
+// ThumbnailCacheMaxBytes returns the size cap of the thumbnail cache, 0 if disabled
+func (c *Config) ThumbnailCacheMaxBytes() int64 {
+	mb := DefaultThumbnailCacheMB
+	if c != nil && c.Immich != nil && c.Immich.ThumbnailCacheMB != nil {
+		mb = *c.Immich.ThumbnailCacheMB
+	}
+	return int64(max(mb, 0)) << 20
+}
+
+// ImportConcurrency returns how many Immich search pages to fetch in parallel
+func (c *Config) ImportConcurrency() int {
+	if c == nil || c.Immich == nil || c.Immich.ImportConcurrency <= 0 {
+		return DefaultImportConcurrency
+	}
+	return c.Immich.ImportConcurrency
+}
+
+// ImportBatchSize returns how many locations a file import inserts per batch
+func (c *Config) ImportBatchSize() (int, error) {
+	if c == nil || c.Import == nil || c.Import.BatchSize == 0 {
+		return DefaultImportBatchSize, nil
+	}
+	size := c.Import.BatchSize
+	if size < MinImportBatchSize || size > MaxImportBatchSize {
+		return 0, fmt.Errorf("invalid import.batch_size %d: must be %d-%d", size, MinImportBatchSize, MaxImportBatchSize)
+	}
+	return size, nil
+}
+
+// ImportProgressInterval returns the minimum time between a file import's progress updates
+func (c *Config) ImportProgressInterval() time.Duration {
+	perSecond := DefaultImportProgressPerSecond
+	if c != nil && c.Import != nil && c.Import.ProgressPerSecond > 0 {
+		perSecond = c.Import.ProgressPerSecond
+	}
+	return time.Second / time.Duration(perSecond)
+}
+
+// ImmichMaxRetries returns how many times to retry transient Immich errors
+func (c *Config) ImmichMaxRetries() int {
+	if c == nil || c.Immich == nil || c.Immich.MaxRetries == nil {
+		return DefaultImmichMaxRetries
+	}
+	return max(*c.Immich.MaxRetries, 0)
+}
+
+// SignificantPlaceOptions returns the home/work detection windows and visit threshold
+func (c *Config) SignificantPlaceOptions() SignificantPlaceOptions {
+	opts := DefaultSignificantPlaceOptions
+	if c == nil || c.Places == nil {
+		return opts
+	}
+	hour := func(v *int, def int) int {
+		if v == nil || *v < 0 || *v > 23 {
+			return def
+		}
+		return *v
+	}
+	opts.NightStartHour = hour(c.Places.NightStart, opts.NightStartHour)
+	opts.NightEndHour = hour(c.Places.NightEnd, opts.NightEndHour)
+	opts.WorkStartHour = hour(c.Places.WorkStart, opts.WorkStartHour)
+	opts.WorkEndHour = hour(c.Places.WorkEnd, opts.WorkEndHour)
+	if c.Places.MinVisits > 0 {
+		opts.MinVisits = c.Places.MinVisits
+	}
+	return opts
+}
+
+// DBOptions returns the SQLite connection settings
+func (c *Config) DBOptions() DBOptions {
+	opts := DBOptions{
+		BusyTimeout:  DefaultDBBusyTimeout,
+		Synchronous:  "NORMAL",
+		MaxOpenConns: DefaultDBMaxOpenConns,
+	}
+	if c == nil || c.Database == nil {
+		return opts
+	}
+	if c.Database.BusyTimeout != nil && *c.Database.BusyTimeout >= 0 {
+		opts.BusyTimeout = *c.Database.BusyTimeout
+	}
+	switch sync := strings.ToUpper(c.Database.Synchronous); sync {
+	case "OFF", "NORMAL", "FULL", "EXTRA":
+		opts.Synchronous = sync
+	}
+	if c.Database.MaxOpenConns > 0 {
+		opts.MaxOpenConns = c.Database.MaxOpenConns
+	}
+	return opts
+}
+
+// RawRetention returns the maximum age of raw locations, or 0 if retention is disabled
+func (c *Config) RawRetention() (time.Duration, error) {
+	if c == nil || c.Retention == nil || c.Retention.RawMaxAge == "" {
+		return 0, nil
+	}
+	maxAge, err := parseDayDuration(c.Retention.RawMaxAge)
+	if err != nil || maxAge <= 0 {
+		return 0, fmt.Errorf("invalid retention.raw_max_age %q: use e.g. 730d or 8760h", c.Retention.RawMaxAge)
+	}
+	return maxAge, nil
+}
+
+// parseDayDuration parses a Go duration, also accepting a whole number of days like "730d"
+func parseDayDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// WebhookConfigs returns the configured webhooks with a URL, or nil if none
+func (c *Config) WebhookConfigs() []WebhookConfig {
+	if c == nil {
+		return nil
+	}
+	var hooks []WebhookConfig
+	for _, hook := range c.Webhooks {
+		if hook.URL != "" {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
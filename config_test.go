@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateSyncInterval(t *testing.T) {
+	tests := []struct {
+		name         string
+		interval     time.Duration
+		wantErr      bool
+		wantInterval time.Duration
+	}{
+		{"unset uses the default", 0, false, DefaultSyncInterval},
+		{"explicit", 15 * time.Minute, false, 15 * time.Minute},
+		{"negative", -time.Minute, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				Immich: &ImmichConfig{URL: "https://immich.example.com", APIKey: "key"},
+				Sync:   &SyncConfig{Enabled: true, Interval: tt.interval},
+			}
+			err := c.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && c.SyncInterval() != tt.wantInterval {
+				t.Errorf("SyncInterval() = %s, want %s", c.SyncInterval(), tt.wantInterval)
+			}
+		})
+	}
+}
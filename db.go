@@ -4,8 +4,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
@@ -23,19 +29,51 @@ type Location struct {
 	Source    *string  `json:"source,omitempty"`     // GPS, WIFI, CELL, etc.
 }
 
+// validateCoords checks that lat is in [-90, 90] and lon in [-180, 180].
+// NaN and infinities fail the range checks too.
+func validateCoords(lat, lon float64) error {
+	if !(lat >= -90 && lat <= 90) {
+		return fmt.Errorf("lat %v out of range [-90, 90]", lat)
+	}
+	if !(lon >= -180 && lon <= 180) {
+		return fmt.Errorf("lon %v out of range [-180, 180]", lon)
+	}
+	return nil
+}
+
 type DB struct {
 	*sql.DB
 }
 
-func OpenDB(path string) (*DB, error) {
+// DBOptions tunes the SQLite connection pool
+type DBOptions struct {
+	BusyTimeout  time.Duration // How long a statement waits on a lock before failing with "database is locked"
+	Synchronous  string        // PRAGMA synchronous level; NORMAL is safe with WAL
+	MaxOpenConns int           // WAL allows one writer alongside many readers
+}
+
+// OpenDB opens the database in WAL mode, so map queries keep reading while
+// ingestion and imports write, and runs pending migrations
+func OpenDB(path string, opts DBOptions) (*DB, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlite", path)
+	// Pragmas go in the DSN so every pooled connection gets them, not just the first.
+	// Immediate transactions take the write lock up front: a deferred transaction that
+	// upgrades from read to write fails with SQLITE_BUSY without honoring busy_timeout.
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", opts.BusyTimeout.Milliseconds()))
+	params.Add("_pragma", fmt.Sprintf("synchronous(%s)", opts.Synchronous))
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", path+"?"+params.Encode())
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxOpenConns)
 
 	if err := db.Ping(); err != nil {
 		return nil, err
@@ -60,9 +98,25 @@ type BBox struct {
 	SwLng, SwLat, NeLng, NeLat float64
 }
 
+// bboxWhere returns a WHERE clause and args matching locations inside bbox.
+// The locations_rtree index narrows candidates; the exact lat/lon comparison
+// trims the slack from its outward-rounded 32-bit coordinates.
+func bboxWhere(bbox BBox) (string, []any) {
+	where := `(timestamp, device_id, seq) IN (
+		SELECT k.timestamp, k.device_id, k.seq FROM locations_rtree r
+		JOIN locations_rtree_keys k ON k.id = r.id
+		WHERE r.max_lat >= ? AND r.min_lat <= ? AND r.max_lon >= ? AND r.min_lon <= ?
+	) AND lat >= ? AND lat <= ? AND lon >= ? AND lon <= ?`
+	args := []any{
+		bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng,
+		bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng,
+	}
+	return where, args
+}
+
 func (db *DB) QueryLocations(bbox BBox, start, end *int64) ([]Location, error) {
-	query := `SELECT timestamp, user_id, device_id, lat, lon FROM locations WHERE lat >= ? AND lat <= ? AND lon >= ? AND lon <= ?`
-	args := []any{bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng}
+	where, args := bboxWhere(bbox)
+	query := `SELECT timestamp, user_id, device_id, lat, lon FROM locations WHERE ` + where
 
 	if start != nil {
 		query += " AND timestamp >= ?"
@@ -92,8 +146,56 @@ func (db *DB) QueryLocations(bbox BBox, start, end *int64) ([]Location, error) {
 	return locations, rows.Err()
 }
 
-func (db *DB) LatestLocation() (*Location, error) {
-	row := db.QueryRow(`SELECT timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations ORDER BY timestamp DESC LIMIT 1`)
+// LatestLocation returns the most recent location, optionally scoped to a user ("" = any user)
+func (db *DB) LatestLocation(userID string) (*Location, error) {
+	query := `SELECT timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations`
+	var args []any
+	if userID != "" {
+		query += " WHERE user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY timestamp DESC LIMIT 1"
+
+	row := db.QueryRow(query, args...)
+	var loc Location
+	err := row.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon, &loc.AltitudeM, &loc.AccuracyM, &loc.SpeedKmh, &loc.Source)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loc, nil
+}
+
+// PreviousDeviceLocation returns a device's latest location at or before ts, or nil if none
+func (db *DB) PreviousDeviceLocation(userID, deviceID string, ts int64) (*Location, error) {
+	row := db.QueryRow(
+		`SELECT timestamp, user_id, device_id, lat, lon FROM locations
+		 WHERE user_id = ? AND device_id = ? AND timestamp <= ?
+		 ORDER BY timestamp DESC LIMIT 1`,
+		userID, deviceID, ts,
+	)
+	var loc Location
+	err := row.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loc, nil
+}
+
+// NearestLocation returns the user's location closest in time to ts, within maxDelta seconds
+// either side, or nil if there is none. Ties go to the earlier location.
+func (db *DB) NearestLocation(userID string, ts, maxDelta int64) (*Location, error) {
+	row := db.QueryRow(
+		`SELECT timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations
+		 WHERE user_id = ? AND timestamp >= ? AND timestamp <= ?
+		 ORDER BY ABS(timestamp - ?), timestamp LIMIT 1`,
+		userID, ts-maxDelta, ts+maxDelta, ts,
+	)
 	var loc Location
 	err := row.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon, &loc.AltitudeM, &loc.AccuracyM, &loc.SpeedKmh, &loc.Source)
 	if err == sql.ErrNoRows {
@@ -117,10 +219,20 @@ type LocationSource struct {
 // InsertLocationBatch inserts multiple locations in a single transaction
 // Returns count of inserted and skipped (duplicate) locations
 func (db *DB) InsertLocationBatch(locs []Location) (inserted, skipped int, err error) {
-	tx, err := db.Begin()
+	added, err := db.InsertNewLocations(locs)
 	if err != nil {
 		return 0, 0, err
 	}
+	return len(added), len(locs) - len(added), nil
+}
+
+// InsertNewLocations inserts multiple locations in a single transaction
+// Returns the locations that were inserted, leaving out duplicates already stored.
+func (db *DB) InsertNewLocations(locs []Location) (added []Location, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		if err != nil {
 			tx.Rollback()
@@ -129,28 +241,63 @@ func (db *DB) InsertLocationBatch(locs []Location) (inserted, skipped int, err e
 
 	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO locations (timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 	defer stmt.Close()
 
 	for _, loc := range locs {
 		result, err := stmt.Exec(loc.Timestamp, loc.UserID, loc.DeviceID, loc.Lat, loc.Lon, loc.AltitudeM, loc.AccuracyM, loc.SpeedKmh, loc.Source)
 		if err != nil {
-			return inserted, skipped, err
+			return nil, err
 		}
-		affected, _ := result.RowsAffected()
-		if affected > 0 {
-			inserted++
-		} else {
-			skipped++
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			added = append(added, loc)
 		}
 	}
 
-	err = tx.Commit()
-	return inserted, skipped, err
+	return added, tx.Commit()
 }
 
-// InsertLocationWithSource inserts a location and its source metadata
+// LocationsExist reports, for each location, whether one is already stored with the same
+// timestamp and device ID, so an insert would skip it
+func (db *DB) LocationsExist(locs []Location) ([]bool, error) {
+	stmt, err := db.Prepare(`SELECT EXISTS(SELECT 1 FROM locations WHERE timestamp = ? AND device_id = ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	exists := make([]bool, len(locs))
+	for i, loc := range locs {
+		if err := stmt.QueryRow(loc.Timestamp, loc.DeviceID).Scan(&exists[i]); err != nil {
+			return nil, err
+		}
+	}
+	return exists, nil
+}
+
+// StoredDeviceIDs returns the IDs of all devices with stored locations
+func (db *DB) StoredDeviceIDs() (map[string]bool, error) {
+	rows, err := db.Query(`SELECT DISTINCT device_id FROM locations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make(map[string]bool)
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		devices[deviceID] = true
+	}
+	return devices, rows.Err()
+}
+
+// InsertLocationWithSource inserts a location and its source metadata.
+// Sources are deduplicated by source ID, so each asset is stored once. Distinct assets
+// sharing a (timestamp, device_id), such as burst photos, get increasing seq values.
 func (db *DB) InsertLocationWithSource(loc Location, source LocationSource) (inserted bool, err error) {
 	tx, err := db.Begin()
 	if err != nil {
@@ -162,36 +309,116 @@ func (db *DB) InsertLocationWithSource(loc Location, source LocationSource) (ins
 		}
 	}()
 
-	// Insert location
-	result, err := tx.Exec(
-		`INSERT OR IGNORE INTO locations (timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		loc.Timestamp, loc.UserID, loc.DeviceID, loc.Lat, loc.Lon, loc.AltitudeM, loc.AccuracyM, loc.SpeedKmh, loc.Source,
-	)
+	inserted, err = insertLocationWithSourceTx(tx, loc, source)
 	if err != nil {
 		return false, err
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected > 0 {
-		// Also insert source metadata
-		_, err = tx.Exec(
-			`INSERT OR REPLACE INTO location_sources (timestamp, device_id, source_type, source_id, metadata) VALUES (?, ?, ?, ?, ?)`,
-			source.Timestamp, source.DeviceID, source.SourceType, source.SourceID, source.Metadata,
-		)
+	err = tx.Commit()
+	return inserted, err
+}
+
+// SourceBatchResult is the outcome of InsertLocationsWithSourcesBatch
+type SourceBatchResult struct {
+	Inserted int
+	Skipped  int
+	New      []bool        // New[i] reports whether row i was inserted (false if skipped or failed)
+	Errors   map[int]error // Failed rows by index; they don't abort the batch
+}
+
+// InsertLocationsWithSourcesBatch inserts locations and their sources in a single transaction,
+// deduplicating like InsertLocationWithSource. Each row runs under a savepoint, so a failing
+// row is rolled back and reported in Errors while the rest of the batch is kept.
+// The returned error is only set if the transaction itself fails.
+func (db *DB) InsertLocationsWithSourcesBatch(locs []Location, sources []LocationSource) (result SourceBatchResult, err error) {
+	if len(locs) != len(sources) {
+		return result, fmt.Errorf("batch has %d locations but %d sources", len(locs), len(sources))
+	}
+	result.New = make([]bool, len(locs))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer func() {
 		if err != nil {
-			return false, err
+			tx.Rollback()
+		}
+	}()
+
+	for i := range locs {
+		if _, err = tx.Exec(`SAVEPOINT asset`); err != nil {
+			return result, err
+		}
+		inserted, rowErr := insertLocationWithSourceTx(tx, locs[i], sources[i])
+		if rowErr != nil {
+			if _, err = tx.Exec(`ROLLBACK TO asset`); err != nil {
+				return result, err
+			}
+			if result.Errors == nil {
+				result.Errors = make(map[int]error)
+			}
+			result.Errors[i] = rowErr
+		} else if inserted {
+			result.New[i] = true
+			result.Inserted++
+		} else {
+			result.Skipped++
+		}
+		if _, err = tx.Exec(`RELEASE asset`); err != nil {
+			return result, err
 		}
-		inserted = true
 	}
 
 	err = tx.Commit()
-	return inserted, err
+	return result, err
+}
+
+// insertLocationWithSourceTx inserts one location and its source within tx,
+// returning false if the source was already recorded
+func insertLocationWithSourceTx(tx *sql.Tx, loc Location, source LocationSource) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM location_sources WHERE source_type = ? AND source_id = ?)`,
+		source.SourceType, source.SourceID,
+	).Scan(&exists)
+	if err != nil || exists {
+		return false, err
+	}
+
+	// Take the next free seq so another asset at the same second isn't overwritten
+	var seq int
+	err = tx.QueryRow(
+		`SELECT COALESCE(MAX(seq) + 1, 0) FROM locations WHERE timestamp = ? AND device_id = ?`,
+		loc.Timestamp, loc.DeviceID,
+	).Scan(&seq)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO locations (timestamp, user_id, device_id, seq, lat, lon, altitude_m, accuracy_m, speed_kmh, source) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		loc.Timestamp, loc.UserID, loc.DeviceID, seq, loc.Lat, loc.Lon, loc.AltitudeM, loc.AccuracyM, loc.SpeedKmh, loc.Source,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO location_sources (timestamp, device_id, seq, source_type, source_id, metadata) VALUES (?, ?, ?, ?, ?, ?)`,
+		source.Timestamp, source.DeviceID, seq, source.SourceType, source.SourceID, source.Metadata,
+	)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // GetLocationSource retrieves source metadata for a location
+// If several assets share the timestamp and device, the first inserted is returned.
 func (db *DB) GetLocationSource(timestamp int64, deviceID string) (*LocationSource, error) {
 	row := db.QueryRow(
-		`SELECT timestamp, device_id, source_type, source_id, metadata FROM location_sources WHERE timestamp = ? AND device_id = ?`,
+		`SELECT timestamp, device_id, source_type, source_id, metadata FROM location_sources WHERE timestamp = ? AND device_id = ? ORDER BY seq LIMIT 1`,
 		timestamp, deviceID,
 	)
 	var src LocationSource
@@ -216,11 +443,16 @@ type Bounds struct {
 }
 
 // GetBoundsForTimestampRange returns the bounding box for all locations in a time range
-func (db *DB) GetBoundsForTimestampRange(start, end int64) (*Bounds, error) {
-	row := db.QueryRow(
-		`SELECT MIN(lat), MAX(lat), MIN(lon), MAX(lon) FROM locations WHERE timestamp >= ? AND timestamp <= ?`,
-		start, end,
-	)
+// If userID is non-empty, only that user's locations are considered.
+func (db *DB) GetBoundsForTimestampRange(userID string, start, end int64) (*Bounds, error) {
+	query := `SELECT MIN(lat), MAX(lat), MIN(lon), MAX(lon) FROM locations WHERE timestamp >= ? AND timestamp <= ?`
+	args := []any{start, end}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+
+	row := db.QueryRow(query, args...)
 	var minLat, maxLat, minLon, maxLon sql.NullFloat64
 	err := row.Scan(&minLat, &maxLat, &minLon, &maxLon)
 	if err != nil {
@@ -237,6 +469,39 @@ func (db *DB) GetBoundsForTimestampRange(start, end int64) (*Bounds, error) {
 	}, nil
 }
 
+// GetOverallBounds returns the bounding box of all of a user's locations, or nil if there are none.
+// If sinceDays > 0, only the sinceDays days up to the latest location are included, so old
+// trips don't widen the view.
+func (db *DB) GetOverallBounds(userID string, sinceDays int) (*Bounds, error) {
+	where := "1 = 1"
+	var args []any
+	if userID != "" {
+		where = "user_id = ?"
+		args = append(args, userID)
+	}
+
+	query := `SELECT MIN(lat), MAX(lat), MIN(lon), MAX(lon) FROM locations WHERE ` + where
+	if sinceDays > 0 {
+		query += ` AND timestamp >= (SELECT MAX(timestamp) FROM locations WHERE ` + where + `) - ?`
+		args = append(args, args...)
+		args = append(args, int64(sinceDays)*24*60*60)
+	}
+
+	var minLat, maxLat, minLon, maxLon sql.NullFloat64
+	if err := db.QueryRow(query, args...).Scan(&minLat, &maxLat, &minLon, &maxLon); err != nil {
+		return nil, err
+	}
+	if !minLat.Valid {
+		return nil, nil
+	}
+	return &Bounds{
+		MinLat: minLat.Float64,
+		MaxLat: maxLat.Float64,
+		MinLon: minLon.Float64,
+		MaxLon: maxLon.Float64,
+	}, nil
+}
+
 // GetLocationSourceByTimestamp retrieves source metadata by timestamp only
 // Used when device_id is not available (e.g., from path points)
 func (db *DB) GetLocationSourceByTimestamp(timestamp int64) (*LocationSource, error) {
@@ -257,28 +522,66 @@ func (db *DB) GetLocationSourceByTimestamp(timestamp int64) (*LocationSource, er
 	return &src, nil
 }
 
+// maxImportErrorSamples caps the per-row error reasons kept for an import job
+const maxImportErrorSamples = 50
+
 // ImportJob represents a background import job
 type ImportJob struct {
-	ID          string  `json:"id"`
-	Status      string  `json:"status"`
-	StartedAt   int64   `json:"started_at"`
-	CompletedAt *int64  `json:"completed_at,omitempty"`
-	Total       *int    `json:"total,omitempty"`
-	Processed   int     `json:"processed"`
-	Imported    int     `json:"imported"`
-	Skipped     int     `json:"skipped"`
-	Errors      int     `json:"errors"`
-	LastPage    int     `json:"last_page"`
-	ConfigJSON  string  `json:"config_json"`
-	LastError   *string `json:"last_error,omitempty"`
+	ID          string `json:"id"`
+	Source      string `json:"source"` // "immich", "google-timeline", "google-takeout", or "kml"
+	Status      string `json:"status"`
+	StartedAt   int64  `json:"started_at"`
+	CompletedAt *int64 `json:"completed_at,omitempty"`
+	Total       *int   `json:"total,omitempty"`
+	Processed   int    `json:"processed"`
+	Imported    int    `json:"imported"`
+	Skipped     int    `json:"skipped"`
+	Errors      int    `json:"errors"`
+	ConfigJSON  string `json:"config_json"`
+	// ErrorSamples holds the reasons for the first maxImportErrorSamples errors
+	ErrorSamples []string `json:"error_samples,omitempty"`
+	LastError    *string  `json:"last_error,omitempty"`
+	// NextPageToken is Immich's opaque token for the next page to fetch ("" = from the start)
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// AddError counts a failed row, keeping its reason if fewer than maxImportErrorSamples are held
+func (job *ImportJob) AddError(err error) {
+	job.Errors++
+	if len(job.ErrorSamples) < maxImportErrorSamples {
+		job.ErrorSamples = append(job.ErrorSamples, err.Error())
+	}
+}
+
+// errorSamplesJSON encodes error samples for storage, nil if there are none
+func errorSamplesJSON(samples []string) *string {
+	if len(samples) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return nil
+	}
+	str := string(data)
+	return &str
+}
+
+// parseErrorSamples decodes stored error samples, ignoring malformed values
+func parseErrorSamples(data sql.NullString) []string {
+	if !data.Valid {
+		return nil
+	}
+	var samples []string
+	json.Unmarshal([]byte(data.String), &samples)
+	return samples
 }
 
 // CreateImportJob creates a new import job record
 func (db *DB) CreateImportJob(job ImportJob) error {
 	_, err := db.Exec(
-		`INSERT INTO import_jobs (id, status, started_at, total_assets, processed, imported, skipped, errors, last_page, config_json)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		job.ID, job.Status, job.StartedAt, job.Total, job.Processed, job.Imported, job.Skipped, job.Errors, job.LastPage, job.ConfigJSON,
+		`INSERT INTO import_jobs (id, source, status, started_at, total_assets, processed, imported, skipped, errors, next_page_token, config_json, error_samples)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Source, job.Status, job.StartedAt, job.Total, job.Processed, job.Imported, job.Skipped, job.Errors, job.NextPageToken, job.ConfigJSON, errorSamplesJSON(job.ErrorSamples),
 	)
 	return err
 }
@@ -286,13 +589,13 @@ func (db *DB) CreateImportJob(job ImportJob) error {
 // GetImportJob retrieves an import job by ID
 func (db *DB) GetImportJob(id string) (*ImportJob, error) {
 	row := db.QueryRow(
-		`SELECT id, status, started_at, completed_at, total_assets, processed, imported, skipped, errors, last_page, config_json, last_error
+		`SELECT id, source, status, started_at, completed_at, total_assets, processed, imported, skipped, errors, next_page_token, config_json, last_error, error_samples
 		 FROM import_jobs WHERE id = ?`, id,
 	)
 	var job ImportJob
 	var completedAt, total sql.NullInt64
-	var lastError sql.NullString
-	err := row.Scan(&job.ID, &job.Status, &job.StartedAt, &completedAt, &total, &job.Processed, &job.Imported, &job.Skipped, &job.Errors, &job.LastPage, &job.ConfigJSON, &lastError)
+	var lastError, nextPageToken, errorSamples sql.NullString
+	err := row.Scan(&job.ID, &job.Source, &job.Status, &job.StartedAt, &completedAt, &total, &job.Processed, &job.Imported, &job.Skipped, &job.Errors, &nextPageToken, &job.ConfigJSON, &lastError, &errorSamples)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -309,37 +612,61 @@ func (db *DB) GetImportJob(id string) (*ImportJob, error) {
 	if lastError.Valid {
 		job.LastError = &lastError.String
 	}
+	job.NextPageToken = nextPageToken.String
+	job.ErrorSamples = parseErrorSamples(errorSamples)
 	return &job, nil
 }
 
 // UpdateImportJob updates an import job's progress
 func (db *DB) UpdateImportJob(job ImportJob) error {
 	_, err := db.Exec(
-		`UPDATE import_jobs SET status = ?, completed_at = ?, total_assets = ?, processed = ?, imported = ?, skipped = ?, errors = ?, last_page = ?, last_error = ? WHERE id = ?`,
-		job.Status, job.CompletedAt, job.Total, job.Processed, job.Imported, job.Skipped, job.Errors, job.LastPage, job.LastError, job.ID,
+		`UPDATE import_jobs SET status = ?, completed_at = ?, total_assets = ?, processed = ?, imported = ?, skipped = ?, errors = ?, next_page_token = ?, last_error = ?, error_samples = ? WHERE id = ?`,
+		job.Status, job.CompletedAt, job.Total, job.Processed, job.Imported, job.Skipped, job.Errors, job.NextPageToken, job.LastError, errorSamplesJSON(job.ErrorSamples), job.ID,
 	)
 	return err
 }
 
-// ListImportJobs returns all import jobs, most recent first
-func (db *DB) ListImportJobs() ([]ImportJob, error) {
+// ImportJobFilter selects a page of import jobs for ListImportJobs
+type ImportJobFilter struct {
+	Source string // Required
+	Status string // Empty = any status
+	Limit  int
+	Offset int
+}
+
+// ListImportJobs returns a page of import jobs matching the filter, most recent first,
+// along with the total number of matching jobs
+func (db *DB) ListImportJobs(filter ImportJobFilter) ([]ImportJob, int, error) {
+	where := `source = ?`
+	args := []any{filter.Source}
+	if filter.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM import_jobs WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
 	rows, err := db.Query(
-		`SELECT id, status, started_at, completed_at, total_assets, processed, imported, skipped, errors, last_page, config_json, last_error
-		 FROM import_jobs ORDER BY started_at DESC LIMIT 50`,
+		`SELECT id, source, status, started_at, completed_at, total_assets, processed, imported, skipped, errors, next_page_token, config_json, last_error, error_samples
+		 FROM import_jobs WHERE `+where+` ORDER BY started_at DESC LIMIT ? OFFSET ?`,
+		append(args, filter.Limit, filter.Offset)...,
 	)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var jobs []ImportJob
+	jobs := []ImportJob{}
 	for rows.Next() {
 		var job ImportJob
 		var completedAt, total sql.NullInt64
-		var lastError sql.NullString
-		err := rows.Scan(&job.ID, &job.Status, &job.StartedAt, &completedAt, &total, &job.Processed, &job.Imported, &job.Skipped, &job.Errors, &job.LastPage, &job.ConfigJSON, &lastError)
+		var lastError, nextPageToken, errorSamples sql.NullString
+		err := rows.Scan(&job.ID, &job.Source, &job.Status, &job.StartedAt, &completedAt, &total, &job.Processed, &job.Imported, &job.Skipped, &job.Errors, &nextPageToken, &job.ConfigJSON, &lastError, &errorSamples)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if completedAt.Valid {
 			job.CompletedAt = &completedAt.Int64
@@ -351,9 +678,21 @@ func (db *DB) ListImportJobs() ([]ImportJob, error) {
 		if lastError.Valid {
 			job.LastError = &lastError.String
 		}
+		job.NextPageToken = nextPageToken.String
+		job.ErrorSamples = parseErrorSamples(errorSamples)
 		jobs = append(jobs, job)
 	}
-	return jobs, rows.Err()
+	return jobs, total, rows.Err()
+}
+
+// MarkInterruptedImportJobs marks jobs left running by a previous process as interrupted
+// Returns the number of jobs updated.
+func (db *DB) MarkInterruptedImportJobs() (int64, error) {
+	result, err := db.Exec(`UPDATE import_jobs SET status = 'interrupted', last_error = 'server restarted' WHERE status = 'running'`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 // GetSyncState retrieves the last sync timestamp
@@ -387,18 +726,39 @@ type PhotoLocation struct {
 	SourceID  string  `json:"source_id"`
 	WebURL    string  `json:"web_url"`
 	Filename  string  `json:"filename"`
+	City      string  `json:"city,omitempty"` // From Immich's reverse geocoding, if recorded at import
+	State     string  `json:"state,omitempty"`
+	Country   string  `json:"country,omitempty"`
+}
+
+// PlaceName returns the most specific place Immich recorded for the photo, or ""
+func (p PhotoLocation) PlaceName() string {
+	switch {
+	case p.City != "":
+		return p.City
+	case p.State != "":
+		return p.State
+	default:
+		return p.Country
+	}
 }
 
 // QueryPhotoLocations returns all photos with GPS coordinates in a time range
-func (db *DB) QueryPhotoLocations(start, end int64) ([]PhotoLocation, error) {
-	rows, err := db.Query(`
+// If userID is non-empty, only that user's photos are returned.
+func (db *DB) QueryPhotoLocations(userID string, start, end int64) ([]PhotoLocation, error) {
+	query := `
 		SELECT l.timestamp, l.lat, l.lon, ls.source_id, ls.metadata
 		FROM locations l
-		JOIN location_sources ls ON l.timestamp = ls.timestamp AND l.device_id = ls.device_id
-		WHERE l.timestamp >= ? AND l.timestamp <= ?
-		ORDER BY l.timestamp`,
-		start, end,
-	)
+		JOIN location_sources ls ON l.timestamp = ls.timestamp AND l.device_id = ls.device_id AND l.seq = ls.seq
+		WHERE l.timestamp >= ? AND l.timestamp <= ?`
+	args := []any{start, end}
+	if userID != "" {
+		query += " AND l.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY l.timestamp"
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -411,15 +771,273 @@ func (db *DB) QueryPhotoLocations(start, end int64) ([]PhotoLocation, error) {
 		if err := rows.Scan(&p.Timestamp, &p.Lat, &p.Lon, &p.SourceID, &metadata); err != nil {
 			return nil, err
 		}
-		// Parse metadata JSON for web_url and filename
+		// Parse metadata JSON for web_url, filename, and Immich's place
 		if metadata.Valid && metadata.String != "" {
 			var meta map[string]string
 			if json.Unmarshal([]byte(metadata.String), &meta) == nil {
 				p.WebURL = meta["web_url"]
 				p.Filename = meta["filename"]
+				p.City = meta["city"]
+				p.State = meta["state"]
+				p.Country = meta["country"]
 			}
 		}
 		photos = append(photos, p)
 	}
 	return photos, rows.Err()
 }
+
+// DeleteLocation removes a single location row and its source metadata.
+// If userID is non-empty, the row is only deleted if it belongs to that user.
+// Returns the deleted locations so callers can recompute affected paths.
+func (db *DB) DeleteLocation(userID string, timestamp int64, deviceID string) ([]Location, error) {
+	where := "timestamp = ? AND device_id = ?"
+	args := []any{timestamp, deviceID}
+	if userID != "" {
+		where += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	return db.deleteLocations(where, args)
+}
+
+// DeleteLocationsInBBox removes all locations inside bbox and the optional time range,
+// along with their source metadata. If userID is non-empty, only that user's rows are deleted.
+// Returns the deleted locations so callers can recompute affected paths.
+func (db *DB) DeleteLocationsInBBox(userID string, bbox BBox, start, end *int64) ([]Location, error) {
+	where, args := bboxWhere(bbox)
+	if start != nil {
+		where += " AND timestamp >= ?"
+		args = append(args, *start)
+	}
+	if end != nil {
+		where += " AND timestamp <= ?"
+		args = append(args, *end)
+	}
+	if userID != "" {
+		where += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	return db.deleteLocations(where, args)
+}
+
+// deleteLocations deletes locations matching a WHERE clause in one transaction,
+// removing location_sources rows that would otherwise be orphaned
+func (db *DB) deleteLocations(where string, args []any) (deleted []Location, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.Query(`SELECT timestamp, user_id, device_id, lat, lon FROM locations WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var loc Location
+		if err = rows.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deleted = append(deleted, loc)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM location_sources WHERE (timestamp, device_id, seq) IN
+		(SELECT timestamp, device_id, seq FROM locations WHERE `+where+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM locations WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// ListUsers returns the distinct user IDs present in the locations table
+func (db *DB) ListUsers() ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT user_id FROM locations ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
+
+// DeviceInfo summarizes the locations contributed by one device
+type DeviceInfo struct {
+	UserID     string   `json:"user_id"`
+	DeviceID   string   `json:"device_id"`
+	PointCount int      `json:"point_count"`
+	FirstTS    int64    `json:"first_ts"`
+	LastTS     int64    `json:"last_ts"`
+	Sources    []string `json:"sources"` // Distinct location sources and location_sources types
+}
+
+// ListDevices returns per-device point counts, time ranges, and sources,
+// most recently active first. Empty userID lists devices of all users.
+func (db *DB) ListDevices(userID string) ([]DeviceInfo, error) {
+	query := `SELECT l.user_id, l.device_id, COUNT(*), MIN(l.timestamp), MAX(l.timestamp),
+			COALESCE(GROUP_CONCAT(DISTINCT l.source), ''), COALESCE(GROUP_CONCAT(DISTINCT ls.source_type), '')
+		FROM locations l
+		LEFT JOIN location_sources ls ON ls.timestamp = l.timestamp AND ls.device_id = l.device_id AND ls.seq = l.seq`
+	var args []any
+	if userID != "" {
+		query += " WHERE l.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " GROUP BY l.user_id, l.device_id ORDER BY MAX(l.timestamp) DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []DeviceInfo{}
+	for rows.Next() {
+		var d DeviceInfo
+		var sources, sourceTypes string
+		if err := rows.Scan(&d.UserID, &d.DeviceID, &d.PointCount, &d.FirstTS, &d.LastTS, &sources, &sourceTypes); err != nil {
+			return nil, err
+		}
+
+		d.Sources = []string{}
+		for _, src := range strings.Split(sources+","+sourceTypes, ",") {
+			if src != "" && !slices.Contains(d.Sources, src) {
+				d.Sources = append(d.Sources, src)
+			}
+		}
+		sort.Strings(d.Sources)
+
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// StreamLocations calls fn for each location matching the optional filters, ordered by timestamp.
+// Rows are read from the cursor one at a time so large result sets are never buffered.
+func (db *DB) StreamLocations(userID string, start, end *int64, fn func(Location) error) error {
+	query := `SELECT timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations WHERE 1=1`
+	var args []any
+
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if start != nil {
+		query += " AND timestamp >= ?"
+		args = append(args, *start)
+	}
+	if end != nil {
+		query += " AND timestamp <= ?"
+		args = append(args, *end)
+	}
+
+	query += " ORDER BY timestamp"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loc Location
+		if err := rows.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon, &loc.AltitudeM, &loc.AccuracyM, &loc.SpeedKmh, &loc.Source); err != nil {
+			return err
+		}
+		if err := fn(loc); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// HeatmapCell is a grid cell with the number of raw locations inside it
+type HeatmapCell struct {
+	Lat    float64 `json:"lat"` // Cell center
+	Lon    float64 `json:"lon"` // Cell center
+	Weight int     `json:"weight"`
+}
+
+// QueryHeatmap bins a user's raw locations within bbox into a grid of cellDeg-sized cells,
+// optionally keeping only those recorded within hours of the local day ("" = all users).
+// Rows are binned as they are read from the cursor, so only non-empty cells are held in memory.
+func (db *DB) QueryHeatmap(userID string, bbox BBox, start, end *int64, hours *HourRange, cellDeg float64) ([]HeatmapCell, error) {
+	where, args := bboxWhere(bbox)
+	query := `SELECT timestamp, lat, lon FROM locations WHERE ` + where
+
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+
+	if start != nil {
+		query += " AND timestamp >= ?"
+		args = append(args, *start)
+	}
+	if end != nil {
+		query += " AND timestamp <= ?"
+		args = append(args, *end)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type cellKey struct{ row, col int64 }
+	counts := make(map[cellKey]int)
+	for rows.Next() {
+		var ts int64
+		var lat, lon float64
+		if err := rows.Scan(&ts, &lat, &lon); err != nil {
+			return nil, err
+		}
+		if hours != nil && !hours.Contains(LocalHour(ts, lat, lon)) {
+			continue
+		}
+		key := cellKey{
+			row: int64(math.Floor((lat - bbox.SwLat) / cellDeg)),
+			col: int64(math.Floor((lon - bbox.SwLng) / cellDeg)),
+		}
+		counts[key]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cells := make([]HeatmapCell, 0, len(counts))
+	for key, count := range counts {
+		cells = append(cells, HeatmapCell{
+			Lat:    bbox.SwLat + (float64(key.row)+0.5)*cellDeg,
+			Lon:    bbox.SwLng + (float64(key.col)+0.5)*cellDeg,
+			Weight: count,
+		})
+	}
+	return cells, nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestDB opens a migrated database in a temp dir, closed when the test ends
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "whence.db"), (*Config)(nil).DBOptions())
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// worldBBox covers every coordinate
+var worldBBox = BBox{SwLng: -180, SwLat: -90, NeLng: 180, NeLat: 90}
+
+// testPathPoints returns the points of every path for a user, in path order
+func testPathPoints(t *testing.T, db *DB, userID string) []PathPoint {
+	t.Helper()
+	paths, err := db.QueryPathsByBBox(userID, worldBBox, nil, nil)
+	if err != nil {
+		t.Fatalf("QueryPathsByBBox: %v", err)
+	}
+	var points []PathPoint
+	for _, path := range paths {
+		pts, err := db.GetPathPoints(path.ID)
+		if err != nil {
+			t.Fatalf("GetPathPoints: %v", err)
+		}
+		points = append(points, pts...)
+	}
+	return points
+}
+
+// queryPlan returns the EXPLAIN QUERY PLAN details for query
+func queryPlan(t testing.TB, db *DB, query string, args ...any) []string {
+	t.Helper()
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN: %v", err)
+	}
+	defer rows.Close()
+	var details []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatalf("scan plan: %v", err)
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+func TestBBoxQueriesUseRTree(t *testing.T) {
+	db := openTestDB(t)
+	bbox := BBox{SwLng: -0.2, SwLat: 51.4, NeLng: 0, NeLat: 51.6}
+
+	where, args := bboxWhere(bbox)
+	plan := strings.Join(queryPlan(t, db, `SELECT timestamp FROM locations WHERE `+where, args...), "\n")
+	if !strings.Contains(plan, "SCAN r VIRTUAL TABLE") || !strings.Contains(plan, "SEARCH locations USING PRIMARY KEY") {
+		t.Errorf("locations bbox query doesn't search via locations_rtree:\n%s", plan)
+	}
+	if strings.Contains(plan, "SCAN locations") {
+		t.Errorf("locations bbox query scans the table:\n%s", plan)
+	}
+
+	plan = strings.Join(queryPlan(t, db, `SELECT id FROM paths
+		WHERE id IN (SELECT id FROM paths_rtree WHERE max_lat >= ? AND min_lat <= ? AND max_lon >= ? AND min_lon <= ?)`,
+		bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng), "\n")
+	if !strings.Contains(plan, "SCAN paths_rtree VIRTUAL TABLE") || strings.Contains(plan, "SCAN paths\n") {
+		t.Errorf("paths bbox query doesn't search via paths_rtree:\n%s", plan)
+	}
+}
+
+func TestRTreeTracksInsertsAndDeletes(t *testing.T) {
+	db := openTestDB(t)
+	london := BBox{SwLng: -0.2, SwLat: 51.4, NeLng: 0, NeLat: 51.6}
+	for i, lat := range []float64{51.50, 51.55, 48.85} { // The last point is in Paris
+		if err := db.InsertLocation(Location{Timestamp: 1700000000 + int64(i), UserID: "alice", DeviceID: "phone", Lat: lat, Lon: -0.12}); err != nil {
+			t.Fatalf("InsertLocation: %v", err)
+		}
+	}
+
+	count := func() int {
+		locs, err := db.QueryLocations(london, nil, nil)
+		if err != nil {
+			t.Fatalf("QueryLocations: %v", err)
+		}
+		return len(locs)
+	}
+	if got := count(); got != 2 {
+		t.Errorf("QueryLocations found %d London points, want 2", got)
+	}
+	if _, err := db.Exec(`DELETE FROM locations WHERE timestamp = ?`, 1700000000); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := count(); got != 1 {
+		t.Errorf("QueryLocations found %d London points after a delete, want 1", got)
+	}
+}
+
+func BenchmarkQueryLocationsBBox(b *testing.B) {
+	db := openBenchDB(b)
+
+	// A 100x100 grid over Europe, of which the bbox covers about 1%
+	var locs []Location
+	for i := range 10000 {
+		locs = append(locs, Location{
+			Timestamp: 1700000000 + int64(i),
+			UserID:    "alice",
+			DeviceID:  fmt.Sprint("phone", i%3),
+			Lat:       40 + float64(i/100)*0.2,
+			Lon:       -5 + float64(i%100)*0.3,
+		})
+	}
+	if _, _, err := db.InsertLocationBatch(locs); err != nil {
+		b.Fatalf("InsertLocationBatch: %v", err)
+	}
+	bbox := BBox{SwLng: 0, SwLat: 50, NeLng: 3, NeLat: 52}
+
+	for b.Loop() {
+		if _, err := db.QueryLocations(bbox, nil, nil); err != nil {
+			b.Fatalf("QueryLocations: %v", err)
+		}
+	}
+}
+
+func TestConcurrentInsertsAndReads(t *testing.T) {
+	// Writers queue on the lock; allow for the race detector slowing each rebuild down
+	opts := (*Config)(nil).DBOptions()
+	opts.BusyTimeout = time.Minute
+	db, err := OpenDB(filepath.Join(t.TempDir(), "whence.db"), opts)
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+	const writers, readers, perWriter = 8, 8, 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter+readers*perWriter)
+	for w := range writers {
+		wg.Go(func() {
+			for i := range perWriter {
+				loc := Location{
+					Timestamp: 1700000000 + int64(i*60),
+					UserID:    "alice",
+					DeviceID:  fmt.Sprint("phone", w),
+					Lat:       51.5 + float64(i)*0.001,
+					Lon:       -0.12,
+				}
+				if _, _, err := db.InsertLocationBatch([]Location{loc}); err != nil {
+					errs <- fmt.Errorf("insert: %w", err)
+					continue
+				}
+				if err := db.UpdatePathsForLocations([]Location{loc}); err != nil {
+					errs <- fmt.Errorf("update paths: %w", err)
+				}
+			}
+		})
+	}
+	for range readers {
+		wg.Go(func() {
+			for range perWriter {
+				if _, err := db.QueryLocations(worldBBox, nil, nil); err != nil {
+					errs <- fmt.Errorf("query locations: %w", err)
+				}
+				if _, err := db.QueryPathsByBBox("alice", worldBBox, nil, nil); err != nil {
+					errs <- fmt.Errorf("query paths: %w", err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	locs, err := db.QueryLocations(worldBBox, nil, nil)
+	if err != nil {
+		t.Fatalf("QueryLocations: %v", err)
+	}
+	if len(locs) != writers*perWriter {
+		t.Errorf("stored %d locations, want %d", len(locs), writers*perWriter)
+	}
+}
+
+func TestInsertLocationWithSourceSameSecond(t *testing.T) {
+	const ts = 1700000000
+	burst := []struct {
+		loc    Location
+		source LocationSource
+	}{
+		{
+			Location{Timestamp: ts, UserID: "alice", DeviceID: "Apple iPhone 15", Lat: 51.5007, Lon: -0.1246},
+			LocationSource{Timestamp: ts, DeviceID: "Apple iPhone 15", SourceType: "immich", SourceID: "asset-1"},
+		},
+		{
+			Location{Timestamp: ts, UserID: "alice", DeviceID: "Apple iPhone 15", Lat: 51.5014, Lon: -0.1419},
+			LocationSource{Timestamp: ts, DeviceID: "Apple iPhone 15", SourceType: "immich", SourceID: "asset-2"},
+		},
+	}
+
+	t.Run("single", func(t *testing.T) {
+		db := openTestDB(t)
+		for _, b := range burst {
+			inserted, err := db.InsertLocationWithSource(b.loc, b.source)
+			if err != nil || !inserted {
+				t.Fatalf("InsertLocationWithSource(%s) = %v, %v; want inserted", b.source.SourceID, inserted, err)
+			}
+		}
+		// Reimporting an asset is a no-op
+		if inserted, err := db.InsertLocationWithSource(burst[0].loc, burst[0].source); err != nil || inserted {
+			t.Errorf("reinserting asset-1 = %v, %v; want skipped", inserted, err)
+		}
+		assertBothAssetsStored(t, db)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		db := openTestDB(t)
+		locs := []Location{burst[0].loc, burst[1].loc, burst[0].loc}
+		sources := []LocationSource{burst[0].source, burst[1].source, burst[0].source}
+		result, err := db.InsertLocationsWithSourcesBatch(locs, sources)
+		if err != nil {
+			t.Fatalf("InsertLocationsWithSourcesBatch: %v", err)
+		}
+		if result.Inserted != 2 || result.Skipped != 1 || len(result.Errors) != 0 {
+			t.Errorf("batch result = %+v, want 2 inserted and 1 skipped", result)
+		}
+		assertBothAssetsStored(t, db)
+	})
+}
+
+// assertBothAssetsStored checks that both burst photos kept their own location and source
+func assertBothAssetsStored(t *testing.T, db *DB) {
+	t.Helper()
+	photos, err := db.QueryPhotoLocations("alice", 0, 2000000000)
+	if err != nil {
+		t.Fatalf("QueryPhotoLocations: %v", err)
+	}
+	got := make(map[string]float64)
+	for _, p := range photos {
+		got[p.SourceID] = p.Lon
+	}
+	want := map[string]float64{"asset-1": -0.1246, "asset-2": -0.1419}
+	if !maps.Equal(got, want) {
+		t.Errorf("photo longitudes = %v, want %v", got, want)
+	}
+}
+
+func TestInsertLocationsWithSourcesBatchKeepsGoodRows(t *testing.T) {
+	db := openTestDB(t)
+	locs, sources := syntheticAssets("ok", 3)
+	locs[1].Lat = math.NaN() // Stored as NULL, failing the NOT NULL constraint
+
+	result, err := db.InsertLocationsWithSourcesBatch(locs, sources)
+	if err != nil {
+		t.Fatalf("InsertLocationsWithSourcesBatch: %v", err)
+	}
+	if result.Inserted != 2 || len(result.Errors) != 1 || result.Errors[1] == nil {
+		t.Errorf("batch result = %+v, want rows 0 and 2 inserted and row 1 failed", result)
+	}
+	if !slices.Equal(result.New, []bool{true, false, true}) {
+		t.Errorf("New = %v, want [true false true]", result.New)
+	}
+}
+
+// syntheticAssets returns n Immich-style locations and sources with IDs prefixed by prefix
+func syntheticAssets(prefix string, n int) ([]Location, []LocationSource) {
+	locs := make([]Location, n)
+	sources := make([]LocationSource, n)
+	for i := range n {
+		ts := int64(1700000000 + i*30)
+		locs[i] = Location{Timestamp: ts, UserID: "alice", DeviceID: "Apple iPhone 15", Lat: 51.5 + float64(i)*0.0001, Lon: -0.12}
+		sources[i] = LocationSource{Timestamp: ts, DeviceID: "Apple iPhone 15", SourceType: "immich", SourceID: fmt.Sprintf("%s-%d", prefix, i)}
+	}
+	return locs, sources
+}
+
+// openBenchDB is openTestDB for benchmarks
+func openBenchDB(b *testing.B) *DB {
+	b.Helper()
+	db, err := OpenDB(filepath.Join(b.TempDir(), "whence.db"), (*Config)(nil).DBOptions())
+	if err != nil {
+		b.Fatalf("OpenDB: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// BenchmarkImportOneByOne and BenchmarkImportBatch each import 1000 assets per iteration,
+// one transaction per asset versus one for all of them
+func BenchmarkImportOneByOne(b *testing.B) {
+	db := openBenchDB(b)
+	for i := 0; b.Loop(); i++ {
+		locs, sources := syntheticAssets(fmt.Sprint("run", i), 1000)
+		for j := range locs {
+			if _, err := db.InsertLocationWithSource(locs[j], sources[j]); err != nil {
+				b.Fatalf("InsertLocationWithSource: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkImportBatch(b *testing.B) {
+	db := openBenchDB(b)
+	for i := 0; b.Loop(); i++ {
+		locs, sources := syntheticAssets(fmt.Sprint("run", i), 1000)
+		if _, err := db.InsertLocationsWithSourcesBatch(locs, sources); err != nil {
+			b.Fatalf("InsertLocationsWithSourcesBatch: %v", err)
+		}
+	}
+}
+
+func TestValidateCoords(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		ok       bool
+	}{
+		{0, 0, true},
+		{90, 180, true},
+		{-90, -180, true},
+		{51.5074, -0.1278, true},
+		{90.0001, 0, false},
+		{-90.0001, 0, false},
+		{0, 180.0001, false},
+		{0, -180.0001, false},
+		{999, 0, false},
+		{0, 999, false},
+		{math.NaN(), 0, false},
+		{0, math.NaN(), false},
+		{math.Inf(1), 0, false},
+		{0, math.Inf(-1), false},
+	}
+	for _, tt := range tests {
+		if err := validateCoords(tt.lat, tt.lon); (err == nil) != tt.ok {
+			t.Errorf("validateCoords(%v, %v) = %v, want ok %v", tt.lat, tt.lon, err, tt.ok)
+		}
+	}
+}
+
+func TestNearestLocation(t *testing.T) {
+	db := openTestDB(t)
+	for _, loc := range []Location{
+		{Timestamp: 1000, UserID: "alice", DeviceID: "phone", Lat: 51.50, Lon: -0.12},
+		{Timestamp: 1100, UserID: "alice", DeviceID: "phone", Lat: 51.51, Lon: -0.12},
+		{Timestamp: 1095, UserID: "bob", DeviceID: "phone", Lat: 48.85, Lon: 2.35},
+	} {
+		if err := db.InsertLocation(loc); err != nil {
+			t.Fatalf("InsertLocation: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		ts       int64
+		maxDelta int64
+		want     int64 // Timestamp of the match, 0 for none
+	}{
+		{"exact", 1000, 0, 1000},
+		{"closer to the later point", 1090, 30, 1100},
+		{"closer to the earlier point", 1010, 30, 1000},
+		{"tie goes to the earlier point", 1050, 60, 1000},
+		{"outside the window", 1050, 49, 0},
+		{"edge of the window", 1130, 30, 1100},
+		{"past the last point", 1131, 30, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := db.NearestLocation("alice", tt.ts, tt.maxDelta)
+			if err != nil {
+				t.Fatalf("NearestLocation: %v", err)
+			}
+			var got int64
+			if loc != nil {
+				got = loc.Timestamp
+				if loc.UserID != "alice" {
+					t.Errorf("matched %s's location", loc.UserID)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("NearestLocation(%d, %d) = %d, want %d", tt.ts, tt.maxDelta, got, tt.want)
+			}
+		})
+	}
+
+	plan := strings.Join(queryPlan(t, db, `SELECT timestamp FROM locations
+		WHERE user_id = ? AND timestamp >= ? AND timestamp <= ?
+		ORDER BY ABS(timestamp - ?), timestamp LIMIT 1`, "alice", 0, 1, 0), "\n")
+	if !strings.Contains(plan, "INDEX idx_locations_user_timestamp (user_id=?") {
+		t.Errorf("NearestLocation query doesn't use the (user_id, timestamp) index:\n%s", plan)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	// maxDryRunDevices caps the devices listed in a dry run result
+	maxDryRunDevices = 20
+
+	// dryRunBatchSize is how many parsed locations are checked against the database at once
+	dryRunBatchSize = 1000
+)
+
+// ImportDryRun reports what an import would store, found by checking every parsed
+// location against the database the same way an insert deduplicates
+type ImportDryRun struct {
+	WouldInsert  int            `json:"would_insert"`
+	WouldSkip    int            `json:"would_skip"` // Already stored, or repeated within the import
+	Errors       int            `json:"errors"`
+	ErrorSamples []string       `json:"error_samples,omitempty"` // The first maxImportErrorSamples errors
+	Devices      []DryRunDevice `json:"devices"`                 // Devices with new points, most first, up to maxDryRunDevices
+}
+
+// DryRunDevice summarizes the points an import would add for one device
+type DryRunDevice struct {
+	DeviceID    string `json:"device_id"`
+	New         bool   `json:"new"` // No points are stored for this device yet
+	WouldInsert int    `json:"would_insert"`
+	FirstTS     int64  `json:"first_ts"` // Time range of the new points
+	LastTS      int64  `json:"last_ts"`
+}
+
+// dryRun accumulates an ImportDryRun from batches of parsed locations
+type dryRun struct {
+	db      *DB
+	stored  map[string]bool           // Device IDs with stored locations
+	seen    map[string]map[int64]bool // Timestamps counted so far, by device ID
+	devices map[string]*DryRunDevice
+	res     ImportDryRun
+}
+
+func newDryRun(db *DB) (*dryRun, error) {
+	stored, err := db.StoredDeviceIDs()
+	if err != nil {
+		return nil, err
+	}
+	return &dryRun{
+		db:      db,
+		stored:  stored,
+		seen:    make(map[string]map[int64]bool),
+		devices: make(map[string]*DryRunDevice),
+	}, nil
+}
+
+// add counts a batch of locations as would-be inserts or skips
+func (d *dryRun) add(locs []Location) error {
+	exists, err := d.db.LocationsExist(locs)
+	if err != nil {
+		return err
+	}
+
+	for i, loc := range locs {
+		// Locations are keyed by timestamp and device ID, like the locations table
+		seen := d.seen[loc.DeviceID]
+		if seen == nil {
+			seen = make(map[int64]bool)
+			d.seen[loc.DeviceID] = seen
+		}
+		if exists[i] || seen[loc.Timestamp] {
+			d.res.WouldSkip++
+			continue
+		}
+		seen[loc.Timestamp] = true
+		d.res.WouldInsert++
+
+		dev, ok := d.devices[loc.DeviceID]
+		if !ok {
+			dev = &DryRunDevice{DeviceID: loc.DeviceID, New: !d.stored[loc.DeviceID], FirstTS: loc.Timestamp, LastTS: loc.Timestamp}
+			d.devices[loc.DeviceID] = dev
+		}
+		dev.WouldInsert++
+		dev.FirstTS = min(dev.FirstTS, loc.Timestamp)
+		dev.LastTS = max(dev.LastTS, loc.Timestamp)
+	}
+	return nil
+}
+
+// addError counts a record that couldn't be converted, keeping the first few messages
+func (d *dryRun) addError(err error) {
+	d.res.Errors++
+	if len(d.res.ErrorSamples) < maxImportErrorSamples {
+		d.res.ErrorSamples = append(d.res.ErrorSamples, err.Error())
+	}
+}
+
+// result returns the totals, listing devices by how many points they'd gain
+func (d *dryRun) result() *ImportDryRun {
+	res := d.res
+	res.Devices = make([]DryRunDevice, 0, len(d.devices))
+	for _, dev := range d.devices {
+		res.Devices = append(res.Devices, *dev)
+	}
+	sort.Slice(res.Devices, func(i, j int) bool {
+		if res.Devices[i].WouldInsert != res.Devices[j].WouldInsert {
+			return res.Devices[i].WouldInsert > res.Devices[j].WouldInsert
+		}
+		return res.Devices[i].DeviceID < res.Devices[j].DeviceID
+	})
+	if len(res.Devices) > maxDryRunDevices {
+		res.Devices = res.Devices[:maxDryRunDevices]
+	}
+	return &res
+}
+
+// dryRunRequested reports whether an import request asks for a dry run (?dry_run=true)
+func dryRunRequested(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+	return dryRun
+}
+
+// writeImportDryRun decodes an uploaded file and writes, as JSON, what importing it would store
+func (s *Server) writeImportDryRun(w http.ResponseWriter, decode LocationStream) {
+	dr, err := newDryRun(s.db)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	batch := make([]Location, 0, dryRunBatchSize)
+	var dbErr error
+	flush := func() error {
+		if err := dr.add(batch); err != nil {
+			dbErr = err
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+	_, err = decode(func(loc Location) error {
+		batch = append(batch, loc)
+		if len(batch) >= dryRunBatchSize {
+			return flush()
+		}
+		return nil
+	}, dr.addError)
+	if err == nil {
+		err = flush()
+	}
+	if dbErr != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		// The file broke partway through; report what was read, with the reason
+		dr.addError(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dr.result())
+}
+
+// parsedStream adapts a parser that reads a whole file at once to a LocationStream,
+// setting the user and device the way the import would
+func parsedStream(locations []Location, parseErrors []error, userID, deviceID string) LocationStream {
+	return func(emit func(Location) error, onErr func(error)) (int, error) {
+		for _, err := range parseErrors {
+			onErr(err)
+		}
+		for _, loc := range locations {
+			loc.UserID = userID
+			loc.DeviceID = deviceID
+			if err := emit(loc); err != nil {
+				return len(locations) + len(parseErrors), err
+			}
+		}
+		return len(locations) + len(parseErrors), nil
+	}
+}
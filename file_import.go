@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fileImportConfig is stored as an uploaded file import job's config_json
+type fileImportConfig struct {
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	Parsed   int    `json:"parsed"`
+	Streamed bool   `json:"streamed,omitempty"` // Parsed count unknown until the stream ends
+}
+
+// LocationStream decodes a file, calling emit for each location and onErr for each record
+// that can't be converted. Returns the number of records seen.
+type LocationStream func(emit func(Location) error, onErr func(error)) (int, error)
+
+// FileImportManager runs parsed file imports (timeline, KML) as background jobs
+// recorded in import_jobs, so they outlive the upload request and can be reattached to
+type FileImportManager struct {
+	db               *DB
+	batchSize        int                                      // Locations inserted (and checkpointed) per batch
+	progressInterval time.Duration                            // Minimum time between a job's batch progress updates
+	streams          map[string][]chan TimelineImportProgress // SSE subscribers per running job
+	cancels          map[string]context.CancelCauseFunc       // Stops a running job at its next batch
+	lastProgress     map[string]time.Time                     // When each running job last sent batch progress
+	closed           bool                                     // Set by Shutdown; no new jobs start
+	running          sync.WaitGroup                           // run/runStream goroutines
+	mu               sync.Mutex
+}
+
+// NewFileImportManager creates a file import manager
+func NewFileImportManager(db *DB, batchSize int, progressInterval time.Duration) *FileImportManager {
+	return &FileImportManager{
+		db:               db,
+		batchSize:        batchSize,
+		progressInterval: progressInterval,
+		streams:          make(map[string][]chan TimelineImportProgress),
+		cancels:          make(map[string]context.CancelCauseFunc),
+		lastProgress:     make(map[string]time.Time),
+	}
+}
+
+// Start records a job for the parsed locations and inserts them in the background
+func (fm *FileImportManager) Start(source, deviceID string, locations []Location, stats TimelineImportStats) (string, error) {
+	userID := ""
+	if len(locations) > 0 {
+		userID = locations[0].UserID
+	}
+	configJSON, err := json.Marshal(fileImportConfig{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Parsed:   stats.Parsed,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	total := stats.Total
+	job := ImportJob{
+		ID:           uuid.New().String(),
+		Source:       source,
+		Status:       "running",
+		StartedAt:    time.Now().Unix(),
+		Total:        &total,
+		Errors:       stats.Errors,
+		ConfigJSON:   string(configJSON),
+		ErrorSamples: stats.ErrorSamples,
+	}
+	if err := fm.db.CreateImportJob(job); err != nil {
+		return "", err
+	}
+
+	// Register before starting so subscribers can't miss a fast job
+	ctx, err := fm.register(job.ID)
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		defer fm.running.Done()
+		defer fm.unregister(job.ID)
+		fm.run(ctx, &job, locations, stats)
+	}()
+
+	return job.ID, nil
+}
+
+// StartStream records a job and decodes and inserts locations in the background, holding only
+// one batch in memory at a time. The job takes ownership of file and closes it when done.
+func (fm *FileImportManager) StartStream(source, userID, deviceID string, file io.Closer, decode LocationStream) (string, error) {
+	configJSON, err := json.Marshal(fileImportConfig{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Streamed: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	job := ImportJob{
+		ID:         uuid.New().String(),
+		Source:     source,
+		Status:     "running",
+		StartedAt:  time.Now().Unix(),
+		ConfigJSON: string(configJSON),
+	}
+	if err := fm.db.CreateImportJob(job); err != nil {
+		return "", err
+	}
+
+	ctx, err := fm.register(job.ID)
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		defer fm.running.Done()
+		defer fm.unregister(job.ID)
+		defer file.Close()
+		fm.runStream(ctx, &job, decode)
+	}()
+
+	return job.ID, nil
+}
+
+// register marks a job as running, returning the context that Cancel and Shutdown end.
+// The caller must call running.Done when the job's goroutine exits.
+func (fm *FileImportManager) register(jobID string) (context.Context, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.closed {
+		// The job row stays "running" and is marked interrupted on the next start
+		return nil, ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	fm.streams[jobID] = nil
+	fm.cancels[jobID] = cancel
+	fm.running.Add(1)
+	return ctx, nil
+}
+
+// unregister releases a finished job's context
+func (fm *FileImportManager) unregister(jobID string) {
+	fm.mu.Lock()
+	cancel := fm.cancels[jobID]
+	delete(fm.cancels, jobID)
+	delete(fm.lastProgress, jobID)
+	fm.mu.Unlock()
+	if cancel != nil {
+		cancel(nil)
+	}
+}
+
+// Cancel stops a running job after the batch in progress; the job is then marked cancelled.
+// Returns ErrJobNotFound if the job isn't running in this process.
+func (fm *FileImportManager) Cancel(jobID string) error {
+	fm.mu.Lock()
+	cancel, running := fm.cancels[jobID]
+	fm.mu.Unlock()
+	if !running {
+		return ErrJobNotFound
+	}
+	cancel(nil)
+	return nil
+}
+
+// Shutdown stops all running jobs after their current batch and marks them interrupted,
+// then waits for them to finish or ctx to expire. No new jobs start afterwards.
+func (fm *FileImportManager) Shutdown(ctx context.Context) error {
+	fm.mu.Lock()
+	fm.closed = true
+	for _, cancel := range fm.cancels {
+		cancel(ErrShuttingDown)
+	}
+	fm.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		fm.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe returns a channel of progress updates for a running job, closed when the job ends.
+// Returns ok=false if the job isn't running in this process.
+func (fm *FileImportManager) Subscribe(jobID string) (<-chan TimelineImportProgress, func(), bool) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	subs, running := fm.streams[jobID]
+	if !running {
+		return nil, nil, false
+	}
+	ch := make(chan TimelineImportProgress, 10)
+	fm.streams[jobID] = append(subs, ch)
+
+	unsubscribe := func() {
+		fm.mu.Lock()
+		defer fm.mu.Unlock()
+
+		subs := fm.streams[jobID]
+		for i, sub := range subs {
+			if sub == ch {
+				fm.streams[jobID] = append(subs[:i], subs[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+		// Channel not found - already closed when the job ended
+	}
+	return ch, unsubscribe, true
+}
+
+// broadcast sends progress to all subscribers of a job (non-blocking).
+// The final update closes the subscriber channels after delivering it.
+func (fm *FileImportManager) broadcast(jobID string, progress TimelineImportProgress) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	for _, ch := range fm.streams[jobID] {
+		if progress.Complete {
+			// Make room so the final update is never dropped
+			select {
+			case <-ch:
+			default:
+			}
+		}
+		select {
+		case ch <- progress:
+		default:
+			// Drop if channel is full (slow consumer)
+		}
+		if progress.Complete {
+			close(ch)
+		}
+	}
+	if progress.Complete {
+		delete(fm.streams, jobID)
+	}
+}
+
+// run inserts locations in batches, checkpointing the job after each batch
+func (fm *FileImportManager) run(ctx context.Context, job *ImportJob, locations []Location, stats TimelineImportStats) {
+	for i := 0; i < len(locations); i += fm.batchSize {
+		if ctx.Err() != nil {
+			locations = locations[:i]
+			break
+		}
+		batch := locations[i:min(i+fm.batchSize, len(locations))]
+
+		inserted, skipped, err := fm.db.InsertLocationBatch(batch)
+		if err != nil {
+			fm.fail(job, stats, fmt.Sprintf("Database error at batch %d: %v", i/fm.batchSize, err))
+			return
+		}
+
+		stats.Inserted += inserted
+		stats.Skipped += skipped
+		fm.checkpoint(job, stats, fmt.Sprintf("Imported %d/%d locations...", stats.Inserted+stats.Skipped, len(locations)))
+	}
+
+	// Update paths for all parsed locations (UpdatePathsForLocations handles duplicates)
+	if stats.Inserted > 0 {
+		fm.broadcast(job.ID, TimelineImportProgress{
+			JobID:   job.ID,
+			Stats:   stats,
+			Message: "Updating path index...",
+		})
+		if err := fm.db.UpdatePathsForLocations(locations); err != nil {
+			log.Printf("file import %s: failed to update paths: %v", job.ID, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		fm.stopped(ctx, job, stats)
+		return
+	}
+	fm.complete(job, stats)
+}
+
+// runStream decodes and inserts locations batch by batch, checkpointing the job after each
+// batch. Only the user+date buckets touched are remembered for the path rebuild.
+func (fm *FileImportManager) runStream(ctx context.Context, job *ImportJob, decode LocationStream) {
+	var stats TimelineImportStats
+	batch := make([]Location, 0, fm.batchSize)
+	seen := make(map[UserDate]bool)
+	var pairs []UserDate
+
+	flush := func() error {
+		// Stop decoding at the batch boundary once cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		inserted, skipped, err := fm.db.InsertLocationBatch(batch)
+		if err != nil {
+			return fmt.Errorf("Database error after %d locations: %v", stats.Inserted+stats.Skipped, err)
+		}
+		for _, loc := range batch {
+			ud := UserDateForLocation(loc)
+			if !seen[ud] {
+				seen[ud] = true
+				pairs = append(pairs, ud)
+			}
+		}
+		batch = batch[:0]
+
+		stats.Inserted += inserted
+		stats.Skipped += skipped
+		fm.checkpoint(job, stats, fmt.Sprintf("Imported %d locations...", stats.Inserted+stats.Skipped))
+		return nil
+	}
+
+	total, err := decode(func(loc Location) error {
+		stats.Parsed++
+		batch = append(batch, loc)
+		if len(batch) >= fm.batchSize {
+			return flush()
+		}
+		return nil
+	}, func(err error) {
+		stats.addError(err)
+	})
+	if err == nil {
+		err = flush()
+	}
+	stats.Total = total
+	job.Total = &total
+
+	// Index whatever was inserted, even if the stream broke partway through
+	if stats.Inserted > 0 {
+		fm.broadcast(job.ID, TimelineImportProgress{
+			JobID:   job.ID,
+			Stats:   stats,
+			Message: "Updating path index...",
+		})
+		if err := fm.db.RebuildPathsForDates(pairs); err != nil {
+			log.Printf("file import %s: failed to update paths: %v", job.ID, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		fm.stopped(ctx, job, stats)
+		return
+	}
+	if err != nil {
+		fm.fail(job, stats, err.Error())
+		return
+	}
+	fm.complete(job, stats)
+}
+
+// checkpoint records a job's progress after a batch and broadcasts it, at most once per progressInterval
+func (fm *FileImportManager) checkpoint(job *ImportJob, stats TimelineImportStats, message string) {
+	job.Processed = stats.Inserted + stats.Skipped
+	job.Imported = stats.Inserted
+	job.Skipped = stats.Skipped
+	job.Errors = stats.Errors
+	job.ErrorSamples = stats.ErrorSamples
+	if err := fm.db.UpdateImportJob(*job); err != nil {
+		log.Printf("file import %s: failed to checkpoint: %v", job.ID, err)
+	}
+
+	// The job is checkpointed every batch, but subscribers only need a few updates a second
+	fm.mu.Lock()
+	now := time.Now()
+	throttled := now.Sub(fm.lastProgress[job.ID]) < fm.progressInterval
+	if !throttled {
+		fm.lastProgress[job.ID] = now
+	}
+	fm.mu.Unlock()
+	if throttled {
+		return
+	}
+
+	fm.broadcast(job.ID, TimelineImportProgress{
+		JobID:   job.ID,
+		Stats:   stats,
+		Message: message,
+	})
+}
+
+// fail marks a job failed and sends the final update
+func (fm *FileImportManager) fail(job *ImportJob, stats TimelineImportStats, msg string) {
+	job.Status = "failed"
+	job.LastError = &msg
+	job.Errors = stats.Errors
+	job.ErrorSamples = stats.ErrorSamples
+	now := time.Now().Unix()
+	job.CompletedAt = &now
+	if err := fm.db.UpdateImportJob(*job); err != nil {
+		log.Printf("file import %s: failed to mark failed: %v", job.ID, err)
+	}
+	fm.broadcast(job.ID, TimelineImportProgress{JobID: job.ID, Stats: stats, Error: msg, Complete: true})
+}
+
+// stopped marks a job ended by Cancel as cancelled, or by Shutdown as interrupted,
+// and sends the final update
+func (fm *FileImportManager) stopped(ctx context.Context, job *ImportJob, stats TimelineImportStats) {
+	job.Errors = stats.Errors
+	job.ErrorSamples = stats.ErrorSamples
+	if context.Cause(ctx) == ErrShuttingDown {
+		job.Status = "interrupted"
+		msg := "server shut down"
+		job.LastError = &msg
+	} else {
+		job.Status = "cancelled"
+		now := time.Now().Unix()
+		job.CompletedAt = &now
+	}
+	if err := fm.db.UpdateImportJob(*job); err != nil {
+		log.Printf("file import %s: failed to mark %s: %v", job.ID, job.Status, err)
+	}
+
+	fm.broadcast(job.ID, fileImportFinalProgress(job, stats.Parsed))
+	log.Printf("file import %s: %s - inserted=%d, skipped=%d", job.ID, job.Status, stats.Inserted, stats.Skipped)
+}
+
+// complete marks a job completed and sends the final update
+func (fm *FileImportManager) complete(job *ImportJob, stats TimelineImportStats) {
+	job.Status = "completed"
+	job.Errors = stats.Errors
+	job.ErrorSamples = stats.ErrorSamples
+	now := time.Now().Unix()
+	job.CompletedAt = &now
+	if err := fm.db.UpdateImportJob(*job); err != nil {
+		log.Printf("file import %s: failed to mark complete: %v", job.ID, err)
+	}
+
+	fm.broadcast(job.ID, fileImportFinalProgress(job, stats.Parsed))
+	log.Printf("file import %s: completed - inserted=%d, skipped=%d", job.ID, stats.Inserted, stats.Skipped)
+}
+
+// fileImportFinalProgress builds the terminal progress update for a finished job
+func fileImportFinalProgress(job *ImportJob, parsed int) TimelineImportProgress {
+	stats := TimelineImportStats{
+		Parsed:       parsed,
+		Inserted:     job.Imported,
+		Skipped:      job.Skipped,
+		Errors:       job.Errors,
+		ErrorSamples: job.ErrorSamples,
+	}
+	if job.Total != nil {
+		stats.Total = *job.Total
+	}
+
+	progress := TimelineImportProgress{JobID: job.ID, Stats: stats, Complete: true}
+	switch job.Status {
+	case "completed":
+		progress.Message = fmt.Sprintf("Import complete: %d inserted, %d duplicates skipped", stats.Inserted, stats.Skipped)
+	case "cancelled":
+		progress.Error = fmt.Sprintf("Import cancelled after %d locations (already imported points are kept)", job.Processed)
+	case "interrupted":
+		progress.Error = fmt.Sprintf("Import interrupted by a server restart after %d locations; re-upload the file to finish (already imported points are skipped)", job.Processed)
+	default:
+		if job.LastError != nil {
+			progress.Error = *job.LastError
+		} else {
+			progress.Error = "Import " + job.Status
+		}
+	}
+	return progress
+}
+
+// Progress returns the current state of a file import job, for clients reattaching to it
+func (fm *FileImportManager) Progress(jobID string) (*TimelineImportProgress, error) {
+	job, err := fm.db.GetImportJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || job.Source == "immich" {
+		return nil, ErrJobNotFound
+	}
+
+	var config fileImportConfig
+	json.Unmarshal([]byte(job.ConfigJSON), &config)
+
+	parsed := config.Parsed
+	if config.Streamed && job.Status == "completed" {
+		// Every streamed location was either inserted or skipped
+		parsed = job.Processed
+	}
+
+	if job.Status != "running" {
+		progress := fileImportFinalProgress(job, parsed)
+		return &progress, nil
+	}
+
+	stats := TimelineImportStats{
+		Parsed:       config.Parsed,
+		Inserted:     job.Imported,
+		Skipped:      job.Skipped,
+		Errors:       job.Errors,
+		ErrorSamples: job.ErrorSamples,
+	}
+	if job.Total != nil {
+		stats.Total = *job.Total
+	}
+	message := fmt.Sprintf("Imported %d/%d locations...", job.Processed, config.Parsed)
+	if config.Streamed {
+		message = fmt.Sprintf("Imported %d locations...", job.Processed)
+	}
+	return &TimelineImportProgress{
+		JobID:   job.ID,
+		Stats:   stats,
+		Message: message,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileImportManagerShutdown(t *testing.T) {
+	db := openTestDB(t)
+	fm := NewFileImportManager(db, 10, 0)
+
+	// Decodes points until the job stops it, signalling once the first batch is in
+	started := make(chan struct{})
+	jobID, err := fm.StartStream("owntracks", "alice", "phone", io.NopCloser(strings.NewReader("")), func(emit func(Location) error, onErr func(error)) (int, error) {
+		for i := 0; ; i++ {
+			if i == 10 {
+				close(started)
+			}
+			if i >= 10 {
+				time.Sleep(time.Millisecond)
+			}
+			loc := Location{Timestamp: 1700000000 + int64(i), UserID: "alice", DeviceID: "phone", Lat: 51.5, Lon: -0.12}
+			if err := emit(loc); err != nil {
+				return i, err
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("StartStream: %v", err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := fm.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	job, err := db.GetImportJob(jobID)
+	if err != nil {
+		t.Fatalf("GetImportJob: %v", err)
+	}
+	if job.Status != "interrupted" {
+		t.Errorf("job status = %q, want interrupted", job.Status)
+	}
+	if job.Imported == 0 {
+		t.Error("job recorded no imported locations, want its checkpointed batches")
+	}
+
+	if _, err := fm.Start("kml", "phone", nil, TimelineImportStats{}); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Start after Shutdown error = %v, want %v", err, ErrShuttingDown)
+	}
+}
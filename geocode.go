@@ -2,20 +2,87 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-// GeocodingService handles reverse geocoding using Nominatim API
+// Geocoder is a geocoding provider
+// Reverse implementations return nil (not an error) when no useful place is found.
+type Geocoder interface {
+	Reverse(ctx context.Context, lat, lon float64) (*GeocodedPlace, error)
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
+
+// SearchResult is a forward geocoding match for a place search
+type SearchResult struct {
+	DisplayName string    `json:"display_name"`
+	Lat         float64   `json:"lat"`
+	Lon         float64   `json:"lon"`
+	BoundingBox []float64 `json:"boundingbox,omitempty"` // [min_lat, max_lat, min_lon, max_lon]
+}
+
+// Forward search result caching. Searches are interactive, so a short TTL
+// absorbs repeated queries without keeping results around for long.
+const (
+	searchCacheTTL     = 10 * time.Minute
+	searchCacheMaxSize = 256
+	searchResultLimit  = 5
+)
+
+// searchCacheEntry is a cached forward search result
+type searchCacheEntry struct {
+	results []SearchResult
+	expires time.Time
+}
+
+// GeocodingService handles reverse geocoding through a pluggable provider,
+// with a bounding box cache and rate limiting in front of it
 type GeocodingService struct {
-	db          *DB
-	httpClient  *http.Client
-	lastRequest time.Time
-	rateMu      sync.Mutex
+	db       *DB
+	provider Geocoder
+	limiter  *rateLimiter  // Spaces provider requests across all callers
+	cacheTTL time.Duration // geocache rows older than this are refetched (0 = never expire)
+	language string        // Accept-Language of cached names; part of every cache key
+
+	// inflight deduplicates concurrent lookups for the same stored place key
+	inflight   map[placeKey]*geocodeCall
+	inflightMu sync.Mutex
+
+	// searchCache holds recent forward search results by normalized query
+	searchCache   map[string]searchCacheEntry
+	searchCacheMu sync.Mutex
+}
+
+// placeKeyResolution is the grid size (in degrees) for stored place names.
+// 0.0001 degrees is roughly 10m, so a stop centroid maps to a stable key.
+const placeKeyResolution = 0.0001
+
+// placeKey identifies a rounded coordinate in the location_geocodes table
+type placeKey struct {
+	latKey, lonKey int64
+}
+
+func placeKeyFor(lat, lon float64) placeKey {
+	return placeKey{
+		latKey: int64(math.Round(lat / placeKeyResolution)),
+		lonKey: int64(math.Round(lon / placeKeyResolution)),
+	}
+}
+
+// geocodeCall is a pending lookup that other callers for the same key wait on
+type geocodeCall struct {
+	done  chan struct{}
+	place *GeocodedPlace
+	err   error
 }
 
 // GeocodedPlace represents a reverse geocoded result
@@ -25,6 +92,9 @@ type GeocodedPlace struct {
 	DisplayName string  `json:"display_name,omitempty"`
 	Lat         float64 `json:"lat"`
 	Lon         float64 `json:"lon"`
+	// BoundingBox is the provider's extent for the place as
+	// [min_lat, max_lat, min_lon, max_lon], used to populate geocache
+	BoundingBox []float64 `json:"-"`
 }
 
 // LatLon is a simple lat/lon pair for batch operations
@@ -33,18 +103,73 @@ type LatLon struct {
 	Lon float64
 }
 
-// NewGeocodingService creates a new geocoding service
-func NewGeocodingService(db *DB) *GeocodingService {
+// NewGeocodingService creates a new geocoding service using the given provider
+// language must match the provider's, so cached names are only served in that language.
+func NewGeocodingService(db *DB, provider Geocoder, rateLimit, cacheTTL time.Duration, language string) *GeocodingService {
 	return &GeocodingService{
-		db: db,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		db:          db,
+		provider:    provider,
+		limiter:     &rateLimiter{interval: rateLimit},
+		cacheTTL:    cacheTTL,
+		language:    language,
+		inflight:    make(map[placeKey]*geocodeCall),
+		searchCache: make(map[string]searchCacheEntry),
+	}
+}
+
+// NewGeocoderFromConfig builds the reverse geocoding provider selected in config
+func NewGeocoderFromConfig(cfg *Config) (Geocoder, error) {
+	switch provider := cfg.GeocodingProvider(); provider {
+	case "nominatim":
+		zoom := cfg.GeocodingZoom()
+		if !validNominatimZoom(zoom) {
+			return nil, fmt.Errorf("invalid geocoding zoom %d (must be 3-18)", zoom)
+		}
+		p := NewNominatimProvider(cfg.GeocodingURL())
+		p.language = cfg.GeocodingLanguage()
+		p.zoom = zoom
+		p.preferArea = cfg.GeocodingPreferArea()
+		return p, nil
+	case "photon":
+		p := NewPhotonProvider(cfg.GeocodingURL())
+		p.language = cfg.GeocodingLanguage()
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown geocoding provider %q", provider)
+	}
+}
+
+// zoomReverser is implemented by providers that can reverse geocode at a chosen detail level
+type zoomReverser interface {
+	ReverseAtZoom(ctx context.Context, lat, lon float64, zoom int) (*GeocodedPlace, error)
+}
+
+// ReverseGeocodeAtZoom geocodes a point at a specific detail level. The place caches hold
+// names at the configured level, so they are bypassed; the rate limit still applies.
+// Providers without zoom control fall back to ReverseGeocode.
+func (g *GeocodingService) ReverseGeocodeAtZoom(ctx context.Context, lat, lon float64, zoom int) (*GeocodedPlace, error) {
+	zr, ok := g.provider.(zoomReverser)
+	if !ok {
+		return g.ReverseGeocode(ctx, lat, lon)
+	}
+	if err := g.limiter.Wait(ctx); err != nil {
+		return nil, err
 	}
+	return zr.ReverseAtZoom(ctx, lat, lon, zoom)
 }
 
-// ReverseGeocodeBatch geocodes multiple points using Nominatim API
-// Respects Nominatim's 1 request/second rate limit
+// batchCoalesceMeters is how close two points in one batch must be to share a lookup
+const batchCoalesceMeters = 15.0
+
+// batchLookup is a point already resolved earlier in the same batch
+type batchLookup struct {
+	pt    LatLon
+	place *GeocodedPlace
+}
+
+// ReverseGeocodeBatch geocodes multiple points, preferring stored place names
+// Only new points hit the provider, respecting the configured rate limit.
+// Points within batchCoalesceMeters of one already resolved in the batch reuse its place.
 func (g *GeocodingService) ReverseGeocodeBatch(ctx context.Context, points []LatLon) (map[int]*GeocodedPlace, error) {
 	results := make(map[int]*GeocodedPlace)
 
@@ -52,46 +177,256 @@ func (g *GeocodingService) ReverseGeocodeBatch(ctx context.Context, points []Lat
 		return results, nil
 	}
 
+	var done []batchLookup
 	for i, pt := range points {
-		// Check database cache first
-		cached, err := g.lookupCache(pt.Lat, pt.Lon)
-		if err == nil && cached != nil {
-			results[i] = cached
-			continue
+		place, ok := nearbyBatchLookup(done, pt)
+		if !ok {
+			var err error
+			place, err = g.ReverseGeocode(ctx, pt.Lat, pt.Lon)
+			if err != nil {
+				fmt.Printf("[geocode] ERROR for (%.6f,%.6f): %v\n", pt.Lat, pt.Lon, err)
+				continue
+			}
+			done = append(done, batchLookup{pt: pt, place: place})
 		}
 
-		// Rate limit: 1 request per second
-		g.rateMu.Lock()
-		elapsed := time.Since(g.lastRequest)
-		if elapsed < time.Second {
-			time.Sleep(time.Second - elapsed)
+		if place != nil {
+			results[i] = place
 		}
-		g.lastRequest = time.Now()
-		g.rateMu.Unlock()
+	}
 
-		// Fetch from Nominatim
-		place, err := g.fetchFromNominatim(ctx, pt.Lat, pt.Lon)
-		if err != nil {
-			fmt.Printf("[nominatim] ERROR for (%.6f,%.6f): %v\n", pt.Lat, pt.Lon, err)
-			continue
+	return results, nil
+}
+
+// nearbyBatchLookup finds a lookup within batchCoalesceMeters of pt. Batches are at most a
+// few thousand stops, so a linear scan is cheap next to a provider request.
+func nearbyBatchLookup(done []batchLookup, pt LatLon) (*GeocodedPlace, bool) {
+	for _, prev := range done {
+		if DistanceMeters(prev.pt.Lat, prev.pt.Lon, pt.Lat, pt.Lon) <= batchCoalesceMeters {
+			return prev.place, true
 		}
+	}
+	return nil, false
+}
 
-		if place != nil {
-			results[i] = place
+// ReverseGeocode returns the place name for a point, preferring a fresh stored
+// name in location_geocodes. Concurrent calls for the same rounded
+// coordinate share a single lookup so the provider is hit at most once.
+// A waiter whose shared lookup was cut short by the first caller's context
+// looks the point up again under its own.
+func (g *GeocodingService) ReverseGeocode(ctx context.Context, lat, lon float64) (*GeocodedPlace, error) {
+	key := placeKeyFor(lat, lon)
+
+	g.inflightMu.Lock()
+	for {
+		call, ok := g.inflight[key]
+		if !ok {
+			break
+		}
+		g.inflightMu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if !isContextError(call.err) || ctx.Err() != nil {
+			return call.place, call.err
 		}
+		g.inflightMu.Lock()
 	}
+	call := &geocodeCall{done: make(chan struct{})}
+	g.inflight[key] = call
+	g.inflightMu.Unlock()
+
+	call.place, call.err = g.db.GetOrGeocodePlace(ctx, lat, lon, g.language, g.cacheCutoff(), g.geocodeUncached)
+
+	g.inflightMu.Lock()
+	delete(g.inflight, key)
+	g.inflightMu.Unlock()
+	close(call.done)
+
+	return call.place, call.err
+}
+
+// isContextError reports whether err comes from a cancelled or expired context
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// geocodeUncached resolves a point via the bounding box cache, falling back to the provider
+func (g *GeocodingService) geocodeUncached(ctx context.Context, lat, lon float64) (*GeocodedPlace, error) {
+	// Check bounding box cache first
+	cached, err := g.lookupCache(lat, lon)
+	if err == nil && cached != nil {
+		return cached, nil
+	}
+
+	if err := g.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	place, err := g.provider.Reverse(ctx, lat, lon)
+	if err != nil || place == nil {
+		return nil, err
+	}
+
+	// Cache the result using the provider's bounding box,
+	// expanded to include the query point if needed
+	if len(place.BoundingBox) == 4 {
+		minLat := math.Min(place.BoundingBox[0], lat)
+		maxLat := math.Max(place.BoundingBox[1], lat)
+		minLon := math.Min(place.BoundingBox[2], lon)
+		maxLon := math.Max(place.BoundingBox[3], lon)
+
+		if err := g.insertCache(lat, lon, minLat, maxLat, minLon, maxLon, place); err != nil {
+			fmt.Printf("[geocache] INSERT ERROR: %v\n", err)
+		}
+	}
+
+	return place, nil
+}
+
+// rateLimiter spaces calls at least interval apart, however many goroutines call Wait.
+// Each caller reserves the next free slot under the lock and sleeps outside it, so
+// waiters are served in order and can give up when their context ends.
+type rateLimiter struct {
+	interval time.Duration // 0 = unlimited
+	mu       sync.Mutex
+	next     time.Time // Earliest time the next call may start
+}
+
+// Wait blocks until the caller's slot arrives or ctx ends. A slot abandoned on
+// cancellation is not reused, which only makes the limiter more conservative.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	slot := l.next
+	if now := time.Now(); slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Search forward geocodes a place query, returning up to searchResultLimit matches.
+// Results are cached briefly by normalized query.
+func (g *GeocodingService) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	key := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	if key == "" {
+		return nil, nil
+	}
+
+	g.searchCacheMu.Lock()
+	entry, ok := g.searchCache[key]
+	g.searchCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.results, nil
+	}
+
+	if err := g.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	results, err := g.provider.Search(ctx, query, searchResultLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	g.searchCacheMu.Lock()
+	defer g.searchCacheMu.Unlock()
+	if len(g.searchCache) >= searchCacheMaxSize {
+		// Drop expired entries, or everything if none have expired yet
+		now := time.Now()
+		for k, e := range g.searchCache {
+			if now.After(e.expires) {
+				delete(g.searchCache, k)
+			}
+		}
+		if len(g.searchCache) >= searchCacheMaxSize {
+			clear(g.searchCache)
+		}
+	}
+	g.searchCache[key] = searchCacheEntry{results: results, expires: time.Now().Add(searchCacheTTL)}
 
 	return results, nil
 }
 
-// lookupCache checks if a point falls within any cached bounding box
+// GetOrGeocodePlace returns the stored place name for a point, calling geocode
+// and persisting its result when no name has been stored for the rounded coordinate
+// in the given language since cutoff. Returns nil without storing anything if geocode finds no useful place.
+func (db *DB) GetOrGeocodePlace(ctx context.Context, lat, lon float64, language string, cutoff int64, geocode func(ctx context.Context, lat, lon float64) (*GeocodedPlace, error)) (*GeocodedPlace, error) {
+	key := placeKeyFor(lat, lon)
+
+	var placeName string
+	var placeType, displayName sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT place_name, place_type, display_name
+		FROM location_geocodes
+		WHERE lat_key = ? AND lon_key = ? AND language = ? AND created_at >= ?
+	`, key.latKey, key.lonKey, language, cutoff).Scan(&placeName, &placeType, &displayName)
+	if err == nil {
+		return &GeocodedPlace{
+			PlaceName:   placeName,
+			PlaceType:   placeType.String,
+			DisplayName: displayName.String,
+			Lat:         lat,
+			Lon:         lon,
+		}, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	place, err := geocode(ctx, lat, lon)
+	if err != nil || place == nil {
+		return nil, err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO location_geocodes (lat_key, lon_key, language, place_name, place_type, display_name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, key.latKey, key.lonKey, language, place.PlaceName, place.PlaceType, place.DisplayName, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("[location_geocodes] INSERT ERROR: %v\n", err)
+	}
+
+	return place, nil
+}
+
+// cacheCutoff returns the oldest created_at still considered fresh
+func (g *GeocodingService) cacheCutoff() int64 {
+	if g.cacheTTL <= 0 {
+		return 0
+	}
+	return time.Now().Add(-g.cacheTTL).Unix()
+}
+
+// lookupCache checks if a point falls within any fresh cached bounding box in the service's language
 func (g *GeocodingService) lookupCache(lat, lon float64) (*GeocodedPlace, error) {
 	row := g.db.QueryRow(`
 		SELECT place_name, place_type, display_name
 		FROM geocache
 		WHERE ? >= min_lat AND ? <= max_lat AND ? >= min_lon AND ? <= max_lon
+		  AND language = ? AND created_at >= ?
+		ORDER BY created_at DESC
 		LIMIT 1
-	`, lat, lat, lon, lon)
+	`, lat, lat, lon, lon, g.language, g.cacheCutoff())
 
 	var placeName, placeType, displayName string
 	err := row.Scan(&placeName, &placeType, &displayName)
@@ -108,13 +443,81 @@ func (g *GeocodingService) lookupCache(lat, lon float64) (*GeocodedPlace, error)
 	}, nil
 }
 
-// insertCache stores a geocoding result with its bounding box
-func (g *GeocodingService) insertCache(minLat, maxLat, minLon, maxLon float64, place *GeocodedPlace) error {
-	_, err := g.db.Exec(`
-		INSERT OR IGNORE INTO geocache (min_lat, max_lat, min_lon, max_lon, place_name, place_type, display_name, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, minLat, maxLat, minLon, maxLon, place.PlaceName, place.PlaceType, place.DisplayName, time.Now().Unix())
-	return err
+// insertCache stores a geocoding result with its bounding box, replacing any
+// stale entries covering the query point so old names and extents don't linger
+func (g *GeocodingService) insertCache(lat, lon, minLat, maxLat, minLon, maxLon float64, place *GeocodedPlace) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM geocache
+		WHERE ? >= min_lat AND ? <= max_lat AND ? >= min_lon AND ? <= max_lon
+		  AND language = ? AND created_at < ?
+	`, lat, lat, lon, lon, g.language, g.cacheCutoff())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO geocache (min_lat, max_lat, min_lon, max_lon, language, place_name, place_type, display_name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, minLat, maxLat, minLon, maxLon, g.language, place.PlaceName, place.PlaceType, place.DisplayName, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PruneGeocache deletes geocache and location_geocodes rows older than maxAge
+// Returns the number of rows removed.
+func (db *DB) PruneGeocache(maxAge time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-maxAge).Unix()
+	var total int64
+	for _, table := range []string{"geocache", "location_geocodes"} {
+		result, err := db.Exec(`DELETE FROM `+table+` WHERE created_at < ?`, cutoff)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// NominatimProvider reverse geocodes using a Nominatim server
+type NominatimProvider struct {
+	baseURL    string
+	httpClient *http.Client
+	language   string // Accept-Language header value (empty = local-script names)
+	zoom       int    // Reverse detail level, 3 (country) to 18 (building)
+	preferArea bool   // Name by neighbourhood/suburb before amenity or street
+}
+
+// validNominatimZoom reports whether zoom is a detail level Nominatim accepts for reverse lookups
+func validNominatimZoom(zoom int) bool {
+	return zoom >= 3 && zoom <= 18
+}
+
+// NewNominatimProvider creates a Nominatim provider
+// An empty baseURL uses the public OpenStreetMap instance.
+func NewNominatimProvider(baseURL string) *NominatimProvider {
+	if baseURL == "" {
+		baseURL = "https://nominatim.openstreetmap.org"
+	}
+	return &NominatimProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		zoom: DefaultGeocodingZoom,
+	}
 }
 
 // nominatimResponse represents the JSON response from Nominatim reverse API
@@ -147,12 +550,17 @@ type address struct {
 	Country       string `json:"country,omitempty"`
 }
 
-// fetchFromNominatim queries Nominatim for reverse geocoding
-func (g *GeocodingService) fetchFromNominatim(ctx context.Context, lat, lon float64) (*GeocodedPlace, error) {
-	// Build URL - zoom=18 gives building-level detail
+// Reverse queries Nominatim for reverse geocoding at the configured detail level
+func (p *NominatimProvider) Reverse(ctx context.Context, lat, lon float64) (*GeocodedPlace, error) {
+	return p.ReverseAtZoom(ctx, lat, lon, p.zoom)
+}
+
+// ReverseAtZoom queries Nominatim for reverse geocoding at the given detail level
+func (p *NominatimProvider) ReverseAtZoom(ctx context.Context, lat, lon float64, zoom int) (*GeocodedPlace, error) {
+	// zoom=18 gives building-level detail, lower levels name streets, suburbs, cities...
 	reqURL := fmt.Sprintf(
-		"https://nominatim.openstreetmap.org/reverse?lat=%.6f&lon=%.6f&format=jsonv2&zoom=18&addressdetails=1",
-		lat, lon,
+		"%s/reverse?lat=%.6f&lon=%.6f&format=jsonv2&zoom=%d&addressdetails=1",
+		p.baseURL, lat, lon, zoom,
 	)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
@@ -161,8 +569,11 @@ func (g *GeocodingService) fetchFromNominatim(ctx context.Context, lat, lon floa
 	}
 	// Required by Nominatim ToS
 	req.Header.Set("User-Agent", "Whence/1.0 (location-history-app)")
+	if p.language != "" {
+		req.Header.Set("Accept-Language", p.language)
+	}
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("nominatim request failed: %w", err)
 	}
@@ -178,7 +589,7 @@ func (g *GeocodingService) fetchFromNominatim(ctx context.Context, lat, lon floa
 	}
 
 	// Extract best place name
-	placeName := extractPlaceName(nr)
+	placeName := extractPlaceName(nr, p.preferArea)
 	if placeName == "" {
 		return nil, nil // No useful result
 	}
@@ -191,31 +602,12 @@ func (g *GeocodingService) fetchFromNominatim(ctx context.Context, lat, lon floa
 		Lon:         lon,
 	}
 
-	// Cache the result using bounding box from Nominatim
-	// Expand bbox to include query point if needed
 	if len(nr.BoundingBox) == 4 {
-		minLat, _ := strconv.ParseFloat(nr.BoundingBox[0], 64)
-		maxLat, _ := strconv.ParseFloat(nr.BoundingBox[1], 64)
-		minLon, _ := strconv.ParseFloat(nr.BoundingBox[2], 64)
-		maxLon, _ := strconv.ParseFloat(nr.BoundingBox[3], 64)
-
-		// Expand bbox to include the query point
-		if lat < minLat {
-			minLat = lat
-		}
-		if lat > maxLat {
-			maxLat = lat
-		}
-		if lon < minLon {
-			minLon = lon
-		}
-		if lon > maxLon {
-			maxLon = lon
-		}
-
-		if err := g.insertCache(minLat, maxLat, minLon, maxLon, place); err != nil {
-			fmt.Printf("[geocache] INSERT ERROR: %v\n", err)
+		bbox := make([]float64, 4)
+		for i, v := range nr.BoundingBox {
+			bbox[i], _ = strconv.ParseFloat(v, 64)
 		}
+		place.BoundingBox = bbox
 	}
 
 	fmt.Printf("[nominatim] (%.6f,%.6f) -> %q\n", lat, lon, placeName)
@@ -223,15 +615,82 @@ func (g *GeocodingService) fetchFromNominatim(ctx context.Context, lat, lon floa
 	return place, nil
 }
 
-// extractPlaceName gets the most useful place name from a Nominatim response
-func extractPlaceName(nr nominatimResponse) string {
+// nominatimSearchResult is one match from the Nominatim search API
+type nominatimSearchResult struct {
+	Lat         string   `json:"lat"`
+	Lon         string   `json:"lon"`
+	DisplayName string   `json:"display_name"`
+	BoundingBox []string `json:"boundingbox"` // [min_lat, max_lat, min_lon, max_lon]
+}
+
+// Search queries Nominatim for forward geocoding
+func (p *NominatimProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	reqURL := fmt.Sprintf("%s/search?q=%s&format=jsonv2&limit=%d", p.baseURL, url.QueryEscape(query), limit)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Required by Nominatim ToS
+	req.Header.Set("User-Agent", "Whence/1.0 (location-history-app)")
+	if p.language != "" {
+		req.Header.Set("Accept-Language", p.language)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("nominatim request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim returned status %d", resp.StatusCode)
+	}
+
+	var matches []nominatimSearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+		return nil, fmt.Errorf("failed to parse nominatim response: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(matches))
+	for _, m := range matches {
+		lat, errLat := strconv.ParseFloat(m.Lat, 64)
+		lon, errLon := strconv.ParseFloat(m.Lon, 64)
+		if errLat != nil || errLon != nil {
+			continue
+		}
+		result := SearchResult{DisplayName: m.DisplayName, Lat: lat, Lon: lon}
+		if len(m.BoundingBox) == 4 {
+			result.BoundingBox = make([]float64, 4)
+			for i, v := range m.BoundingBox {
+				result.BoundingBox[i], _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// extractPlaceName gets the most useful place name from a Nominatim response.
+// With preferArea, the neighbourhood or suburb wins over specific named places.
+func extractPlaceName(nr nominatimResponse, preferArea bool) string {
+	addr := nr.Address
+	if preferArea {
+		if addr.Neighbourhood != "" {
+			return addr.Neighbourhood
+		}
+		if addr.Suburb != "" {
+			return addr.Suburb
+		}
+	}
+
 	// Prefer specific named places
 	if nr.Name != "" {
 		return nr.Name
 	}
 
 	// Check address components for named places
-	addr := nr.Address
 	if addr.Amenity != "" {
 		return addr.Amenity
 	}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PhotonProvider reverse geocodes using a Photon server (https://github.com/komoot/photon)
+type PhotonProvider struct {
+	baseURL    string
+	httpClient *http.Client
+	language   string // Photon lang parameter (empty = local names)
+}
+
+// NewPhotonProvider creates a Photon provider
+// An empty baseURL uses the public komoot instance.
+func NewPhotonProvider(baseURL string) *PhotonProvider {
+	if baseURL == "" {
+		baseURL = "https://photon.komoot.io"
+	}
+	return &PhotonProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// photonResponse represents the GeoJSON response from Photon's reverse API
+type photonResponse struct {
+	Features []struct {
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"` // [lon, lat]
+		} `json:"geometry"`
+		Properties photonProperties `json:"properties"`
+	} `json:"features"`
+}
+
+type photonProperties struct {
+	Name        string    `json:"name"`
+	OSMKey      string    `json:"osm_key"`
+	OSMValue    string    `json:"osm_value"`
+	HouseNumber string    `json:"housenumber"`
+	Street      string    `json:"street"`
+	District    string    `json:"district"`
+	Locality    string    `json:"locality"`
+	City        string    `json:"city"`
+	State       string    `json:"state"`
+	Country     string    `json:"country"`
+	Extent      []float64 `json:"extent"` // [min_lon, max_lat, max_lon, min_lat]
+}
+
+// Reverse queries Photon for reverse geocoding
+func (p *PhotonProvider) Reverse(ctx context.Context, lat, lon float64) (*GeocodedPlace, error) {
+	reqURL := fmt.Sprintf("%s/reverse?lat=%.6f&lon=%.6f&limit=1", p.baseURL, lat, lon)
+	if p.language != "" {
+		reqURL += "&lang=" + url.QueryEscape(p.language)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Whence/1.0 (location-history-app)")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("photon request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("photon returned status %d", resp.StatusCode)
+	}
+
+	var pr photonResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return nil, fmt.Errorf("failed to parse photon response: %w", err)
+	}
+
+	if len(pr.Features) == 0 {
+		return nil, nil // No useful result
+	}
+	props := pr.Features[0].Properties
+
+	placeName := extractPhotonPlaceName(props)
+	if placeName == "" {
+		return nil, nil // No useful result
+	}
+
+	place := &GeocodedPlace{
+		PlaceName:   placeName,
+		PlaceType:   props.OSMValue,
+		DisplayName: photonDisplayName(props),
+		Lat:         lat,
+		Lon:         lon,
+	}
+
+	if len(props.Extent) == 4 {
+		place.BoundingBox = []float64{props.Extent[3], props.Extent[1], props.Extent[0], props.Extent[2]}
+	}
+
+	fmt.Printf("[photon] (%.6f,%.6f) -> %q\n", lat, lon, placeName)
+
+	return place, nil
+}
+
+// Search queries Photon for forward geocoding
+func (p *PhotonProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	reqURL := fmt.Sprintf("%s/api?q=%s&limit=%d", p.baseURL, url.QueryEscape(query), limit)
+	if p.language != "" {
+		reqURL += "&lang=" + url.QueryEscape(p.language)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Whence/1.0 (location-history-app)")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("photon request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("photon returned status %d", resp.StatusCode)
+	}
+
+	var pr photonResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return nil, fmt.Errorf("failed to parse photon response: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(pr.Features))
+	for _, f := range pr.Features {
+		if len(f.Geometry.Coordinates) != 2 {
+			continue
+		}
+		result := SearchResult{
+			DisplayName: photonDisplayName(f.Properties),
+			Lat:         f.Geometry.Coordinates[1],
+			Lon:         f.Geometry.Coordinates[0],
+		}
+		if ext := f.Properties.Extent; len(ext) == 4 {
+			result.BoundingBox = []float64{ext[3], ext[1], ext[0], ext[2]}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// extractPhotonPlaceName gets the most useful place name from Photon properties,
+// following the same preference order as extractPlaceName
+func extractPhotonPlaceName(props photonProperties) string {
+	if props.Name != "" {
+		return props.Name
+	}
+
+	// Fall back to street address
+	if props.Street != "" {
+		if props.HouseNumber != "" {
+			return props.HouseNumber + " " + props.Street
+		}
+		return props.Street
+	}
+
+	// Fall back to neighborhood/district
+	if props.Locality != "" {
+		return props.Locality
+	}
+	if props.District != "" {
+		return props.District
+	}
+
+	return props.City
+}
+
+// photonDisplayName builds a Nominatim-style comma-separated display name
+func photonDisplayName(props photonProperties) string {
+	var parts []string
+	street := props.Street
+	if street != "" && props.HouseNumber != "" {
+		street = props.HouseNumber + " " + street
+	}
+	for _, part := range []string{props.Name, street, props.District, props.City, props.State, props.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGeocoder is a provider that names each point by its coordinates and records
+// when it was called. Places have no bounding box, so the geocache never serves them.
+type fakeGeocoder struct {
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func (f *fakeGeocoder) Reverse(ctx context.Context, lat, lon float64) (*GeocodedPlace, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, time.Now())
+	f.mu.Unlock()
+	return &GeocodedPlace{PlaceName: fmt.Sprintf("%.4f,%.4f", lat, lon), Lat: lat, Lon: lon}, nil
+}
+
+func (f *fakeGeocoder) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	return nil, nil
+}
+
+// callTimes returns when Reverse was called, in order
+func (f *fakeGeocoder) callTimes() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func TestReverseGeocodeBatchSpacesConcurrentRequests(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	provider := &fakeGeocoder{}
+	g := NewGeocodingService(openTestDB(t), provider, interval, 0, "en")
+
+	// Four overlapping batches of three distinct places each
+	var wg sync.WaitGroup
+	for b := range 4 {
+		wg.Go(func() {
+			var points []LatLon
+			for i := range 3 {
+				points = append(points, LatLon{Lat: 10 + float64(b), Lon: 10 + float64(i)})
+			}
+			if _, err := g.ReverseGeocodeBatch(context.Background(), points); err != nil {
+				t.Errorf("ReverseGeocodeBatch: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	calls := provider.callTimes()
+	if len(calls) != 12 {
+		t.Fatalf("provider called %d times, want 12", len(calls))
+	}
+	for i := 1; i < len(calls); i++ {
+		// A request woken late can leave a shorter gap to the next, but never a burst
+		if gap := calls[i].Sub(calls[i-1]); gap < interval/2 {
+			t.Errorf("requests %d and %d were %v apart, want about %v", i-1, i, gap, interval)
+		}
+	}
+	if span, want := calls[len(calls)-1].Sub(calls[0]), time.Duration(len(calls)-1)*interval-interval/2; span < want {
+		t.Errorf("requests spanned %v, want at least %v", span, want)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	l := &rateLimiter{interval: time.Hour}
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("second Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReverseGeocodeBatchCoalescesNearbyPoints(t *testing.T) {
+	provider := &fakeGeocoder{}
+	g := NewGeocodingService(openTestDB(t), provider, 0, 0, "en")
+
+	// 10 m apart, in different stored place keys
+	a := LatLon{Lat: 51.50070, Lon: -0.12460}
+	b := LatLon{Lat: 51.50079, Lon: -0.12460}
+	if placeKeyFor(a.Lat, a.Lon) == placeKeyFor(b.Lat, b.Lon) {
+		t.Fatal("test points share a place key")
+	}
+
+	results, err := g.ReverseGeocodeBatch(context.Background(), []LatLon{a, b})
+	if err != nil {
+		t.Fatalf("ReverseGeocodeBatch: %v", err)
+	}
+	if n := len(provider.callTimes()); n != 1 {
+		t.Errorf("provider called %d times, want 1", n)
+	}
+	if len(results) != 2 || results[0] != results[1] {
+		t.Errorf("results = %v, want both points to share one place", results)
+	}
+}
+
+// blockingGeocoder holds its first lookup until the caller's context ends, then
+// answers every later lookup immediately
+type blockingGeocoder struct {
+	fakeGeocoder
+	started chan struct{} // Closed once the first lookup is blocked
+	once    sync.Once
+}
+
+func (b *blockingGeocoder) Reverse(ctx context.Context, lat, lon float64) (*GeocodedPlace, error) {
+	first := false
+	b.once.Do(func() { first = true })
+	if first {
+		close(b.started)
+		<-ctx.Done()
+		return nil, fmt.Errorf("nominatim request: %w", ctx.Err())
+	}
+	return b.fakeGeocoder.Reverse(ctx, lat, lon)
+}
+
+func TestReverseGeocodeWaiterOutlivesCancelledLookup(t *testing.T) {
+	provider := &blockingGeocoder{started: make(chan struct{})}
+	g := NewGeocodingService(openTestDB(t), provider, 0, 0, "en")
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := g.ReverseGeocode(firstCtx, 51.5, -0.12)
+		firstErr <- err
+	}()
+	<-provider.started
+
+	// The second caller joins the first's lookup, which is then cancelled
+	type result struct {
+		place *GeocodedPlace
+		err   error
+	}
+	second := make(chan result, 1)
+	go func() {
+		place, err := g.ReverseGeocode(context.Background(), 51.5, -0.12)
+		second <- result{place, err}
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the second caller start waiting
+	cancelFirst()
+
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller error = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case r := <-second:
+		if r.err != nil || r.place == nil {
+			t.Errorf("second caller = %v, %v; want a place", r.place, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second caller never returned")
+	}
+}
+
+func TestReverseGeocodeRefetchesExpiredStoredName(t *testing.T) {
+	const ttl = 24 * time.Hour
+	db := openTestDB(t)
+	provider := &fakeGeocoder{}
+	g := NewGeocodingService(db, provider, 0, ttl, "en")
+
+	// Stored names for two points, one past the TTL
+	expired := LatLon{Lat: 51.5007, Lon: -0.1246}
+	fresh := LatLon{Lat: 48.8584, Lon: 2.2945}
+	for _, stored := range []struct {
+		pt  LatLon
+		age time.Duration
+	}{{expired, 2 * ttl}, {fresh, time.Hour}} {
+		key := placeKeyFor(stored.pt.Lat, stored.pt.Lon)
+		_, err := db.Exec(`INSERT INTO location_geocodes (lat_key, lon_key, language, place_name, created_at) VALUES (?, ?, 'en', 'Old name', ?)`,
+			key.latKey, key.lonKey, time.Now().Add(-stored.age).Unix())
+		if err != nil {
+			t.Fatalf("insert location_geocodes: %v", err)
+		}
+	}
+
+	place, err := g.ReverseGeocode(context.Background(), fresh.Lat, fresh.Lon)
+	if err != nil || place == nil || place.PlaceName != "Old name" {
+		t.Errorf("fresh point = %v, %v; want the stored name", place, err)
+	}
+	if n := len(provider.callTimes()); n != 0 {
+		t.Errorf("provider called %d times for a fresh stored name, want 0", n)
+	}
+
+	place, err = g.ReverseGeocode(context.Background(), expired.Lat, expired.Lon)
+	if err != nil || place == nil || place.PlaceName == "Old name" {
+		t.Errorf("expired point = %v, %v; want a refetched name", place, err)
+	}
+	if n := len(provider.callTimes()); n != 1 {
+		t.Errorf("provider called %d times for an expired stored name, want 1", n)
+	}
+
+	// The refetched name replaced the expired row and is served from storage
+	if _, err := g.ReverseGeocode(context.Background(), expired.Lat, expired.Lon); err != nil {
+		t.Fatalf("ReverseGeocode: %v", err)
+	}
+	if n := len(provider.callTimes()); n != 1 {
+		t.Errorf("provider called %d times after refetching, want 1", n)
+	}
+}
+
+func TestPruneGeocacheLocationGeocodes(t *testing.T) {
+	const ttl = 24 * time.Hour
+	db := openTestDB(t)
+	for i, age := range []time.Duration{2 * ttl, time.Hour} {
+		_, err := db.Exec(`INSERT INTO location_geocodes (lat_key, lon_key, language, place_name, created_at) VALUES (?, 0, 'en', 'Somewhere', ?)`,
+			i, time.Now().Add(-age).Unix())
+		if err != nil {
+			t.Fatalf("insert location_geocodes: %v", err)
+		}
+	}
+
+	pruned, err := db.PruneGeocache(ttl)
+	if err != nil {
+		t.Fatalf("PruneGeocache: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d rows, want 1", pruned)
+	}
+	var left int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM location_geocodes`).Scan(&left); err != nil {
+		t.Fatalf("count location_geocodes: %v", err)
+	}
+	if left != 1 {
+		t.Errorf("%d location_geocodes rows left, want 1", left)
+	}
+}
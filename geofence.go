@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GeofenceEvent is an enter or leave transition for a named region
+type GeofenceEvent struct {
+	Timestamp  int64   `json:"timestamp"`
+	UserID     string  `json:"user_id"`
+	DeviceID   string  `json:"device_id"`
+	Region     string  `json:"region"`
+	Event      string  `json:"event"` // "enter" or "leave"
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	Source     string  `json:"source"`                // "owntracks" or "server"
+	GeofenceID *int64  `json:"geofence_id,omitempty"` // Server-side geofence that fired
+}
+
+// InsertGeofenceEvent stores a transition, ignoring duplicates (e.g. resent OwnTracks messages)
+func (db *DB) InsertGeofenceEvent(event GeofenceEvent) error {
+	_, err := db.Exec(`
+		INSERT OR IGNORE INTO geofence_events (timestamp, user_id, device_id, region, event, lat, lon, source, geofence_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.Timestamp, event.UserID, event.DeviceID, event.Region, event.Event, event.Lat, event.Lon, event.Source, event.GeofenceID)
+	return err
+}
+
+// QueryGeofenceEvents returns transitions in an optional time range, oldest first.
+// Empty userID returns events for all users.
+func (db *DB) QueryGeofenceEvents(userID string, start, end *int64) ([]GeofenceEvent, error) {
+	query := `SELECT timestamp, user_id, device_id, region, event, lat, lon, source, geofence_id FROM geofence_events WHERE 1=1`
+	var args []any
+
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if start != nil {
+		query += " AND timestamp >= ?"
+		args = append(args, *start)
+	}
+	if end != nil {
+		query += " AND timestamp <= ?"
+		args = append(args, *end)
+	}
+	query += " ORDER BY timestamp"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []GeofenceEvent{}
+	for rows.Next() {
+		var e GeofenceEvent
+		if err := rows.Scan(&e.Timestamp, &e.UserID, &e.DeviceID, &e.Region, &e.Event, &e.Lat, &e.Lon, &e.Source, &e.GeofenceID); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GET /api/geofence/events - Returns geofence enter/leave transitions for a time range
+// Includes both OwnTracks-reported and server-detected transitions.
+func (s *Server) handleAPIGeofenceEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start, end := parseOptionalTimeRange(r.URL.Query())
+	events, err := s.db.QueryGeofenceEvents(s.queryUserID(r), start, end)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+const (
+	// geofenceMinHysteresisMeters is the minimum distance past a geofence's radius a point
+	// must be before the user counts as having left, so GPS jitter at the boundary doesn't flap
+	geofenceMinHysteresisMeters = 30.0
+
+	// geofenceHysteresisFraction scales the hysteresis margin with the geofence radius
+	geofenceHysteresisFraction = 0.1
+
+	// maxGeofenceRadiusMeters bounds how large a geofence may be
+	maxGeofenceRadiusMeters = 50000.0
+)
+
+// Geofence is a server-side circular region checked against every ingested point
+type Geofence struct {
+	ID        int64   `json:"id"`
+	UserID    string  `json:"user_id"`
+	Name      string  `json:"name"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	RadiusM   float64 `json:"radius_m"`
+	Active    bool    `json:"active"`
+	Inside    *bool   `json:"inside,omitempty"` // Last known state (nil until a point is evaluated)
+	StateTS   *int64  `json:"state_ts,omitempty"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+// hysteresisMeters returns how far past the radius a point must be to count as outside
+func (g Geofence) hysteresisMeters() float64 {
+	return math.Max(geofenceMinHysteresisMeters, g.RadiusM*geofenceHysteresisFraction)
+}
+
+// CreateGeofence stores a geofence and returns its ID
+func (db *DB) CreateGeofence(g Geofence) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO geofences (user_id, name, lat, lon, radius_m, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, g.UserID, g.Name, g.Lat, g.Lon, g.RadiusM, g.Active, g.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateGeofence changes a geofence's definition, resetting its state since the old
+// inside/outside answer may no longer hold. Returns false if the user has no such geofence.
+func (db *DB) UpdateGeofence(g Geofence) (bool, error) {
+	query := `UPDATE geofences SET name = ?, lat = ?, lon = ?, radius_m = ?, active = ?, inside = NULL, state_ts = NULL WHERE id = ?`
+	args := []any{g.Name, g.Lat, g.Lon, g.RadiusM, g.Active, g.ID}
+	if g.UserID != "" {
+		query += " AND user_id = ?"
+		args = append(args, g.UserID)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteGeofence removes a geofence. Its recorded events are kept.
+// Returns false if the user has no such geofence (empty userID matches any user).
+func (db *DB) DeleteGeofence(userID string, id int64) (bool, error) {
+	query := `DELETE FROM geofences WHERE id = ?`
+	args := []any{id}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListGeofences returns a user's geofences (empty userID = all users), optionally only active ones
+func (db *DB) ListGeofences(userID string, activeOnly bool) ([]Geofence, error) {
+	query := `SELECT id, user_id, name, lat, lon, radius_m, active, inside, state_ts, created_at FROM geofences WHERE 1=1`
+	var args []any
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if activeOnly {
+		query += " AND active = 1"
+	}
+	query += " ORDER BY name, id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	geofences := []Geofence{}
+	for rows.Next() {
+		var g Geofence
+		if err := rows.Scan(&g.ID, &g.UserID, &g.Name, &g.Lat, &g.Lon, &g.RadiusM, &g.Active, &g.Inside, &g.StateTS, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		geofences = append(geofences, g)
+	}
+	return geofences, rows.Err()
+}
+
+// setGeofenceState records the last known inside/outside state of a geofence
+func (db *DB) setGeofenceState(id int64, inside bool, ts int64) error {
+	_, err := db.Exec(`UPDATE geofences SET inside = ?, state_ts = ? WHERE id = ?`, inside, ts, id)
+	return err
+}
+
+// checkGeofences evaluates newly ingested points against their users' active geofences,
+// recording enter/leave transitions and notifying webhooks.
+// The first point after a geofence is created or changed only establishes its state.
+func (s *Server) checkGeofences(locs []Location) {
+	s.geofenceMu.Lock()
+	defer s.geofenceMu.Unlock()
+
+	geofencesByUser := make(map[string][]Geofence)
+	for _, loc := range locs {
+		geofences, ok := geofencesByUser[loc.UserID]
+		if !ok {
+			var err error
+			geofences, err = s.db.ListGeofences(loc.UserID, true)
+			if err != nil {
+				log.Printf("geofence: failed to list geofences: %v", err)
+				return
+			}
+			geofencesByUser[loc.UserID] = geofences
+		}
+
+		for i := range geofences {
+			g := &geofences[i]
+			// Points too imprecise to place inside or outside can't cause a transition
+			if loc.AccuracyM != nil && *loc.AccuracyM > g.RadiusM {
+				continue
+			}
+			// Late-arriving points don't override newer state
+			if g.StateTS != nil && loc.Timestamp <= *g.StateTS {
+				continue
+			}
+
+			dist := DistanceMeters(g.Lat, g.Lon, loc.Lat, loc.Lon)
+			var inside bool
+			switch {
+			case dist <= g.RadiusM:
+				inside = true
+			case dist > g.RadiusM+g.hysteresisMeters():
+				inside = false
+			default:
+				// In the hysteresis band: keep the current state
+				continue
+			}
+
+			changed := g.Inside != nil && *g.Inside != inside
+			if g.Inside != nil && !changed {
+				continue
+			}
+
+			if err := s.db.setGeofenceState(g.ID, inside, loc.Timestamp); err != nil {
+				log.Printf("geofence: failed to update state of %q: %v", g.Name, err)
+				continue
+			}
+			g.Inside = &inside
+			g.StateTS = &loc.Timestamp
+
+			if !changed {
+				continue
+			}
+
+			event := GeofenceEvent{
+				Timestamp:  loc.Timestamp,
+				UserID:     loc.UserID,
+				DeviceID:   loc.DeviceID,
+				Region:     g.Name,
+				Event:      "leave",
+				Lat:        loc.Lat,
+				Lon:        loc.Lon,
+				Source:     "server",
+				GeofenceID: &g.ID,
+			}
+			if inside {
+				event.Event = "enter"
+			}
+			if err := s.db.InsertGeofenceEvent(event); err != nil {
+				log.Printf("geofence: failed to record %s of %q: %v", event.Event, g.Name, err)
+			}
+			s.webhooks.SendGeofenceEvent(event)
+		}
+	}
+}
+
+// GeofenceRequest is the body of POST/PUT /api/geofences
+type GeofenceRequest struct {
+	Name    string  `json:"name"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	RadiusM float64 `json:"radius_m"`
+	Active  *bool   `json:"active,omitempty"` // Default true
+}
+
+// validate normalizes and checks a geofence request
+func (req *GeofenceRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return &httpError{code: http.StatusBadRequest, msg: "name required"}
+	}
+	if req.Lat < -90 || req.Lat > 90 || req.Lon < -180 || req.Lon > 180 {
+		return &httpError{code: http.StatusBadRequest, msg: "invalid lat/lon"}
+	}
+	if req.RadiusM <= 0 || req.RadiusM > maxGeofenceRadiusMeters {
+		return &httpError{code: http.StatusBadRequest, msg: fmt.Sprintf("radius_m must be between 0 and %.0f", maxGeofenceRadiusMeters)}
+	}
+	return nil
+}
+
+// /api/geofences - Manages server-side geofences
+// GET lists them, POST creates one, PUT ?id= replaces one, DELETE ?id= removes one.
+// Transitions are reported by GET /api/geofence/events.
+func (s *Server) handleAPIGeofences(w http.ResponseWriter, r *http.Request) {
+	// With auth enabled, users can only see and change their own geofences
+	userID := ingestUserID(r, s.queryUserID(r))
+
+	var id int64
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		var err error
+		id, err = strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		geofences, err := s.db.ListGeofences(userID, false)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(geofences)
+
+	case http.MethodPost, http.MethodPut:
+		var req GeofenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := req.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		g := Geofence{
+			ID:        id,
+			UserID:    userID,
+			Name:      req.Name,
+			Lat:       req.Lat,
+			Lon:       req.Lon,
+			RadiusM:   req.RadiusM,
+			Active:    req.Active == nil || *req.Active,
+			CreatedAt: time.Now().Unix(),
+		}
+
+		s.geofenceMu.Lock()
+		var err error
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			g.ID, err = s.db.CreateGeofence(g)
+			status = http.StatusCreated
+		} else {
+			var found bool
+			found, err = s.db.UpdateGeofence(g)
+			if err == nil && !found {
+				s.geofenceMu.Unlock()
+				http.Error(w, "geofence not found", http.StatusNotFound)
+				return
+			}
+		}
+		s.geofenceMu.Unlock()
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(g)
+
+	case http.MethodDelete:
+		s.geofenceMu.Lock()
+		found, err := s.db.DeleteGeofence(userID, id)
+		s.geofenceMu.Unlock()
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "geofence not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
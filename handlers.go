@@ -1,21 +1,143 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
+	"io"
+	"log"
 	"math"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
 type Server struct {
 	db            *DB
+	config        *Config
 	defaultUserID string
 	geocoder      *GeocodingService
+	live          *LocationBroadcaster // Newly ingested points for /api/stream/location
+	fileImports   *FileImportManager
+	places        *SignificantPlacesCache // Inferred Home/Work for timeline labels
+	geofenceMu    sync.Mutex              // Serializes geofence state transitions
+	webhooks      *WebhookDispatcher      // nil when no webhooks are configured
+	ingestLimiter *DeviceRateLimiter      // nil when ingest rate limiting is disabled
+	closing       context.Context         // Ends when shutdown starts, closing SSE streams (nil = never)
+}
+
+// publishIngested notifies live subscribers, geofences, and webhooks of newly ingested points
+func (s *Server) publishIngested(locs []Location) {
+	s.live.Publish(locs)
+	s.checkGeofences(locs)
+	s.webhooks.SendLocations(locs)
+}
+
+// errIngestRateLimited rejects requests from a device over its ingest rate limit
+var errIngestRateLimited = &httpError{code: http.StatusTooManyRequests, msg: "rate limit exceeded"}
+
+// storeIngested saves points from a tracking app, dropping any closer than the configured
+// minimum spacing, then updates their paths and publishes them. Returns errIngestRateLimited,
+// storing nothing, if any device in the batch is over its rate limit.
+func (s *Server) storeIngested(locs []Location) error {
+	seen := make(map[deviceRateKey]bool)
+	for _, loc := range locs {
+		key := deviceRateKey{loc.UserID, loc.DeviceID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if !s.ingestLimiter.Allow(loc.UserID, loc.DeviceID) {
+			return errIngestRateLimited
+		}
+	}
+
+	locs, err := s.dropCloselySpaced(locs)
+	if err != nil {
+		return err
+	}
+	if len(locs) == 0 {
+		return nil
+	}
+
+	// Resent duplicates are skipped, and only new points are published
+	added, err := s.db.InsertNewLocations(locs)
+	if err != nil {
+		return err
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	// Update paths for these locations (ignore errors - locations are already saved)
+	_ = s.db.UpdatePathsForLocations(added)
+	s.publishIngested(added)
+	return nil
+}
+
+// writeIngestError writes an error from storeIngested
+func writeIngestError(w http.ResponseWriter, err error) {
+	if he, ok := err.(*httpError); ok {
+		http.Error(w, he.msg, he.code)
+		return
+	}
+	http.Error(w, "database error", http.StatusInternalServerError)
+}
+
+// dropCloselySpaced removes points within both ingest.min_spacing_m and ingest.min_spacing_s
+// of the same device's previous point, such as the near-duplicates a buffering client resends
+// when it reconnects. Each point is compared to the previous point kept, from this batch or
+// already stored. Returns locs unchanged when spacing is not configured.
+func (s *Server) dropCloselySpaced(locs []Location) ([]Location, error) {
+	minMeters, minSeconds, ok := s.config.MinSpacing()
+	if !ok {
+		return locs, nil
+	}
+
+	type deviceKey struct{ userID, deviceID string }
+	prev := make(map[deviceKey]*Location)
+	kept := make([]Location, 0, len(locs))
+	for _, loc := range locs {
+		key := deviceKey{loc.UserID, loc.DeviceID}
+		last, seen := prev[key]
+		if !seen {
+			stored, err := s.db.PreviousDeviceLocation(loc.UserID, loc.DeviceID, loc.Timestamp)
+			if err != nil {
+				return nil, err
+			}
+			last = stored
+			prev[key] = last
+		}
+
+		if last != nil {
+			elapsed := loc.Timestamp - last.Timestamp
+			if elapsed < 0 {
+				elapsed = -elapsed
+			}
+			if elapsed <= minSeconds && DistanceMeters(last.Lat, last.Lon, loc.Lat, loc.Lon) <= minMeters {
+				continue
+			}
+		}
+
+		kept = append(kept, loc)
+		prev[key] = &loc
+	}
+
+	if dropped := len(locs) - len(kept); dropped > 0 {
+		log.Printf("ingest: dropped %d points within the minimum spacing", dropped)
+	}
+	return kept, nil
 }
 
 // OwnTracks JSON format
@@ -23,66 +145,184 @@ type OwnTracksPayload struct {
 	Type      string  `json:"_type"`
 	Lat       float64 `json:"lat"`
 	Lon       float64 `json:"lon"`
-	Timestamp int64   `json:"tst"`
+	Timestamp int64   `json:"tst"`                  // When the fix was taken
+	CreatedAt int64   `json:"created_at,omitempty"` // When the message was sent; later than tst for buffered points
 	TrackerID string  `json:"tid"`
+	Topic     string  `json:"topic,omitempty"` // Set by the recorder: "owntracks/<user>/<device>"
 	// Extended fields
 	Accuracy *float64 `json:"acc,omitempty"` // meters
 	Altitude *float64 `json:"alt,omitempty"` // meters
 	Velocity *float64 `json:"vel,omitempty"` // km/h
+	// Transition fields
+	Event string `json:"event,omitempty"` // "enter" or "leave"
+	Desc  string `json:"desc,omitempty"`  // Region description
+}
+
+// FixTimestamp returns when the point was recorded: tst, falling back to created_at
+// for messages that omit it. created_at alone would date resent buffered points to
+// when connectivity returned.
+func (p OwnTracksPayload) FixTimestamp() int64 {
+	if p.Timestamp == 0 {
+		return p.CreatedAt
+	}
+	return p.Timestamp
 }
 
 // POST /owntracks - OwnTracks compatible endpoint
+// Accepts a single message or, as the OwnTracks recorder sends, an array of them.
+// Only location and transition messages are stored; waypoints, cmd, etc. are ignored.
 func (s *Server) handleOwnTracks(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var payload OwnTracksPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	messages, isArray, err := decodeOwnTracks(r.Body)
+	if err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	// Ignore non-location messages
-	if payload.Type != "location" {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]any{})
-		return
+	headerUserID := r.Header.Get("X-Limit-U")
+	if headerUserID == "" {
+		headerUserID = s.defaultUserID
 	}
 
-	userID := r.Header.Get("X-Limit-U")
-	if userID == "" {
-		userID = s.defaultUserID
-	}
+	var locations []Location
+	var transitions []GeofenceEvent
+	for _, payload := range messages {
+		userID, deviceID := s.ownTracksIdentity(headerUserID, payload)
+		userID = ingestUserID(r, userID)
 
-	loc := Location{
-		Timestamp: payload.Timestamp,
-		UserID:    userID,
-		DeviceID:  payload.TrackerID,
-		Lat:       payload.Lat,
-		Lon:       payload.Lon,
-		AccuracyM: payload.Accuracy,
-		AltitudeM: payload.Altitude,
-		SpeedKmh:  payload.Velocity,
-	}
+		switch payload.Type {
+		case "location", "transition":
+		case "waypoints":
+			log.Printf("owntracks: ignoring waypoints list from user %q device %q", userID, deviceID)
+			continue
+		default:
+			continue
+		}
 
-	// Set source to "owntracks" for OwnTracks submissions
-	src := "owntracks"
-	loc.Source = &src
+		var err *httpError
+		if coordErr := validateCoords(payload.Lat, payload.Lon); coordErr != nil {
+			err = &httpError{code: http.StatusBadRequest, msg: coordErr.Error()}
+		} else if payload.Type == "transition" {
+			var event GeofenceEvent
+			if event, err = ownTracksTransitionEvent(userID, deviceID, payload); err == nil {
+				transitions = append(transitions, event)
+			}
+		}
+		if err != nil {
+			if !isArray {
+				http.Error(w, err.msg, err.code)
+				return
+			}
+			// One bad message shouldn't make the recorder resend the whole batch
+			log.Printf("owntracks: skipping message from user %q device %q: %v", userID, deviceID, err)
+			continue
+		}
 
-	if err := s.db.InsertLocation(loc); err != nil {
-		http.Error(w, "database error", http.StatusInternalServerError)
+		if payload.Type == "location" {
+			src := "owntracks"
+			locations = append(locations, Location{
+				Timestamp: payload.FixTimestamp(),
+				UserID:    userID,
+				DeviceID:  deviceID,
+				Lat:       payload.Lat,
+				Lon:       payload.Lon,
+				AccuracyM: payload.Accuracy,
+				AltitudeM: payload.Altitude,
+				SpeedKmh:  payload.Velocity,
+				Source:    &src,
+			})
+		}
+	}
+
+	if err := s.storeIngested(locations); err != nil {
+		writeIngestError(w, err)
 		return
 	}
 
-	// Update paths for this location (ignore errors - location is already saved)
-	_ = s.db.UpdatePathsForLocations([]Location{loc})
+	// Transitions are recorded only once the batch is accepted, so a rate limited client
+	// resending it doesn't notify webhooks twice
+	for _, event := range transitions {
+		if err := s.db.InsertGeofenceEvent(event); err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		s.webhooks.SendGeofenceEvent(event)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{})
 }
 
+// decodeOwnTracks decodes a single OwnTracks message or an array of them,
+// reporting whether the body was an array
+func decodeOwnTracks(body io.Reader) ([]OwnTracksPayload, bool, error) {
+	// Peek past leading whitespace to tell an array from an object
+	br := bufio.NewReader(body)
+	var first byte
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, false, err
+		}
+		if first = b[0]; !unicode.IsSpace(rune(first)) {
+			break
+		}
+		br.Discard(1)
+	}
+
+	dec := json.NewDecoder(br)
+	if first == '[' {
+		var messages []OwnTracksPayload
+		if err := dec.Decode(&messages); err != nil {
+			return nil, true, err
+		}
+		return messages, true, nil
+	}
+
+	var payload OwnTracksPayload
+	if err := dec.Decode(&payload); err != nil {
+		return nil, false, err
+	}
+	return []OwnTracksPayload{payload}, false, nil
+}
+
+// ownTracksIdentity returns the user and device for a message. A recorder-style topic
+// ("owntracks/<user>/<device>[/...]") names both; otherwise the user comes from the
+// X-Limit-U header (or default) and the device from the tracker ID or configured default.
+func (s *Server) ownTracksIdentity(headerUserID string, payload OwnTracksPayload) (userID, deviceID string) {
+	userID = headerUserID
+	if parts := strings.Split(payload.Topic, "/"); len(parts) >= 3 && parts[1] != "" && parts[2] != "" {
+		return parts[1], parts[2]
+	}
+	if payload.TrackerID != "" {
+		return userID, payload.TrackerID
+	}
+	return userID, s.config.DefaultDeviceID("owntracks")
+}
+
+// ownTracksTransitionEvent converts an OwnTracks region enter/leave message to a geofence event,
+// or returns the error response for an invalid one
+func ownTracksTransitionEvent(userID, deviceID string, payload OwnTracksPayload) (GeofenceEvent, *httpError) {
+	if payload.Event != "enter" && payload.Event != "leave" {
+		return GeofenceEvent{}, &httpError{code: http.StatusBadRequest, msg: "invalid transition event"}
+	}
+
+	return GeofenceEvent{
+		Timestamp: payload.FixTimestamp(),
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Region:    payload.Desc,
+		Event:     payload.Event,
+		Lat:       payload.Lat,
+		Lon:       payload.Lon,
+		Source:    "owntracks",
+	}, nil
+}
+
 // GET /gpslogger - GPSLogger compatible endpoint
 func (s *Server) handleGPSLogger(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -106,45 +346,300 @@ func (s *Server) handleGPSLogger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var timestamp int64
-	if timeStr != "" {
-		// Try parsing as Unix timestamp first
-		if ts, err := strconv.ParseInt(timeStr, 10, 64); err == nil {
-			timestamp = ts
-		} else {
-			// Try ISO 8601 format
-			if t, err := time.Parse(time.RFC3339, timeStr); err == nil {
-				timestamp = t.Unix()
-			} else {
-				timestamp = time.Now().Unix()
-			}
-		}
-	} else {
-		timestamp = time.Now().Unix()
+	if err := validateCoords(lat, lon); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Each GPSLogger instance can name itself with ?device= so phones stay distinguishable
+	deviceID := r.URL.Query().Get("device")
+	if deviceID == "" {
+		deviceID = s.config.DefaultDeviceID("gpslogger")
 	}
 
 	src := "gpslogger"
 	loc := Location{
-		Timestamp: timestamp,
-		UserID:    s.defaultUserID,
-		DeviceID:  "gpslogger",
+		Timestamp: parseTrackerTimestamp(timeStr),
+		UserID:    ingestUserID(r, s.defaultUserID),
+		DeviceID:  deviceID,
 		Lat:       lat,
 		Lon:       lon,
 		Source:    &src,
 	}
 
-	if err := s.db.InsertLocation(loc); err != nil {
-		http.Error(w, "database error", http.StatusInternalServerError)
+	if err := s.storeIngested([]Location{loc}); err != nil {
+		writeIngestError(w, err)
 		return
 	}
 
-	// Update paths for this location (ignore errors - location is already saved)
-	_ = s.db.UpdatePathsForLocations([]Location{loc})
-
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
+// parseTrackerTimestamp parses a Unix seconds or ISO 8601 timestamp from a tracker,
+// falling back to the current time when missing or unparseable
+func parseTrackerTimestamp(timeStr string) int64 {
+	if timeStr == "" {
+		return time.Now().Unix()
+	}
+	// Try parsing as Unix timestamp first
+	if ts, err := strconv.ParseInt(timeStr, 10, 64); err == nil {
+		return ts
+	}
+	// Try ISO 8601 format
+	if t, err := time.Parse(time.RFC3339, timeStr); err == nil {
+		return t.Unix()
+	}
+	return time.Now().Unix()
+}
+
+// parseOptionalFloat parses a float form value, returning nil when missing or invalid
+func parseOptionalFloat(s string) *float64 {
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// GET/POST /traccar - Traccar client (OsmAnd protocol) compatible endpoint
+func (s *Server) handleTraccar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// FormValue reads both query params and POST form bodies
+	deviceID := r.FormValue("id")
+	if deviceID == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil {
+		http.Error(w, "invalid lat", http.StatusBadRequest)
+		return
+	}
+
+	lon, err := strconv.ParseFloat(r.FormValue("lon"), 64)
+	if err != nil {
+		http.Error(w, "invalid lon", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateCoords(lat, lon); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	src := "traccar"
+	loc := Location{
+		Timestamp: parseTrackerTimestamp(r.FormValue("timestamp")),
+		UserID:    ingestUserID(r, s.defaultUserID),
+		DeviceID:  deviceID,
+		Lat:       lat,
+		Lon:       lon,
+		AltitudeM: parseOptionalFloat(r.FormValue("altitude")),
+		AccuracyM: parseOptionalFloat(r.FormValue("accuracy")), // hdop is unitless, so it isn't used
+		Source:    &src,
+	}
+
+	// Speed is reported in knots
+	if speed := parseOptionalFloat(r.FormValue("speed")); speed != nil {
+		kmh := *speed * 1.852
+		loc.SpeedKmh = &kmh
+	}
+
+	if err := s.storeIngested([]Location{loc}); err != nil {
+		writeIngestError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// OverlandPayload is the batch body posted by the Overland iOS app
+type OverlandPayload struct {
+	Locations []OverlandFeature `json:"locations"`
+}
+
+// OverlandFeature is a single GeoJSON point feature from Overland
+type OverlandFeature struct {
+	Geometry struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"` // [lon, lat]
+	} `json:"geometry"`
+	Properties struct {
+		Timestamp          string   `json:"timestamp"` // ISO 8601
+		Speed              *float64 `json:"speed"`     // m/s, -1 if unknown
+		Altitude           *float64 `json:"altitude"`  // meters
+		HorizontalAccuracy *float64 `json:"horizontal_accuracy"`
+		DeviceID           string   `json:"device_id"`
+	} `json:"properties"`
+}
+
+// POST /overland - Overland iOS app compatible endpoint
+func (s *Server) handleOverland(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if token := s.config.OverlandToken(); token != "" {
+		provided := r.Header.Get("X-Overland-Token")
+		if provided == "" {
+			provided = r.URL.Query().Get("token")
+		}
+		if provided != token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var payload OverlandPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	userID := ingestUserID(r, s.defaultUserID)
+	locations := make([]Location, 0, len(payload.Locations))
+	invalid := 0
+	for _, f := range payload.Locations {
+		// Skip non-point features and malformed coordinates
+		if f.Geometry.Type != "" && f.Geometry.Type != "Point" {
+			continue
+		}
+		if len(f.Geometry.Coordinates) < 2 {
+			continue
+		}
+		if err := validateCoords(f.Geometry.Coordinates[1], f.Geometry.Coordinates[0]); err != nil {
+			invalid++
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, f.Properties.Timestamp)
+		if err != nil {
+			continue
+		}
+
+		deviceID := f.Properties.DeviceID
+		if deviceID == "" {
+			deviceID = s.config.DefaultDeviceID("overland")
+		}
+
+		src := "overland"
+		loc := Location{
+			Timestamp: t.Unix(),
+			UserID:    userID,
+			DeviceID:  deviceID,
+			Lat:       f.Geometry.Coordinates[1],
+			Lon:       f.Geometry.Coordinates[0],
+			AltitudeM: f.Properties.Altitude,
+			Source:    &src,
+		}
+
+		// Overland reports -1 for unknown speed/accuracy
+		if f.Properties.Speed != nil && *f.Properties.Speed >= 0 {
+			// Convert m/s to km/h
+			speed := *f.Properties.Speed * 3.6
+			loc.SpeedKmh = &speed
+		}
+		if f.Properties.HorizontalAccuracy != nil && *f.Properties.HorizontalAccuracy >= 0 {
+			loc.AccuracyM = f.Properties.HorizontalAccuracy
+		}
+
+		locations = append(locations, loc)
+	}
+	if invalid > 0 {
+		// Still acknowledge the batch, or Overland would resend the bad points forever
+		log.Printf("overland: skipped %d points with out-of-range coordinates from user %q", invalid, userID)
+	}
+
+	if err := s.storeIngested(locations); err != nil {
+		writeIngestError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+}
+
+// HomeAssistantPayload is the location body posted by a Home Assistant webhook
+type HomeAssistantPayload struct {
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	GPSAccuracy *float64 `json:"gps_accuracy,omitempty"` // meters
+	Altitude    *float64 `json:"altitude,omitempty"`     // meters
+	Speed       *float64 `json:"speed,omitempty"`        // m/s
+	Battery     *float64 `json:"battery,omitempty"`      // percent (accepted but not stored)
+	DeviceID    string   `json:"device_id,omitempty"`
+}
+
+// POST /homeassistant - Home Assistant webhook device tracker endpoint
+func (s *Server) handleHomeAssistant(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload HomeAssistantPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Latitude == nil || payload.Longitude == nil {
+		http.Error(w, "latitude and longitude required", http.StatusBadRequest)
+		return
+	}
+	if err := validateCoords(*payload.Latitude, *payload.Longitude); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Device name comes from the configured header, then the body, then a default
+	var deviceID string
+	if header := s.config.HomeAssistantDeviceHeader(); header != "" {
+		deviceID = r.Header.Get(header)
+	}
+	if deviceID == "" {
+		deviceID = payload.DeviceID
+	}
+	if deviceID == "" {
+		deviceID = s.config.DefaultDeviceID("homeassistant")
+	}
+
+	src := "homeassistant"
+	loc := Location{
+		Timestamp: time.Now().Unix(),
+		UserID:    ingestUserID(r, s.defaultUserID),
+		DeviceID:  deviceID,
+		Lat:       *payload.Latitude,
+		Lon:       *payload.Longitude,
+		AccuracyM: payload.GPSAccuracy,
+		AltitudeM: payload.Altitude,
+		Source:    &src,
+	}
+	if payload.Speed != nil && *payload.Speed >= 0 {
+		// Convert m/s to km/h
+		speed := *payload.Speed * 3.6
+		loc.SpeedKmh = &speed
+	}
+
+	if err := s.storeIngested([]Location{loc}); err != nil {
+		writeIngestError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{})
+}
+
 // PathsResponse is the API response for /api/paths
 type PathsResponse struct {
 	Paths   []Path        `json:"paths"`
@@ -189,67 +684,167 @@ type httpError struct {
 
 func (e *httpError) Error() string { return e.msg }
 
-// GET /api/paths - Returns pre-computed paths intersecting the bounding box
-func (s *Server) handleAPIPaths(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	bboxStr := r.URL.Query().Get("bbox")
-	if bboxStr == "" {
-		http.Error(w, "bbox required", http.StatusBadRequest)
-		return
+// notModified sets the ETag header and, if the request's If-None-Match already matches it,
+// writes 304 Not Modified and returns true. Headers like Cache-Control must be set before calling.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	// If-None-Match uses weak comparison: a W/ prefix doesn't matter
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
 	}
+	return false
+}
 
-	bbox, err := parseBBox(bboxStr)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// queryUserID returns the user from the "user" query param, defaulting to the server's default user
+func (s *Server) queryUserID(r *http.Request) string {
+	if userID := r.URL.Query().Get("user"); userID != "" {
+		return userID
 	}
+	return s.defaultUserID
+}
 
-	var start, end *int64
-	if startStr := r.URL.Query().Get("start"); startStr != "" {
+// parseOptionalTimeRange parses optional start/end Unix timestamps, ignoring invalid values
+func parseOptionalTimeRange(q url.Values) (start, end *int64) {
+	if startStr := q.Get("start"); startStr != "" {
 		if v, err := strconv.ParseInt(startStr, 10, 64); err == nil {
 			start = &v
 		}
 	}
-	if endStr := r.URL.Query().Get("end"); endStr != "" {
+	if endStr := q.Get("end"); endStr != "" {
 		if v, err := strconv.ParseInt(endStr, 10, 64); err == nil {
 			end = &v
 		}
 	}
+	return start, end
+}
 
-	// Parse simplification options
+// parseStrictTimeRange parses optional start/end Unix timestamps, rejecting invalid values
+func parseStrictTimeRange(q url.Values) (start, end *int64, err error) {
+	if startStr := q.Get("start"); startStr != "" {
+		v, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil {
+			return nil, nil, &httpError{code: http.StatusBadRequest, msg: "invalid start timestamp"}
+		}
+		start = &v
+	}
+	if endStr := q.Get("end"); endStr != "" {
+		v, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return nil, nil, &httpError{code: http.StatusBadRequest, msg: "invalid end timestamp"}
+		}
+		end = &v
+	}
+	return start, end, nil
+}
+
+// parseHourRange parses the hour_start/hour_end local hour-of-day params (0-24, end exclusive).
+// Returns nil if either is missing or invalid, or if they are equal.
+func parseHourRange(q url.Values) *HourRange {
+	start, err1 := strconv.Atoi(q.Get("hour_start"))
+	end, err2 := strconv.Atoi(q.Get("hour_end"))
+	if err1 != nil || err2 != nil || start < 0 || start > 24 || end < 0 || end > 24 || start == end {
+		return nil
+	}
+	return &HourRange{Start: start % 24, End: end}
+}
+
+// parseSimplifyOptions parses the algo/lod/acc/maxspeed/prune/spikes/order/maxgap/source/hour_start/hour_end simplification query params
+func parseSimplifyOptions(q url.Values) SimplifyOptions {
 	opts := SimplifyOptions{
-		Order: []string{"stationary", "spikes"}, // Default order
+		Order: []string{"accuracy", "speed", "stationary", "spikes"}, // Default order
 	}
 
-	if pruneStr := r.URL.Query().Get("prune"); pruneStr != "" {
+	if algo := q.Get("algo"); algo == "dp" || algo == "vw" {
+		opts.Algorithm = algo
+	}
+
+	if lod := q.Get("lod"); lod == LODDay || lod == LODMonth {
+		opts.LOD = lod
+	}
+
+	if sourceStr := q.Get("source"); sourceStr != "" {
+		opts.Sources = strings.Split(sourceStr, ",")
+	}
+
+	opts.Hours = parseHourRange(q)
+
+	if gapStr := q.Get("maxgap"); gapStr != "" {
+		if v, err := strconv.ParseInt(gapStr, 10, 64); err == nil && v >= 0 {
+			opts.MaxGapSeconds = v
+		}
+	}
+
+	if accStr := q.Get("acc"); accStr != "" {
+		if v, err := strconv.ParseFloat(accStr, 64); err == nil && v >= 0 {
+			opts.MaxAccuracyM = v
+		}
+	}
+
+	if speedStr := q.Get("maxspeed"); speedStr != "" {
+		if v, err := strconv.ParseFloat(speedStr, 64); err == nil && v >= 0 {
+			opts.MaxSpeedKmh = v
+		}
+	}
+
+	if pruneStr := q.Get("prune"); pruneStr != "" {
 		if v, err := strconv.ParseFloat(pruneStr, 64); err == nil && v >= 0 {
 			opts.PruneMeters = v
 		}
 	}
 
-	if spikeStr := r.URL.Query().Get("spikes"); spikeStr != "" {
+	if spikeStr := q.Get("spikes"); spikeStr != "" {
 		if v, err := strconv.ParseFloat(spikeStr, 64); err == nil && v >= 0 {
 			opts.SpikeMeters = v
 		}
 	}
 
-	if orderStr := r.URL.Query().Get("order"); orderStr != "" {
+	if orderStr := q.Get("order"); orderStr != "" {
 		opts.Order = strings.Split(orderStr, ",")
 	}
 
-	result, err := s.db.QueryPathsWithPoints(bbox, start, end, opts)
+	return opts
+}
+
+// GET /api/paths - Returns pre-computed paths intersecting the bounding box
+func (s *Server) handleAPIPaths(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bboxStr := r.URL.Query().Get("bbox")
+	if bboxStr == "" {
+		http.Error(w, "bbox required", http.StatusBadRequest)
+		return
+	}
+
+	bbox, err := parseBBox(bboxStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start, end := parseOptionalTimeRange(r.URL.Query())
+	opts := parseSimplifyOptions(r.URL.Query())
+	userID := s.queryUserID(r)
+
+	result, err := s.db.QueryPathsWithPoints(userID, bbox, start, end, opts)
 	if err != nil {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
+	for i := range result.Paths {
+		result.Paths[i].Color = s.config.DeviceColor(result.Paths[i].DeviceID)
+	}
 
 	// Get current location only if it falls within the requested time range
 	var current *PathPoint
-	loc, err := s.db.LatestLocation()
+	loc, err := s.db.LatestLocation(userID)
 	if err == nil && loc != nil {
 		inRange := true
 		if start != nil && loc.Timestamp < *start {
@@ -281,13 +876,107 @@ func (s *Server) handleAPIPaths(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// PathPointsResponse is a single path with its full-resolution points
+type PathPointsResponse struct {
+	Path    Path           `json:"path"`
+	Removed *RemovedPoints `json:"removed,omitempty"` // Set unless simplify=false
+}
+
+// GET /api/paths/{id}/points - Returns one path's stored points for a detail view
+// simplify=false returns every stored point; otherwise the acc/maxspeed/prune/spikes
+// filters apply as for /api/paths, but there is no viewport simplification.
+func (s *Server) handleAPIPathPoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/paths/"), "/points")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	pathID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || pathID <= 0 {
+		http.Error(w, "invalid path id", http.StatusBadRequest)
+		return
+	}
+
+	path, err := s.db.GetPath(pathID)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	userID := s.queryUserID(r)
+	if path == nil || (userID != "" && path.UserID != userID) {
+		http.Error(w, "path not found", http.StatusNotFound)
+		return
+	}
+
+	points, err := s.db.GetPathPoints(pathID)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	path.Color = s.config.DeviceColor(path.DeviceID)
+	resp := PathPointsResponse{Path: *path}
+	if r.URL.Query().Get("simplify") != "false" {
+		var removed RemovedPoints
+		points = applySimplifyStages(points, parseSimplifyOptions(r.URL.Query()), &removed)
+		resp.Removed = &removed
+	}
+	if points == nil {
+		points = []PathPoint{}
+	}
+	resp.Path.Points = points
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// PathRebuildResponse is the API response for a single-day /api/paths/rebuild
+type PathRebuildResponse struct {
+	UserID     string `json:"user_id"`
+	Date       string `json:"date"`
+	PointCount int    `json:"point_count"` // 0 if the day has no locations and its path was removed
+}
+
 // POST /api/paths/rebuild - Rebuilds all paths from scratch
+// With ?date=YYYY-MM-DD only that day's path is rebuilt for ?user= (or the default user).
+// A day retention pruned locations from can't be recomputed, so its path is left as is (409).
 func (s *Server) handleAPIPathsRebuild(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if date := r.URL.Query().Get("date"); date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			http.Error(w, "invalid date (expected YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		userID := s.queryUserID(r)
+		if userID == "" {
+			http.Error(w, "user required", http.StatusBadRequest)
+			return
+		}
+
+		count, err := s.db.RebuildPathForDate(userID, date)
+		if errors.Is(err, ErrPathRetained) {
+			http.Error(w, "path kept after retention pruned its locations; it can't be rebuilt", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "rebuild failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PathRebuildResponse{UserID: userID, Date: date, PointCount: count})
+		return
+	}
+
 	if err := s.db.RebuildAllPaths(); err != nil {
 		http.Error(w, "rebuild failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -311,50 +1000,153 @@ func (s *Server) handleAPIBounds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	start, err := strconv.ParseInt(startStr, 10, 64)
-	if err != nil {
-		http.Error(w, "invalid start timestamp", http.StatusBadRequest)
-		return
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid start timestamp", http.StatusBadRequest)
+		return
+	}
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid end timestamp", http.StatusBadRequest)
+		return
+	}
+
+	bounds, err := s.db.GetBoundsForTimestampRange(s.queryUserID(r), start, end)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if bounds == nil {
+		w.Write([]byte("null"))
+		return
+	}
+	json.NewEncoder(w).Encode(bounds)
+}
+
+// GET /api/bounds/all - Returns the bounding box of all locations, or null if there are none
+// ?days=N limits it to the N days up to the latest location.
+func (s *Server) handleAPIBoundsAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := 0
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	bounds, err := s.db.GetOverallBounds(s.queryUserID(r), days)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if bounds == nil {
+		w.Write([]byte("null"))
+		return
+	}
+	json.NewEncoder(w).Encode(bounds)
+}
+
+// LatestResponse is the most recent location with how old it is
+type LatestResponse struct {
+	Location
+	AgeSeconds int64          `json:"age_seconds"`
+	Place      *GeocodedPlace `json:"place,omitempty"` // Only with geocode=true
+}
+
+// GET /api/latest - Returns the most recent location and its age
+// geocode=true also attaches the reverse-geocoded place (cached, rate limited).
+func (s *Server) handleAPILatest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loc, err := s.db.LatestLocation(s.queryUserID(r))
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if loc == nil {
+		w.Write([]byte("null"))
+		return
+	}
+
+	resp := LatestResponse{
+		Location:   *loc,
+		AgeSeconds: max(time.Now().Unix()-loc.Timestamp, 0),
+	}
+
+	// A failed lookup just leaves the place out; the location is still useful
+	if r.URL.Query().Get("geocode") == "true" && s.geocoder != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		place, err := s.geocoder.ReverseGeocode(ctx, loc.Lat, loc.Lon)
+		if err != nil {
+			fmt.Printf("warning: failed to geocode latest location: %v\n", err)
+		}
+		resp.Place = place
 	}
-	end, err := strconv.ParseInt(endStr, 10, 64)
-	if err != nil {
-		http.Error(w, "invalid end timestamp", http.StatusBadRequest)
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GET /api/users - Returns the distinct user IDs with stored locations
+func (s *Server) handleAPIUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	bounds, err := s.db.GetBoundsForTimestampRange(start, end)
+	users, err := s.db.ListUsers()
 	if err != nil {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if bounds == nil {
-		w.Write([]byte("null"))
-		return
-	}
-	json.NewEncoder(w).Encode(bounds)
+	json.NewEncoder(w).Encode(users)
 }
 
-// GET /api/latest - Returns the most recent location
-func (s *Server) handleAPILatest(w http.ResponseWriter, r *http.Request) {
+// GET /api/devices - Returns per-device point counts, time ranges, and sources
+// Optional ?user= limits the list to one user.
+func (s *Server) handleAPIDevices(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	loc, err := s.db.LatestLocation()
+	devices, err := s.db.ListDevices(r.URL.Query().Get("user"))
 	if err != nil {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if loc == nil {
-		w.Write([]byte("null"))
+	json.NewEncoder(w).Encode(devices)
+}
+
+// GET /api/devices/meta - Returns the configured name and color for each device ID
+func (s *Server) handleAPIDevicesMeta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	json.NewEncoder(w).Encode(loc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.config.DeviceMetas())
 }
 
 // LocationSourceResponse is the API response for /api/location/source
@@ -368,6 +1160,8 @@ type LocationSourceResponse struct {
 }
 
 // GET /api/location/source - Returns source metadata for a location point
+// With ?max_delta=N (seconds), a timestamp with no exact match falls back to the user's
+// nearest location within N seconds.
 func (s *Server) handleAPILocationSource(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -388,6 +1182,15 @@ func (s *Server) handleAPILocationSource(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var maxDelta int64
+	if deltaStr := r.URL.Query().Get("max_delta"); deltaStr != "" {
+		maxDelta, err = strconv.ParseInt(deltaStr, 10, 64)
+		if err != nil || maxDelta < 0 {
+			http.Error(w, "invalid max_delta (seconds)", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var source *LocationSource
 	if deviceID != "" {
 		source, err = s.db.GetLocationSource(timestamp, deviceID)
@@ -399,6 +1202,18 @@ func (s *Server) handleAPILocationSource(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Photo timestamps rarely line up exactly with a clicked point
+	if source == nil && maxDelta > 0 {
+		loc, err := s.db.NearestLocation(s.queryUserID(r), timestamp, maxDelta)
+		if err == nil && loc != nil {
+			source, err = s.db.GetLocationSource(loc.Timestamp, loc.DeviceID)
+		}
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if source == nil {
 		w.Write([]byte("null"))
@@ -424,6 +1239,140 @@ func (s *Server) handleAPILocationSource(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(resp)
 }
 
+// /api/locations - Batch inserts (POST) or deletes (DELETE) raw locations
+func (s *Server) handleAPILocations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handleAPILocationsPost(w, r)
+	case http.MethodDelete:
+		s.handleAPILocationsDelete(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// maxLocationBatchSize caps the number of locations in one POST /api/locations request
+const maxLocationBatchSize = 10000
+
+// maxLocationBatchBytes caps the POST /api/locations body, bounding memory before decoding
+const maxLocationBatchBytes = 16 << 20
+
+// POST /api/locations - Inserts a JSON array of locations in one transaction
+// The whole batch is rejected if any element is invalid.
+func (s *Server) handleAPILocationsPost(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLocationBatchBytes)
+
+	var locations []Location
+	if err := json.NewDecoder(r.Body).Decode(&locations); err != nil {
+		http.Error(w, "invalid json: expected an array of locations", http.StatusBadRequest)
+		return
+	}
+	if len(locations) == 0 {
+		http.Error(w, "no locations", http.StatusBadRequest)
+		return
+	}
+	if len(locations) > maxLocationBatchSize {
+		http.Error(w, fmt.Sprintf("too many locations (max %d)", maxLocationBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	for i := range locations {
+		loc := &locations[i]
+		if loc.Timestamp <= 0 {
+			http.Error(w, fmt.Sprintf("location %d: timestamp must be positive", i), http.StatusBadRequest)
+			return
+		}
+		if err := validateCoords(loc.Lat, loc.Lon); err != nil {
+			http.Error(w, fmt.Sprintf("location %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+
+		// With auth enabled, locations are always attributed to the authenticated user
+		if loc.UserID == "" {
+			loc.UserID = s.defaultUserID
+		}
+		loc.UserID = ingestUserID(r, loc.UserID)
+		if loc.DeviceID == "" {
+			loc.DeviceID = s.config.DefaultDeviceID("api")
+		}
+		if loc.Source == nil {
+			src := "api"
+			loc.Source = &src
+		}
+	}
+
+	added, err := s.db.InsertNewLocations(locations)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Update paths for these locations (ignore errors - locations are already saved)
+	if len(added) > 0 {
+		_ = s.db.UpdatePathsForLocations(added)
+		s.publishIngested(added)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"inserted": len(added), "skipped": len(locations) - len(added)})
+}
+
+// DELETE /api/locations - Removes a single location (timestamp+device_id)
+// or all locations in a bbox and optional start/end time range, for ?user= (or the default user)
+func (s *Server) handleAPILocationsDelete(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	// Scoped like the read endpoints; with auth enabled, only the authenticated user's rows
+	userID := ingestUserID(r, s.queryUserID(r))
+
+	var deleted []Location
+	var err error
+	switch {
+	case q.Get("timestamp") != "":
+		timestamp, parseErr := strconv.ParseInt(q.Get("timestamp"), 10, 64)
+		if parseErr != nil {
+			http.Error(w, "invalid timestamp", http.StatusBadRequest)
+			return
+		}
+		deviceID := q.Get("device_id")
+		if deviceID == "" {
+			http.Error(w, "device_id required", http.StatusBadRequest)
+			return
+		}
+		deleted, err = s.db.DeleteLocation(userID, timestamp, deviceID)
+
+	case q.Get("bbox") != "":
+		bbox, parseErr := parseBBox(q.Get("bbox"))
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		// Unlike read endpoints, reject bad timestamps rather than silently widening the range
+		start, end, parseErr := parseStrictTimeRange(q)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		deleted, err = s.db.DeleteLocationsInBBox(userID, bbox, start, end)
+
+	default:
+		http.Error(w, "timestamp and device_id, or bbox required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Recompute only the affected user+date paths
+	if err := s.db.UpdatePathsForLocations(deleted); err != nil {
+		http.Error(w, "path update failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": len(deleted)})
+}
+
 // PhotoCluster represents a group of nearby photos for the map
 type PhotoCluster struct {
 	Lat          float64 `json:"lat"`
@@ -438,37 +1387,19 @@ type PhotosResponse struct {
 	Clusters []PhotoCluster `json:"clusters"`
 }
 
-// clusterRadiusFromBBox calculates clustering radius based on viewport size
+// clusterRadiusFromBBox calculates a clustering radius in meters based on viewport size
 func clusterRadiusFromBBox(bbox BBox) float64 {
-	latSpan := bbox.NeLat - bbox.SwLat
-	lonSpan := bbox.NeLng - bbox.SwLng
-
-	minSpan := latSpan
-	if lonSpan < minSpan {
-		minSpan = lonSpan
-	}
+	// Measure the viewport on the ground, so high-latitude views (where a degree
+	// of longitude is short) don't get oversized clusters
+	midLat := (bbox.SwLat + bbox.NeLat) / 2
+	latSpan := (bbox.NeLat - bbox.SwLat) * metersPerDegreeLat
+	lonSpan := (bbox.NeLng - bbox.SwLng) * metersPerDegreeLat * math.Cos(midLat*math.Pi/180)
 
 	// Use 2% of viewport as cluster radius
-	radius := minSpan * 0.02
-
-	// Clamp to reasonable bounds
-	// Min: ~50m (0.0005 degrees)
-	// Max: ~10km (0.1 degrees)
-	if radius < 0.0005 {
-		radius = 0.0005
-	}
-	if radius > 0.1 {
-		radius = 0.1
-	}
-
-	return radius
-}
+	radius := min(latSpan, lonSpan) * 0.02
 
-// photoDist calculates approximate distance between two points in degrees
-func photoDist(lat1, lon1, lat2, lon2 float64) float64 {
-	dLat := lat2 - lat1
-	dLon := lon2 - lon1
-	return math.Sqrt(dLat*dLat + dLon*dLon)
+	// Clamp to reasonable bounds: 50m to 10km
+	return min(max(radius, 50), 10000)
 }
 
 // photoClusterData is an internal struct for building clusters
@@ -478,35 +1409,134 @@ type photoClusterData struct {
 	photos []PhotoLocation
 }
 
-// clusterPhotos groups photos by proximity
+// photoGridCell is a cell of an equirectangular grid measured in meters
+type photoGridCell struct{ x, y int }
+
+// photoGridCellOf returns the grid cell of size meters containing lat/lon
+func photoGridCellOf(lat, lon, size float64) photoGridCell {
+	y := lat * metersPerDegreeLat
+	x := lon * metersPerDegreeLat * math.Cos(lat*math.Pi/180)
+	return photoGridCell{int(math.Floor(x / size)), int(math.Floor(y / size))}
+}
+
+// clusterPhotos groups photos into clusters whose centroids are at least radius meters apart.
+// The result doesn't depend on photo order: photos are first bucketed into grid cells small
+// enough that each cell's photos are within radius of each other, then the closest pairs of
+// clusters within radius are merged, round after round, until none are left. Each cluster's
+// photos stay sorted by timestamp.
 func clusterPhotos(photos []PhotoLocation, radius float64) []photoClusterData {
-	var clusters []photoClusterData
+	photos = slices.Clone(photos)
+	sort.SliceStable(photos, func(a, b int) bool {
+		if photos[a].Timestamp != photos[b].Timestamp {
+			return photos[a].Timestamp < photos[b].Timestamp
+		}
+		return photos[a].SourceID < photos[b].SourceID
+	})
 
+	// Seed: cells radius/2 on a side, so any two photos in a cell are within radius
+	cellIndex := make(map[photoGridCell]int)
+	var clusters []photoClusterData
 	for _, photo := range photos {
-		added := false
-		for i := range clusters {
-			if photoDist(clusters[i].lat, clusters[i].lon, photo.Lat, photo.Lon) < radius {
-				// Add to existing cluster and update centroid
-				n := float64(len(clusters[i].photos))
-				clusters[i].lat = (clusters[i].lat*n + photo.Lat) / (n + 1)
-				clusters[i].lon = (clusters[i].lon*n + photo.Lon) / (n + 1)
-				clusters[i].photos = append(clusters[i].photos, photo)
-				added = true
-				break
+		cell := photoGridCellOf(photo.Lat, photo.Lon, radius/2)
+		i, ok := cellIndex[cell]
+		if !ok {
+			i = len(clusters)
+			cellIndex[cell] = i
+			clusters = append(clusters, photoClusterData{})
+		}
+		clusters[i].photos = append(clusters[i].photos, photo)
+	}
+	for i := range clusters {
+		clusters[i].lat, clusters[i].lon = photoCentroid(clusters[i].photos)
+	}
+
+	for {
+		// Find every pair of clusters within radius. Centroids within radius of each
+		// other are in the same or adjacent radius-sized cells.
+		grid := make(map[photoGridCell][]int)
+		for i, c := range clusters {
+			cell := photoGridCellOf(c.lat, c.lon, radius)
+			grid[cell] = append(grid[cell], i)
+		}
+		type clusterPair struct {
+			i, j int
+			dist float64
+		}
+		var pairs []clusterPair
+		for i, c := range clusters {
+			cell := photoGridCellOf(c.lat, c.lon, radius)
+			for dx := -1; dx <= 1; dx++ {
+				for dy := -1; dy <= 1; dy++ {
+					for _, j := range grid[photoGridCell{cell.x + dx, cell.y + dy}] {
+						if j <= i {
+							continue
+						}
+						if d := DistanceMeters(c.lat, c.lon, clusters[j].lat, clusters[j].lon); d < radius {
+							pairs = append(pairs, clusterPair{i, j, d})
+						}
+					}
+				}
 			}
 		}
-		if !added {
-			clusters = append(clusters, photoClusterData{
-				lat:    photo.Lat,
-				lon:    photo.Lon,
-				photos: []PhotoLocation{photo},
-			})
+		if len(pairs) == 0 {
+			break
+		}
+
+		// Merge the closest pairs first; a cluster merges at most once per round, since
+		// its centroid moves
+		sort.Slice(pairs, func(a, b int) bool {
+			if pairs[a].dist != pairs[b].dist {
+				return pairs[a].dist < pairs[b].dist
+			}
+			if pairs[a].i != pairs[b].i {
+				return pairs[a].i < pairs[b].i
+			}
+			return pairs[a].j < pairs[b].j
+		})
+		merged := make([]bool, len(clusters))
+		removed := make([]bool, len(clusters))
+		for _, p := range pairs {
+			if merged[p.i] || merged[p.j] {
+				continue
+			}
+			merged[p.i], merged[p.j], removed[p.j] = true, true, true
+			clusters[p.i].photos = append(clusters[p.i].photos, clusters[p.j].photos...)
+			clusters[p.i].lat, clusters[p.i].lon = photoCentroid(clusters[p.i].photos)
 		}
+		kept := clusters[:0]
+		for i, c := range clusters {
+			if !removed[i] {
+				kept = append(kept, c)
+			}
+		}
+		clusters = kept
 	}
 
+	for _, c := range clusters {
+		sort.SliceStable(c.photos, func(a, b int) bool {
+			return c.photos[a].Timestamp < c.photos[b].Timestamp
+		})
+	}
+	sort.Slice(clusters, func(a, b int) bool {
+		pa, pb := clusters[a].photos[0], clusters[b].photos[0]
+		if pa.Timestamp != pb.Timestamp {
+			return pa.Timestamp < pb.Timestamp
+		}
+		return pa.SourceID < pb.SourceID
+	})
 	return clusters
 }
 
+// photoCentroid returns the mean position of photos
+func photoCentroid(photos []PhotoLocation) (lat, lon float64) {
+	for _, p := range photos {
+		lat += p.Lat
+		lon += p.Lon
+	}
+	n := float64(len(photos))
+	return lat / n, lon / n
+}
+
 // buildPopupHTML generates the HTML for the photo grid popup
 func buildPopupHTML(photos []PhotoLocation) string {
 	var popup strings.Builder
@@ -535,30 +1565,248 @@ func buildPopupHTML(photos []PhotoLocation) string {
 
 // POST /api/import/timeline - Import Android Timeline JSON with SSE progress
 func (s *Server) handleImportTimeline(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	file, deviceID, ok := parseImportUpload(w, r, s.config.DefaultDeviceID("google-timeline"))
+	if !ok {
 		return
 	}
 
-	// Parse multipart form (max 500MB)
-	if err := r.ParseMultipartForm(500 << 20); err != nil {
-		http.Error(w, "failed to parse form: "+err.Error(), http.StatusBadRequest)
+	userID := s.defaultUserID
+	if dryRunRequested(r) {
+		defer file.Close()
+		s.writeImportDryRun(w, func(emit func(Location) error, onErr func(error)) (int, error) {
+			return StreamTimeline(file, userID, deviceID, emit, onErr)
+		})
+		return
+	}
+
+	sendProgress, ok := startImportSSE(w)
+	if !ok {
+		file.Close()
 		return
 	}
 
-	file, _, err := r.FormFile("file")
+	// The file is decoded as it is inserted, so the job owns it from here. A spilled
+	// upload's temp file is unlinked when this handler returns, but stays readable
+	// through the open handle until the job closes it.
+	jobID, err := s.fileImports.StartStream("google-timeline", userID, deviceID, file, func(emit func(Location) error, onErr func(error)) (int, error) {
+		return StreamTimeline(file, userID, deviceID, emit, onErr)
+	})
 	if err != nil {
-		http.Error(w, "no file uploaded", http.StatusBadRequest)
+		file.Close()
+		sendProgress(TimelineImportProgress{
+			Error:    fmt.Sprintf("Failed to start import: %v", err),
+			Complete: true,
+		})
+		return
+	}
+
+	sendProgress(TimelineImportProgress{
+		JobID:   jobID,
+		Message: "Streaming timeline file...",
+	})
+
+	s.streamFileImport(r.Context(), jobID, sendProgress)
+}
+
+// POST /api/import/kml - Import KML/KMZ tracks with SSE progress
+func (s *Server) handleImportKML(w http.ResponseWriter, r *http.Request) {
+	file, deviceID, ok := parseImportUpload(w, r, s.config.DefaultDeviceID("kml"))
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	if dryRunRequested(r) {
+		locations, parseErrors := ParseKML(file)
+		s.writeImportDryRun(w, parsedStream(locations, parseErrors, s.defaultUserID, deviceID))
+		return
+	}
+
+	sendProgress, ok := startImportSSE(w)
+	if !ok {
+		return
+	}
+
+	sendProgress(TimelineImportProgress{
+		Message: "Parsing KML file...",
+	})
+
+	locations, parseErrors := ParseKML(file)
+	if len(locations) == 0 && len(parseErrors) > 0 {
+		sendProgress(TimelineImportProgress{
+			Stats:    parseErrorStats(parseErrors),
+			Error:    parseErrors[0].Error(),
+			Complete: true,
+		})
+		return
+	}
+
+	for i := range locations {
+		locations[i].UserID = s.defaultUserID
+		locations[i].DeviceID = deviceID
+	}
+
+	stats := parseErrorStats(parseErrors)
+	stats.Total = len(locations) + len(parseErrors)
+	stats.Parsed = len(locations)
+
+	s.importLocations(r.Context(), "kml", deviceID, locations, stats, sendProgress)
+}
+
+// POST /api/import/takeout - Import a Google Takeout Records.json with SSE progress
+func (s *Server) handleImportTakeout(w http.ResponseWriter, r *http.Request) {
+	file, deviceID, ok := parseImportUpload(w, r, s.config.DefaultDeviceID("google-takeout"))
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	if dryRunRequested(r) {
+		locations, parseErrors := ParseTakeoutRecords(file)
+		s.writeImportDryRun(w, parsedStream(locations, parseErrors, s.defaultUserID, deviceID))
+		return
+	}
+
+	sendProgress, ok := startImportSSE(w)
+	if !ok {
+		return
+	}
+
+	sendProgress(TimelineImportProgress{
+		Message: "Parsing Records.json...",
+	})
+
+	locations, parseErrors := ParseTakeoutRecords(file)
+	if len(locations) == 0 && len(parseErrors) > 0 {
+		sendProgress(TimelineImportProgress{
+			Stats:    parseErrorStats(parseErrors),
+			Error:    parseErrors[len(parseErrors)-1].Error(),
+			Complete: true,
+		})
+		return
+	}
+
+	for i := range locations {
+		locations[i].UserID = s.defaultUserID
+		locations[i].DeviceID = deviceID
+	}
+
+	stats := parseErrorStats(parseErrors)
+	stats.Total = len(locations) + len(parseErrors)
+	stats.Parsed = len(locations)
+
+	s.importLocations(r.Context(), "google-takeout", deviceID, locations, stats, sendProgress)
+}
+
+// POST /api/import/owntracks - Import an OwnTracks Recorder .rec file with SSE progress
+func (s *Server) handleImportOwnTracks(w http.ResponseWriter, r *http.Request) {
+	file, deviceID, ok := parseImportUpload(w, r, s.config.DefaultDeviceID("owntracks"))
+	if !ok {
 		return
 	}
 	defer file.Close()
 
+	if dryRunRequested(r) {
+		locations, parseErrors := ParseOwnTracksRec(file)
+		s.writeImportDryRun(w, parsedStream(locations, parseErrors, s.defaultUserID, deviceID))
+		return
+	}
+
+	sendProgress, ok := startImportSSE(w)
+	if !ok {
+		return
+	}
+
+	sendProgress(TimelineImportProgress{
+		Message: "Parsing OwnTracks Recorder file...",
+	})
+
+	locations, parseErrors := ParseOwnTracksRec(file)
+	if len(locations) == 0 && len(parseErrors) > 0 {
+		sendProgress(TimelineImportProgress{
+			Stats:    parseErrorStats(parseErrors),
+			Error:    parseErrors[0].Error(),
+			Complete: true,
+		})
+		return
+	}
+
+	for i := range locations {
+		locations[i].UserID = s.defaultUserID
+		locations[i].DeviceID = deviceID
+	}
+
+	stats := parseErrorStats(parseErrors)
+	stats.Total = len(locations) + len(parseErrors)
+	stats.Parsed = len(locations)
+
+	s.importLocations(r.Context(), "owntracks", deviceID, locations, stats, sendProgress)
+}
+
+// parseImportUpload parses a multipart import upload and returns the file and device ID.
+// A gzipped request body (Content-Encoding: gzip) or a .gz file is decompressed as it is read.
+// Writes an HTTP error and returns false on failure.
+func parseImportUpload(w http.ResponseWriter, r *http.Request, defaultDeviceID string) (io.ReadCloser, string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, "", false
+	}
+
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "invalid gzip body: "+err.Error(), http.StatusBadRequest)
+			return nil, "", false
+		}
+		defer body.Close()
+		r.Body = body
+		r.Header.Del("Content-Encoding")
+	}
+
+	// Uploads beyond 32MB spill to a temp file rather than being held in memory
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "failed to parse form: "+err.Error(), http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "no file uploaded", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	var upload io.ReadCloser = file
+	if strings.HasSuffix(strings.ToLower(header.Filename), ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			http.Error(w, "invalid gzip file: "+err.Error(), http.StatusBadRequest)
+			return nil, "", false
+		}
+		upload = gzipUpload{Reader: zr, file: file}
+	}
+
 	deviceID := r.FormValue("device_id")
 	if deviceID == "" {
-		deviceID = "google-timeline"
+		deviceID = defaultDeviceID
 	}
 
-	// Set up SSE
+	return upload, deviceID, true
+}
+
+// gzipUpload decompresses an uploaded .gz file; closing it closes the file too
+type gzipUpload struct {
+	*gzip.Reader
+	file multipart.File
+}
+
+func (g gzipUpload) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// startImportSSE sets up an SSE response and returns a function that sends import progress
+func startImportSSE(w http.ResponseWriter) (func(TimelineImportProgress), bool) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -566,99 +1814,129 @@ func (s *Server) handleImportTimeline(w http.ResponseWriter, r *http.Request) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "streaming not supported", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
-	sendProgress := func(progress TimelineImportProgress) {
+	return func(progress TimelineImportProgress) {
 		data, _ := json.Marshal(progress)
 		fmt.Fprintf(w, "data: %s\n\n", data)
 		flusher.Flush()
-	}
-
-	// Parse timeline
-	sendProgress(TimelineImportProgress{
-		Message: "Parsing timeline file...",
-	})
+	}, true
+}
 
-	timeline, err := ParseTimeline(file)
+// importLocations starts a background job inserting parsed locations and streams its
+// progress until it finishes or the client disconnects. The job keeps running either way.
+func (s *Server) importLocations(ctx context.Context, source, deviceID string, locations []Location, stats TimelineImportStats, sendProgress func(TimelineImportProgress)) {
+	jobID, err := s.fileImports.Start(source, deviceID, locations, stats)
 	if err != nil {
 		sendProgress(TimelineImportProgress{
-			Error:    err.Error(),
+			Stats:    stats,
+			Error:    fmt.Sprintf("Failed to start import: %v", err),
 			Complete: true,
 		})
 		return
 	}
 
-	// Count positions
-	var posCount int
-	for _, sig := range timeline.RawSignals {
-		if sig.Position != nil {
-			posCount++
-		}
-	}
-
-	sendProgress(TimelineImportProgress{
-		Stats:   TimelineImportStats{Total: posCount},
-		Message: fmt.Sprintf("Found %d positions, extracting...", posCount),
-	})
-
-	// Extract locations
-	locations, parseErrors := ExtractLocations(timeline, s.defaultUserID, deviceID)
-
-	stats := TimelineImportStats{
-		Total:  posCount,
-		Parsed: len(locations),
-		Errors: len(parseErrors),
-	}
-
 	sendProgress(TimelineImportProgress{
+		JobID:   jobID,
 		Stats:   stats,
 		Message: fmt.Sprintf("Parsed %d locations, importing...", len(locations)),
 	})
 
-	// Batch insert in chunks of 1000
-	const batchSize = 1000
+	s.streamFileImport(ctx, jobID, sendProgress)
+}
 
-	for i := 0; i < len(locations); i += batchSize {
-		end := i + batchSize
-		if end > len(locations) {
-			end = len(locations)
-		}
-		batch := locations[i:end]
+// streamFileImport relays a file import job's progress until it completes, ctx is done, or shutdown starts.
+// Jobs not running in this process (finished or interrupted) report their recorded state.
+func (s *Server) streamFileImport(ctx context.Context, jobID string, sendProgress func(TimelineImportProgress)) {
+	ctx, cancel := untilClosing(ctx, s.closing)
+	defer cancel()
 
-		inserted, skipped, err := s.db.InsertLocationBatch(batch)
-		if err != nil {
-			sendProgress(TimelineImportProgress{
-				Stats:    stats,
-				Error:    fmt.Sprintf("Database error at batch %d: %v", i/batchSize, err),
-				Complete: true,
-			})
+	updates, unsubscribe, running := s.fileImports.Subscribe(jobID)
+	if running {
+		defer unsubscribe()
+	}
+
+	progress, err := s.fileImports.Progress(jobID)
+	if err != nil {
+		sendProgress(TimelineImportProgress{Error: err.Error(), Complete: true})
+		return
+	}
+	// Skip the snapshot if the job finished between Subscribe and Progress;
+	// the final update is already queued on the channel
+	if !running || !progress.Complete {
+		sendProgress(*progress)
+	}
+	if !running {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Client disconnected
 			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			sendProgress(update)
+			if update.Complete {
+				return
+			}
 		}
+	}
+}
 
-		stats.Inserted += inserted
-		stats.Skipped += skipped
+// GET /api/import/jobs/{id}/stream - Reattaches to a timeline/KML import job's progress via SSE
+func (s *Server) handleImportJobStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-		sendProgress(TimelineImportProgress{
-			Stats:   stats,
-			Message: fmt.Sprintf("Imported %d/%d locations...", stats.Inserted+stats.Skipped, len(locations)),
-		})
+	path := r.URL.Path
+	if !strings.HasSuffix(path, "/stream") {
+		http.NotFound(w, r)
+		return
 	}
+	jobID := strings.TrimSuffix(strings.TrimPrefix(path, "/api/import/jobs/"), "/stream")
 
-	// Update paths for all parsed locations (UpdatePathsForLocations handles duplicates)
-	if stats.Inserted > 0 {
-		sendProgress(TimelineImportProgress{
-			Stats:   stats,
-			Message: "Updating path index...",
-		})
-		_ = s.db.UpdatePathsForLocations(locations)
+	if _, err := s.fileImports.Progress(jobID); err == ErrJobNotFound {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
 	}
 
-	sendProgress(TimelineImportProgress{
-		Stats:    stats,
-		Message:  fmt.Sprintf("Import complete: %d inserted, %d duplicates skipped", stats.Inserted, stats.Skipped),
-		Complete: true,
-	})
+	sendProgress, ok := startImportSSE(w)
+	if !ok {
+		return
+	}
+	s.streamFileImport(r.Context(), jobID, sendProgress)
+}
+
+// POST /api/import/{id}/cancel - Stops a running timeline/KML/Takeout import at its next batch
+func (s *Server) handleImportCancel(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/import/"), "/cancel")
+	if !ok || jobID == "" || strings.Contains(jobID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.fileImports.Cancel(jobID); err == ErrJobNotFound {
+		http.Error(w, "job not running", http.StatusNotFound)
+		return
+	}
+
+	// The job finishes its current batch and then marks itself cancelled
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "cancelling"})
 }
 
 // GET /api/photos - Returns clustered photos for a time range and bounding box
@@ -700,7 +1978,7 @@ func (s *Server) handleAPIPhotos(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Query photos from database
-	photos, err := s.db.QueryPhotoLocations(start, end)
+	photos, err := s.db.QueryPhotoLocations(s.queryUserID(r), start, end)
 	if err != nil {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
@@ -736,6 +2014,58 @@ func (s *Server) handleAPIPhotos(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// maxHeatmapCellsPerAxis caps grid resolution so a world-level bbox stays small
+const maxHeatmapCellsPerAxis = 200
+
+// heatmapCellFromBBox calculates the heatmap grid cell size (degrees) based on viewport size
+func heatmapCellFromBBox(bbox BBox) float64 {
+	latSpan := bbox.NeLat - bbox.SwLat
+	lonSpan := bbox.NeLng - bbox.SwLng
+
+	// 2% of the smaller viewport span, clamped to ~50m-10km (0.0005-0.1 degrees).
+	// Cells are binned in degrees, so unlike photo clustering this stays in degrees.
+	cell := min(max(min(latSpan, lonSpan)*0.02, 0.0005), 0.1)
+
+	// Grow cells until neither axis exceeds the cap
+	maxSpan := math.Max(latSpan, lonSpan)
+	if minCell := maxSpan / maxHeatmapCellsPerAxis; cell < minCell {
+		cell = minCell
+	}
+
+	return cell
+}
+
+// GET /api/heatmap - Returns raw location counts binned into a viewport-sized grid
+func (s *Server) handleAPIHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bboxStr := r.URL.Query().Get("bbox")
+	if bboxStr == "" {
+		http.Error(w, "bbox required", http.StatusBadRequest)
+		return
+	}
+
+	bbox, err := parseBBox(bboxStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start, end := parseOptionalTimeRange(r.URL.Query())
+
+	cells, err := s.db.QueryHeatmap(s.queryUserID(r), bbox, start, end, parseHourRange(r.URL.Query()), heatmapCellFromBBox(bbox))
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cells)
+}
+
 // TimelineEntry represents a single item in the timeline view
 type TimelineEntry struct {
 	Timestamp      int64           `json:"timestamp"`
@@ -745,33 +2075,158 @@ type TimelineEntry struct {
 	EndLat         *float64        `json:"end_lat,omitempty"` // For travel: destination
 	EndLon         *float64        `json:"end_lon,omitempty"` // For travel: destination
 	PlaceName      string          `json:"place_name,omitempty"`
-	EntryType      string          `json:"type"` // "stop" or "travel"
+	EntryType      string          `json:"type"`           // "stop" or "travel"
+	Mode           string          `json:"mode,omitempty"` // For travel: "walk", "cycle", "drive", "transit", "fly"
 	Duration       *int64          `json:"duration_seconds,omitempty"`
 	DistanceMeters *float64        `json:"distance_meters,omitempty"` // For travel segments
 	Photos         []TimelinePhoto `json:"photos,omitempty"`
+
+	photoPlace string // Place Immich named for a photo at this stop, used before geocoding
 }
 
 // TimelinePhoto represents a photo in the timeline
 type TimelinePhoto struct {
-	SourceID     string `json:"source_id"`
-	ThumbnailURL string `json:"thumbnail_url"`
-	Filename     string `json:"filename,omitempty"`
+	SourceID     string   `json:"source_id"`
+	ThumbnailURL string   `json:"thumbnail_url"`
+	Filename     string   `json:"filename,omitempty"`
+	Lat          *float64 `json:"lat,omitempty"` // For travel: position along the route when taken
+	Lon          *float64 `json:"lon,omitempty"`
+}
+
+// newTimelinePhoto converts a photo location to its timeline form
+func newTimelinePhoto(photo PhotoLocation) TimelinePhoto {
+	return TimelinePhoto{
+		SourceID:     photo.SourceID,
+		ThumbnailURL: fmt.Sprintf("/api/immich/assets/%s/thumbnail", photo.SourceID),
+		Filename:     photo.Filename,
+	}
+}
+
+// interpolateSegment returns the position along a time-ordered segment at ts,
+// interpolating linearly between the points either side of it
+func interpolateSegment(segment []PathPoint, ts int64) (float64, float64) {
+	if ts <= segment[0].Timestamp {
+		return segment[0].Lat, segment[0].Lon
+	}
+	for i := 1; i < len(segment); i++ {
+		next := segment[i]
+		if ts > next.Timestamp {
+			continue
+		}
+		prev := segment[i-1]
+		if next.Timestamp == prev.Timestamp {
+			return next.Lat, next.Lon
+		}
+		f := float64(ts-prev.Timestamp) / float64(next.Timestamp-prev.Timestamp)
+		return prev.Lat + f*(next.Lat-prev.Lat), prev.Lon + f*(next.Lon-prev.Lon)
+	}
+	last := segment[len(segment)-1]
+	return last.Lat, last.Lon
 }
 
 // TimelineResponse is the API response for /api/timeline
 type TimelineResponse struct {
+	Date    string          `json:"date"`
+	Params  TimelineParams  `json:"params"`
+	Entries []TimelineEntry `json:"entries"`
+}
+
+// TimelineRangeResponse is the API response for /api/timeline?start=...&end=...
+type TimelineRangeResponse struct {
+	Start  string         `json:"start"`
+	End    string         `json:"end"`
+	Params TimelineParams `json:"params"`
+	Days   []TimelineDay  `json:"days"` // Only days with data
+}
+
+// TimelineDay is one local day's entries in a range timeline
+type TimelineDay struct {
 	Date    string          `json:"date"`
 	Entries []TimelineEntry `json:"entries"`
 }
 
-// GET /api/timeline - Returns timeline entries for a specific date
+// maxTimelineRangeDays caps how many days one range timeline request may cover
+const maxTimelineRangeDays = 92
+
+// TimelineParams controls stay detection for /api/timeline
+type TimelineParams struct {
+	StayRadiusMeters float64 `json:"stay_radius"` // Stationary clustering threshold
+	MergeDistMeters  float64 `json:"merge_dist"`  // Max distance between clusters to merge (GPS drift)
+	MergeGapSeconds  int64   `json:"merge_gap"`   // Max time gap between clusters to merge
+	MinStopSeconds   int64   `json:"min_stop"`    // Minimum duration for a cluster to count as a stop
+}
+
+// defaultTimelineParams are the stay detection defaults used when no query params are given
+var defaultTimelineParams = TimelineParams{
+	StayRadiusMeters: 50,
+	MergeDistMeters:  500,
+	MergeGapSeconds:  30 * 60, // 30 minutes
+	MinStopSeconds:   10 * 60, // 10 minutes
+}
+
+// parseTimelineParams parses the stay_radius/merge_dist/merge_gap/min_stop query params
+// Missing values use the defaults; out-of-range values are clamped to sane bounds.
+func parseTimelineParams(q url.Values) (TimelineParams, error) {
+	params := defaultTimelineParams
+
+	if v := q.Get("stay_radius"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return params, &httpError{code: http.StatusBadRequest, msg: "invalid stay_radius (meters)"}
+		}
+		params.StayRadiusMeters = math.Min(math.Max(f, 5), 1000)
+	}
+
+	if v := q.Get("merge_dist"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return params, &httpError{code: http.StatusBadRequest, msg: "invalid merge_dist (meters)"}
+		}
+		params.MergeDistMeters = math.Min(math.Max(f, 0), 5000)
+	}
+
+	if v := q.Get("merge_gap"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return params, &httpError{code: http.StatusBadRequest, msg: "invalid merge_gap (seconds)"}
+		}
+		params.MergeGapSeconds = min(max(n, 0), 6*60*60)
+	}
+
+	if v := q.Get("min_stop"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return params, &httpError{code: http.StatusBadRequest, msg: "invalid min_stop (seconds)"}
+		}
+		params.MinStopSeconds = min(max(n, 60), 12*60*60)
+	}
+
+	return params, nil
+}
+
+// GET /api/timeline - Returns timeline entries for a specific date (?date=YYYY-MM-DD)
+// or for each day of a range (?start=YYYY-MM-DD&end=YYYY-MM-DD, inclusive)
 func (s *Server) handleAPITimeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	dateStr := r.URL.Query().Get("date")
+	q := r.URL.Query()
+	params, err := parseTimelineParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	userID := s.queryUserID(r)
+
+	dateStr := q.Get("date")
+	if dateStr == "" && (q.Get("start") != "" || q.Get("end") != "") {
+		s.handleAPITimelineRange(ctx, w, q, userID, params)
+		return
+	}
 	if dateStr == "" {
 		http.Error(w, "date parameter required (YYYY-MM-DD)", http.StatusBadRequest)
 		return
@@ -783,25 +2238,80 @@ func (s *Server) handleAPITimeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-
-	// Get locations for the date
-	locations, err := s.db.QueryLocationsByUserDate(s.defaultUserID, dateStr)
+	entries, err := s.timelineDayEntries(userID, dateStr, params)
 	if err != nil {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
+	s.nameTimelineStops(ctx, userID, [][]TimelineEntry{entries})
 
-	if len(locations) == 0 {
-		// No data for this date
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(TimelineResponse{
-			Date:    dateStr,
-			Entries: []TimelineEntry{},
-		})
+	if entries == nil {
+		entries = []TimelineEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TimelineResponse{
+		Date:    dateStr,
+		Params:  params,
+		Entries: entries,
+	})
+}
+
+// handleAPITimelineRange serves /api/timeline?start=...&end=..., building each local day's
+// entries separately and naming every stop in the range in one batch
+func (s *Server) handleAPITimelineRange(ctx context.Context, w http.ResponseWriter, q url.Values, userID string, params TimelineParams) {
+	startStr, endStr := q.Get("start"), q.Get("end")
+	start, err1 := time.Parse("2006-01-02", startStr)
+	end, err2 := time.Parse("2006-01-02", endStr)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "start and end required (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) {
+		http.Error(w, "end must not be before start", http.StatusBadRequest)
+		return
+	}
+	if end.Sub(start) >= maxTimelineRangeDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("range too long (max %d days)", maxTimelineRangeDays), http.StatusBadRequest)
 		return
 	}
 
+	days := []TimelineDay{}
+	var dayEntries [][]TimelineEntry
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		entries, err := s.timelineDayEntries(userID, date, params)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		days = append(days, TimelineDay{Date: date, Entries: entries})
+		dayEntries = append(dayEntries, entries)
+	}
+	s.nameTimelineStops(ctx, userID, dayEntries)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TimelineRangeResponse{
+		Start:  startStr,
+		End:    endStr,
+		Params: params,
+		Days:   days,
+	})
+}
+
+// timelineDayEntries builds the stop and travel entries for one local day. Places are unnamed.
+func (s *Server) timelineDayEntries(userID, dateStr string, params TimelineParams) ([]TimelineEntry, error) {
+	// Get locations for the date (bucketed by local date, see LocalDateFromTimestamp)
+	locations, err := s.db.QueryLocationsByUserDate(userID, dateStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(locations) == 0 {
+		return nil, nil
+	}
+
 	// Convert locations to path points for processing
 	points := make([]PathPoint, len(locations))
 	for i, loc := range locations {
@@ -812,8 +2322,8 @@ func (s *Server) handleAPITimeline(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Apply stationary clustering to detect stops (using 50m threshold)
-	pruneResult := PruneStationaryPoints(points, 50)
+	// Apply stationary clustering to detect stops
+	stops := DetectStops(points, params)
 
 	// Get photos for this date
 	// Calculate time range from locations
@@ -828,51 +2338,15 @@ func (s *Server) handleAPITimeline(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	photos, err := s.db.QueryPhotoLocations(startTS, endTS)
+	photos, err := s.db.QueryPhotoLocations(userID, startTS, endTS)
 	if err != nil {
-		http.Error(w, "database error", http.StatusInternalServerError)
-		return
-	}
-
-	// First: merge nearby clusters (within 500m AND short gap) to handle GPS drift
-	// Do this BEFORE filtering so that distant stops break the merge chain
-	const mergeDistanceMeters = 500.0
-	const mergeMaxGapSeconds int64 = 30 * 60 // 30 minutes
-	var mergedClusters []StationaryCluster
-	for _, cluster := range pruneResult.Clusters {
-		if len(mergedClusters) == 0 {
-			mergedClusters = append(mergedClusters, cluster)
-			continue
-		}
-
-		last := &mergedClusters[len(mergedClusters)-1]
-		dist := haversineMeters(last.CentroidLat, last.CentroidLon, cluster.CentroidLat, cluster.CentroidLon)
-		gap := cluster.StartTS - last.EndTS
-
-		if dist <= mergeDistanceMeters && gap <= mergeMaxGapSeconds {
-			// Merge: extend the previous cluster and update centroid (weighted average)
-			totalPoints := last.PointCount + cluster.PointCount
-			last.CentroidLat = (last.CentroidLat*float64(last.PointCount) + cluster.CentroidLat*float64(cluster.PointCount)) / float64(totalPoints)
-			last.CentroidLon = (last.CentroidLon*float64(last.PointCount) + cluster.CentroidLon*float64(cluster.PointCount)) / float64(totalPoints)
-			last.EndTS = cluster.EndTS
-			last.PointCount = totalPoints
-		} else {
-			mergedClusters = append(mergedClusters, cluster)
-		}
-	}
-
-	// Then: filter to only keep real stops (10+ minutes)
-	const minStopDuration int64 = 10 * 60 // 10 minutes in seconds
-	var stops []StationaryCluster
-	for _, cluster := range mergedClusters {
-		duration := cluster.EndTS - cluster.StartTS
-		if duration >= minStopDuration {
-			stops = append(stops, cluster)
-		}
+		return nil, err
 	}
 
 	// Build timeline entries: interleave stops with travel segments
 	var entries []TimelineEntry
+	travelSegments := make(map[int][]PathPoint) // Entry index -> points along the travel
+	photoAtStop := make([]bool, len(photos))
 
 	for i, stop := range stops {
 		// Add travel segment before this stop (if not the first stop)
@@ -886,18 +2360,19 @@ func (s *Server) handleAPITimeline(w http.ResponseWriter, r *http.Request) {
 			if travelDuration > 60 { // More than 1 minute of travel
 				// Calculate actual path distance by summing consecutive point distances
 				var distance float64
-				var lastPt *PathPoint
-				for j := range points {
-					pt := &points[j]
+				var segment []PathPoint
+				for _, pt := range points {
 					if pt.Timestamp >= travelStart && pt.Timestamp <= travelEnd {
-						if lastPt != nil {
-							distance += haversineMeters(lastPt.Lat, lastPt.Lon, pt.Lat, pt.Lon)
+						if len(segment) > 0 {
+							last := segment[len(segment)-1]
+							distance += DistanceMeters(last.Lat, last.Lon, pt.Lat, pt.Lon)
 						}
-						lastPt = pt
+						segment = append(segment, pt)
 					}
 				}
 
 				endLat, endLon := stop.CentroidLat, stop.CentroidLon
+				travelSegments[len(entries)] = segment
 				entries = append(entries, TimelineEntry{
 					Timestamp:      travelStart,
 					EndTimestamp:   &travelEnd,
@@ -906,6 +2381,7 @@ func (s *Server) handleAPITimeline(w http.ResponseWriter, r *http.Request) {
 					EndLat:         &endLat,
 					EndLon:         &endLon,
 					EntryType:      "travel",
+					Mode:           ClassifyMode(segment),
 					Duration:       &travelDuration,
 					DistanceMeters: &distance,
 				})
@@ -925,48 +2401,149 @@ func (s *Server) handleAPITimeline(w http.ResponseWriter, r *http.Request) {
 
 		// Find photos that fall within this stop's time range (with a 5-minute buffer)
 		const buffer = 5 * 60 // 5 minutes in seconds
-		for _, photo := range photos {
+		for j, photo := range photos {
 			if photo.Timestamp >= stop.StartTS-buffer && photo.Timestamp <= stop.EndTS+buffer {
-				entry.Photos = append(entry.Photos, TimelinePhoto{
-					SourceID:     photo.SourceID,
-					ThumbnailURL: fmt.Sprintf("/api/immich/assets/%s/thumbnail", photo.SourceID),
-					Filename:     photo.Filename,
-				})
+				entry.Photos = append(entry.Photos, newTimelinePhoto(photo))
+				photoAtStop[j] = true
+				if entry.photoPlace == "" {
+					entry.photoPlace = photo.PlaceName()
+				}
 			}
 		}
 
 		entries = append(entries, entry)
 	}
 
-	// Batch geocode only stop locations (not travel segments)
-	if s.geocoder != nil && len(entries) > 0 {
-		// Collect stop indices and their coordinates
-		var stopIndices []int
-		var geoPoints []LatLon
-		for i, entry := range entries {
-			if entry.EntryType == "stop" {
-				stopIndices = append(stopIndices, i)
-				geoPoints = append(geoPoints, LatLon{Lat: entry.Lat, Lon: entry.Lon})
+	// Attach the remaining photos to the travel segment they were taken during,
+	// placed at the interpolated position along the route
+	for j, photo := range photos {
+		if photoAtStop[j] {
+			continue
+		}
+		for i, segment := range travelSegments {
+			entry := &entries[i]
+			if len(segment) == 0 || photo.Timestamp < entry.Timestamp || photo.Timestamp > *entry.EndTimestamp {
+				continue
 			}
+			lat, lon := interpolateSegment(segment, photo.Timestamp)
+			tp := newTimelinePhoto(photo)
+			tp.Lat, tp.Lon = &lat, &lon
+			entry.Photos = append(entry.Photos, tp)
+			break
 		}
+	}
 
-		if len(geoPoints) > 0 {
-			geocoded, err := s.geocoder.ReverseGeocodeBatch(ctx, geoPoints)
-			if err == nil {
-				for geoIdx, entryIdx := range stopIndices {
-					if place, ok := geocoded[geoIdx]; ok && place != nil {
-						entries[entryIdx].PlaceName = place.PlaceName
-					}
-				}
+	return entries, nil
+}
+
+// nameTimelineStops names the stop entries (not travel segments) of all the given days
+// in one batch, so a range costs a single round of geocoding. Stops with photos Immich
+// has already placed use that name instead of geocoding.
+func (s *Server) nameTimelineStops(ctx context.Context, userID string, days [][]TimelineEntry) {
+	var stops []*TimelineEntry
+	var stopPoints []LatLon
+	var hints []string
+	for _, entries := range days {
+		for i := range entries {
+			if entries[i].EntryType == "stop" {
+				stops = append(stops, &entries[i])
+				stopPoints = append(stopPoints, LatLon{Lat: entries[i].Lat, Lon: entries[i].Lon})
+				hints = append(hints, entries[i].photoPlace)
 			}
 		}
 	}
+	for i, name := range s.placeNamesWithHints(ctx, userID, stopPoints, hints) {
+		stops[i].PlaceName = name
+	}
+}
+
+// GET /api/geocode/reverse?lat=...&lon=... - Reverse geocodes a single point, e.g. a map click.
+// Cached places are returned immediately; misses go to the provider through the rate limiter.
+// An optional zoom=3-18 overrides the configured detail level (uncached).
+func (s *Server) handleAPIGeocodeReverse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	timelineResp := TimelineResponse{
-		Date:    dateStr,
-		Entries: entries,
+	q := r.URL.Query()
+	lat, err := strconv.ParseFloat(q.Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		http.Error(w, "invalid lat", http.StatusBadRequest)
+		return
+	}
+	lon, err := strconv.ParseFloat(q.Get("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		http.Error(w, "invalid lon", http.StatusBadRequest)
+		return
+	}
+
+	zoom := 0
+	if v := q.Get("zoom"); v != "" {
+		zoom, err = strconv.Atoi(v)
+		if err != nil || !validNominatimZoom(zoom) {
+			http.Error(w, "invalid zoom (3-18)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if s.geocoder == nil {
+		http.Error(w, "geocoding not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var place *GeocodedPlace
+	if zoom != 0 {
+		place, err = s.geocoder.ReverseGeocodeAtZoom(ctx, lat, lon, zoom)
+	} else {
+		place, err = s.geocoder.ReverseGeocode(ctx, lat, lon)
+	}
+	if err != nil {
+		http.Error(w, "geocoding error", http.StatusBadGateway)
+		return
+	}
+	if place == nil {
+		http.Error(w, "no place found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(place)
+}
+
+// GET /api/geocode/search?q=... - Forward geocodes a place name for jumping the map
+func (s *Server) handleAPIGeocodeSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	if s.geocoder == nil {
+		http.Error(w, "geocoding not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	results, err := s.geocoder.Search(ctx, query)
+	if err != nil {
+		http.Error(w, "geocoding error", http.StatusBadGateway)
+		return
+	}
+	if results == nil {
+		results = []SearchResult{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(timelineResp)
+	json.NewEncoder(w).Encode(results)
 }
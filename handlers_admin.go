@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupResponse is the API response for a backup written to a server path
+type BackupResponse struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// BackupTo writes a consistent snapshot of the database to path using VACUUM INTO.
+// Ingestion keeps running; the copy reflects a single read transaction.
+// The destination must not already exist.
+func (db *DB) BackupTo(path string) error {
+	_, err := db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
+// POST /api/admin/backup - Snapshots the live database
+// With ?path=, writes the backup to that server path (requires auth tokens to be configured)
+// and returns its size. Without it, streams the backup as a download.
+func (s *Server) handleAPIBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if path := r.URL.Query().Get("path"); path != "" {
+		// Writing to arbitrary server paths is too dangerous on an open instance
+		if s.config.AuthTokens() == nil {
+			http.Error(w, "backups to a server path require auth tokens to be configured", http.StatusForbidden)
+			return
+		}
+		if !filepath.IsAbs(path) {
+			http.Error(w, "path must be absolute", http.StatusBadRequest)
+			return
+		}
+		if _, err := os.Stat(path); err == nil {
+			http.Error(w, "path already exists", http.StatusConflict)
+			return
+		}
+
+		if err := s.db.BackupTo(path); err != nil {
+			http.Error(w, "backup failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			http.Error(w, "backup failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BackupResponse{Path: path, Bytes: info.Size()})
+		return
+	}
+
+	// Stream mode: snapshot to a temp file, then send it
+	tmpDir, err := os.MkdirTemp("", "whence-backup-*")
+	if err != nil {
+		http.Error(w, "backup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, "whence.db")
+	if err := s.db.BackupTo(tmpPath); err != nil {
+		http.Error(w, "backup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		http.Error(w, "backup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "backup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("whence-%s.db", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	io.Copy(w, f)
+}
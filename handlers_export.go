@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GeoJSONFeatureCollection is a GeoJSON FeatureCollection
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is a GeoJSON Feature with arbitrary properties
+type GeoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// GeoJSONGeometry is a GeoJSON geometry (Point or LineString)
+type GeoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// pathToGeoJSONFeature converts a path to a LineString feature.
+// Point timestamps are kept in a parallel coordTimes property so the data round-trips.
+func pathToGeoJSONFeature(p Path) GeoJSONFeature {
+	coords := make([][]float64, len(p.Points))
+	coordTimes := make([]string, len(p.Points))
+	for i, pt := range p.Points {
+		coords[i] = []float64{pt.Lon, pt.Lat}
+		coordTimes[i] = time.Unix(pt.Timestamp, 0).UTC().Format(time.RFC3339)
+	}
+
+	// A LineString needs at least two positions
+	geometry := GeoJSONGeometry{Type: "LineString", Coordinates: coords}
+	if len(coords) == 1 {
+		geometry = GeoJSONGeometry{Type: "Point", Coordinates: coords[0]}
+	}
+
+	return GeoJSONFeature{
+		Type:     "Feature",
+		Geometry: geometry,
+		Properties: map[string]any{
+			"user_id":     p.UserID,
+			"date":        p.Date,
+			"point_count": p.PointCount,
+			"start_ts":    p.StartTS,
+			"end_ts":      p.EndTS,
+			"coordTimes":  coordTimes,
+		},
+	}
+}
+
+// GET /api/export/geojson - Exports paths in a bounding box as a GeoJSON FeatureCollection
+// Accepts the same bbox/start/end/prune/spikes/order params as /api/paths
+func (s *Server) handleExportGeoJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bboxStr := r.URL.Query().Get("bbox")
+	if bboxStr == "" {
+		http.Error(w, "bbox required", http.StatusBadRequest)
+		return
+	}
+
+	bbox, err := parseBBox(bboxStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start, end := parseOptionalTimeRange(r.URL.Query())
+	opts := parseSimplifyOptions(r.URL.Query())
+	if opts.LOD == "" {
+		// Exports keep daily paths regardless of the bbox size
+		opts.LOD = LODDay
+	}
+	opts.MaxGapSeconds = 0 // Each day is exported as a single LineString
+
+	result, err := s.db.QueryPathsWithPoints(s.queryUserID(r), bbox, start, end, opts)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	fc := GeoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]GeoJSONFeature, 0, len(result.Paths)),
+	}
+	for _, p := range result.Paths {
+		if len(p.Points) == 0 {
+			continue
+		}
+		fc.Features = append(fc.Features, pathToGeoJSONFeature(p))
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("Content-Disposition", `attachment; filename="whence-export.geojson"`)
+	json.NewEncoder(w).Encode(fc)
+}
+
+// GPX 1.1 document with Garmin TrackPointExtension for speed
+type gpxDoc struct {
+	XMLName        xml.Name `xml:"gpx"`
+	Version        string   `xml:"version,attr"`
+	Creator        string   `xml:"creator,attr"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XmlnsXsi       string   `xml:"xmlns:xsi,attr"`
+	XmlnsGpxtpx    string   `xml:"xmlns:gpxtpx,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Track          gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name"`
+	Segment gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lon        float64        `xml:"lon,attr"`
+	Ele        *float64       `xml:"ele,omitempty"`
+	Time       string         `xml:"time"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxExtensions struct {
+	TrackPoint gpxTrackPointExtension `xml:"gpxtpx:TrackPointExtension"`
+}
+
+type gpxTrackPointExtension struct {
+	Speed float64 `xml:"gpxtpx:speed"` // m/s
+}
+
+// GET /api/export/gpx - Exports a user's track for one day as GPX 1.1
+func (s *Server) handleExportGPX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dateStr := r.URL.Query().Get("date")
+	if dateStr == "" {
+		http.Error(w, "date parameter required (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", dateStr); err != nil {
+		http.Error(w, "invalid date format, use YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.URL.Query().Get("user")
+	if userID == "" {
+		userID = s.defaultUserID
+	}
+
+	// Locations are returned ordered by timestamp
+	locations, err := s.db.QueryLocationsByUserDate(userID, dateStr)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	doc := gpxDoc{
+		Version:        "1.1",
+		Creator:        "Whence",
+		Xmlns:          "http://www.topografix.com/GPX/1/1",
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		XmlnsGpxtpx:    "http://www.garmin.com/xmlschemas/TrackPointExtension/v2",
+		SchemaLocation: "http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v2 http://www8.garmin.com/xmlschemas/TrackPointExtensionv2.xsd",
+		Track: gpxTrack{
+			Name: fmt.Sprintf("%s %s", userID, dateStr),
+			Segment: gpxSegment{
+				Points: make([]gpxPoint, 0, len(locations)),
+			},
+		},
+	}
+
+	for _, loc := range locations {
+		pt := gpxPoint{
+			Lat:  loc.Lat,
+			Lon:  loc.Lon,
+			Ele:  loc.AltitudeM,
+			Time: time.Unix(loc.Timestamp, 0).UTC().Format(time.RFC3339),
+		}
+		if loc.SpeedKmh != nil {
+			// Convert km/h back to m/s
+			pt.Extensions = &gpxExtensions{
+				TrackPoint: gpxTrackPointExtension{Speed: *loc.SpeedKmh / 3.6},
+			}
+		}
+		doc.Track.Segment.Points = append(doc.Track.Segment.Points, pt)
+	}
+
+	w.Header().Set("Content-Type", "application/gpx+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="whence-%s.gpx"`, dateStr))
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(doc)
+}
+
+// formatOptionalFloat formats a nullable float for CSV, leaving nil values empty
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// GET /api/export/csv - Streams raw locations as CSV
+// Optional params: start, end (Unix timestamps), user
+func (s *Server) handleExportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start, end := parseOptionalTimeRange(r.URL.Query())
+	userID := r.URL.Query().Get("user")
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="whence-locations.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"timestamp", "user_id", "device_id", "lat", "lon", "altitude_m", "accuracy_m", "speed_kmh", "source"})
+
+	err := s.db.StreamLocations(userID, start, end, func(loc Location) error {
+		var source string
+		if loc.Source != nil {
+			source = *loc.Source
+		}
+		return cw.Write([]string{
+			strconv.FormatInt(loc.Timestamp, 10),
+			loc.UserID,
+			loc.DeviceID,
+			strconv.FormatFloat(loc.Lat, 'f', -1, 64),
+			strconv.FormatFloat(loc.Lon, 'f', -1, 64),
+			formatOptionalFloat(loc.AltitudeM),
+			formatOptionalFloat(loc.AccuracyM),
+			formatOptionalFloat(loc.SpeedKmh),
+			source,
+		})
+	})
+	cw.Flush()
+
+	// Headers are already sent, so errors can only be logged
+	if err != nil {
+		log.Printf("csv export failed: %v", err)
+	}
+}
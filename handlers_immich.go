@@ -2,12 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	// originalProxyTimeout bounds a full-size asset download through /api/immich/assets/{id}/original
+	originalProxyTimeout = 5 * time.Minute
+
+	// defaultImportJobsPageSize is the page size of /api/immich/jobs.json without ?limit=
+	defaultImportJobsPageSize = 20
+
+	// maxImportJobsPageSize caps ?limit= on /api/immich/jobs.json
+	maxImportJobsPageSize = 200
+)
+
 // ImmichHandlers holds handlers for Immich-related endpoints
 type ImmichHandlers struct {
 	config    *Config
@@ -15,6 +33,8 @@ type ImmichHandlers struct {
 	manager   *BackfillManager
 	db        *DB
 	templates *Templates
+	thumbs    *ThumbnailCache // nil when disabled
+	closing   context.Context // Ends when shutdown starts, closing SSE streams (nil = never)
 }
 
 // NewImmichHandlers creates handlers for Immich endpoints
@@ -27,7 +47,17 @@ func NewImmichHandlers(cfg *Config, db *DB, templates *Templates) *ImmichHandler
 
 	if cfg != nil && cfg.ImmichConfigured() {
 		h.client = NewImmichClient(cfg.Immich.URL, cfg.Immich.APIKey)
-		h.manager = NewBackfillManager(db, h.client)
+		h.client.MaxRetries = cfg.ImmichMaxRetries()
+		h.manager = NewBackfillManager(db, h.client, cfg.ImportConcurrency())
+
+		if maxBytes, dir := cfg.ThumbnailCacheMaxBytes(), cfg.ThumbnailCacheDir(); maxBytes > 0 && dir != "" {
+			thumbs, err := NewThumbnailCache(dir, maxBytes)
+			if err != nil {
+				fmt.Printf("warning: thumbnail cache disabled: %v\n", err)
+			} else {
+				h.thumbs = thumbs
+			}
+		}
 	}
 
 	return h
@@ -54,6 +84,7 @@ type ImmichStatusData struct {
 	URL        string
 	Version    string
 	Error      string
+	Albums     []ImmichAlbum
 }
 
 // HandleStatus returns Immich connection status as HTML
@@ -87,11 +118,18 @@ func (h *ImmichHandlers) HandleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Albums are only used for the optional album selector, so failures are non-fatal
+	albums, err := h.client.ListAlbums(ctx)
+	if err != nil {
+		fmt.Printf("warning: failed to list Immich albums: %v\n", err)
+	}
+
 	h.templates.Render(w, "partials/immich-status.html", ImmichStatusData{
 		Configured: true,
 		Connected:  true,
 		URL:        h.client.BaseURL,
 		Version:    info.Version,
+		Albums:     albums,
 	})
 }
 
@@ -120,28 +158,20 @@ func (h *ImmichHandlers) HandlePreviewStart(w http.ResponseWriter, r *http.Reque
 
 	afterStr := r.FormValue("after")
 	beforeStr := r.FormValue("before")
+	albumStr := r.FormValue("album")
 
 	// Return the scan progress template that will connect to SSE
 	w.Header().Set("Content-Type", "text/html")
 	h.templates.Render(w, "partials/scan-progress.html", map[string]any{
 		"After":  afterStr,
 		"Before": beforeStr,
+		"Album":  albumStr,
 	})
 }
 
-// HandlePreview streams preview results via SSE with HTML fragments
-// GET /api/immich/preview?after=...&before=...
-func (h *ImmichHandlers) HandlePreview(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	if !h.requireImmich(w) {
-		return
-	}
-
-	// Parse query parameters
+// previewConfig builds a preview's config from the after/before (YYYY-MM-DD) and album query params.
+// Invalid dates are ignored.
+func (h *ImmichHandlers) previewConfig(r *http.Request) ImportConfig {
 	config := ImportConfig{
 		UserID: h.config.DefaultUser,
 	}
@@ -151,6 +181,7 @@ func (h *ImmichHandlers) HandlePreview(w http.ResponseWriter, r *http.Request) {
 
 	afterStr := r.URL.Query().Get("after")
 	beforeStr := r.URL.Query().Get("before")
+	config.Album = r.URL.Query().Get("album")
 
 	if afterStr != "" {
 		t, err := time.Parse("2006-01-02", afterStr)
@@ -166,6 +197,52 @@ func (h *ImmichHandlers) HandlePreview(w http.ResponseWriter, r *http.Request) {
 			config.Before = &t
 		}
 	}
+	return config
+}
+
+// HandlePreviewJSON runs a preview to completion and returns the final result as JSON
+// GET /api/immich/preview.json?after=...&before=...&album=...
+func (h *ImmichHandlers) HandlePreviewJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireImmich(w) {
+		return
+	}
+
+	var final PreviewProgress
+	h.manager.Preview(r.Context(), h.previewConfig(r), func(progress PreviewProgress) {
+		if progress.Complete || progress.Error != "" {
+			final = progress
+		}
+	})
+	if r.Context().Err() != nil {
+		// Client went away; nothing to send
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if final.Error != "" {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(final)
+}
+
+// HandlePreview streams preview results via SSE with HTML fragments
+// GET /api/immich/preview?after=...&before=...&album=...
+func (h *ImmichHandlers) HandlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireImmich(w) {
+		return
+	}
+
+	config := h.previewConfig(r)
 
 	// Set up SSE
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -227,8 +304,9 @@ func (h *ImmichHandlers) HandlePreview(w http.ResponseWriter, r *http.Request) {
 				"Scanned": progress.Scanned,
 				"WithGPS": progress.PhotosWithGPS,
 				"Cameras": cameras,
-				"After":   afterStr,
-				"Before":  beforeStr,
+				"After":   r.URL.Query().Get("after"),
+				"Before":  r.URL.Query().Get("before"),
+				"Album":   config.Album,
 			}
 
 			// Render the camera table template
@@ -306,7 +384,9 @@ func (h *ImmichHandlers) HandleImport(w http.ResponseWriter, r *http.Request) {
 
 	config := ImportConfig{
 		Cameras: r.Form["cameras"],
+		Album:   r.FormValue("album"),
 		UserID:  h.config.DefaultUser,
+		DryRun:  dryRunRequested(r),
 	}
 	if config.UserID == "" {
 		config.UserID = "default"
@@ -326,6 +406,17 @@ func (h *ImmichHandlers) HandleImport(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if config.DryRun {
+		result, err := h.manager.DryRunImport(r.Context(), config)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
 	jobID, err := h.manager.StartImport(config)
 	if err != nil {
 		w.Header().Set("Content-Type", "text/html")
@@ -365,7 +456,7 @@ func (h *ImmichHandlers) HandleJobs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jobs, err := h.db.ListImportJobs()
+	jobs, _, err := h.db.ListImportJobs(ImportJobFilter{Source: "immich", Limit: 5})
 	if err != nil {
 		w.Header().Set("Content-Type", "text/html")
 		h.templates.Render(w, "partials/error.html", map[string]any{
@@ -376,12 +467,9 @@ func (h *ImmichHandlers) HandleJobs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert to template data, limit to 5 recent jobs
-	jobData := make([]JobListData, 0, 5)
-	for i, job := range jobs {
-		if i >= 5 {
-			break
-		}
+	// Convert to template data
+	jobData := make([]JobListData, 0, len(jobs))
+	for _, job := range jobs {
 		jobData = append(jobData, JobListData{
 			ID:        job.ID,
 			Status:    job.Status,
@@ -397,6 +485,60 @@ func (h *ImmichHandlers) HandleJobs(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ImportJobsResponse is a page of import jobs from /api/immich/jobs.json
+type ImportJobsResponse struct {
+	Jobs   []ImportJob `json:"jobs"`
+	Total  int         `json:"total"` // Jobs matching the filter across all pages
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// HandleJobsJSON returns a page of Immich import jobs as JSON
+// GET /api/immich/jobs.json?limit=&offset=&status=
+func (h *ImmichHandlers) HandleJobsJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := ImportJobFilter{
+		Source: "immich",
+		Status: q.Get("status"),
+		Limit:  defaultImportJobsPageSize,
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(n, maxImportJobsPageSize)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = n
+	}
+
+	jobs, total, err := h.db.ListImportJobs(filter)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ImportJobsResponse{
+		Jobs:   jobs,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	})
+}
+
 // HandleJob returns status of a specific job as HTML
 // GET /api/immich/jobs/{id}
 func (h *ImmichHandlers) HandleJob(w http.ResponseWriter, r *http.Request) {
@@ -448,9 +590,10 @@ func (h *ImmichHandlers) HandleJob(w http.ResponseWriter, r *http.Request) {
 	switch progress.Status {
 	case "completed":
 		h.templates.Render(w, "partials/import-complete.html", map[string]any{
-			"Imported": progress.Imported,
-			"Skipped":  progress.Skipped,
-			"Errors":   progress.Errors,
+			"Imported":     progress.Imported,
+			"Skipped":      progress.Skipped,
+			"Errors":       progress.Errors,
+			"ErrorSamples": progress.ErrorSamples,
 		})
 	case "cancelled":
 		h.templates.Render(w, "partials/import-cancelled.html", map[string]any{
@@ -631,7 +774,8 @@ func (h *ImmichHandlers) HandleJobStream(w http.ResponseWriter, r *http.Request)
 	ch, unsubscribe := h.manager.Subscribe(jobID)
 	defer unsubscribe()
 
-	ctx := r.Context()
+	ctx, cancel := untilClosing(r.Context(), h.closing)
+	defer cancel()
 
 	for {
 		select {
@@ -659,6 +803,7 @@ func (h *ImmichHandlers) HandleJobStream(w http.ResponseWriter, r *http.Request)
 func (h *ImmichHandlers) sendProgressEvent(w http.ResponseWriter, progress *ImportProgress) {
 	var html stringWriter
 	h.templates.Render(&html, "partials/import-progress-update.html", map[string]any{
+		"Percent":  int(progress.Percent),
 		"Imported": progress.Imported,
 		"Skipped":  progress.Skipped,
 		"Errors":   progress.Errors,
@@ -671,9 +816,10 @@ func (h *ImmichHandlers) sendJobStatusEvent(w http.ResponseWriter, progress *Imp
 	var html stringWriter
 	var templateName string
 	data := map[string]any{
-		"Imported": progress.Imported,
-		"Skipped":  progress.Skipped,
-		"Errors":   progress.Errors,
+		"Imported":     progress.Imported,
+		"Skipped":      progress.Skipped,
+		"Errors":       progress.Errors,
+		"ErrorSamples": progress.ErrorSamples,
 	}
 
 	switch progress.Status {
@@ -694,6 +840,72 @@ func (h *ImmichHandlers) sendJobStatusEvent(w http.ResponseWriter, progress *Imp
 	fmt.Fprintf(w, "event: complete\ndata: %s\n\n", escapeSSEData(html.String()))
 }
 
+// HandleAsset routes asset proxy requests by their final path segment
+// GET /api/immich/assets/{id}/thumbnail, GET /api/immich/assets/{id}/original
+func (h *ImmichHandlers) HandleAsset(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case hasSuffix(r.URL.Path, "/original"):
+		h.HandleOriginal(w, r)
+	default:
+		h.HandleThumbnail(w, r)
+	}
+}
+
+// HandleOriginal streams an asset's original file from Immich without buffering it
+// GET /api/immich/assets/{id}/original
+func (h *ImmichHandlers) HandleOriginal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireImmich(w) {
+		return
+	}
+
+	path := r.URL.Path
+	prefix := "/api/immich/assets/"
+	suffix := "/original"
+	if !hasPrefix(path, prefix) || !hasSuffix(path, suffix) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	assetID := path[len(prefix) : len(path)-len(suffix)]
+	if assetID == "" || strings.Contains(assetID, "/") {
+		http.Error(w, "invalid asset id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), originalProxyTimeout)
+	defer cancel()
+
+	resp, err := h.client.OpenOriginal(ctx, assetID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Type", "Content-Length", "Last-Modified", "ETag"} {
+		if v := resp.Header.Get(header); v != "" {
+			w.Header().Set(header, v)
+		}
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	// Display in the browser rather than download, keeping Immich's filename
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": params["filename"]}))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		// Headers are already sent; the client sees a truncated body
+		fmt.Printf("warning: failed to stream original %s: %v\n", assetID, err)
+	}
+}
+
 // HandleThumbnail proxies thumbnail requests to Immich
 // GET /api/immich/assets/{id}/thumbnail
 func (h *ImmichHandlers) HandleThumbnail(w http.ResponseWriter, r *http.Request) {
@@ -716,23 +928,60 @@ func (h *ImmichHandlers) HandleThumbnail(w http.ResponseWriter, r *http.Request)
 	}
 	assetID := path[len(prefix) : len(path)-len(suffix)]
 
-	// Get optional size param (thumbnail, preview, or fullsize)
+	// Optional size param (thumbnail, preview, or fullsize). Anything else is rejected
+	// rather than passed through to Immich's URL.
 	size := r.URL.Query().Get("size")
+	switch size {
+	case "":
+		size = "thumbnail" // Share the cache entry and ETag with explicit ?size=thumbnail
+	case "thumbnail", "preview", "fullsize":
+	default:
+		http.Error(w, "invalid size (thumbnail, preview, or fullsize)", http.StatusBadRequest)
+		return
+	}
+
+	// A rendition never changes for an asset, so revisits skip the cache and Immich entirely
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if notModified(w, r, thumbnailETag(assetID, size)) {
+		return
+	}
+
+	if h.thumbs != nil {
+		if data, contentType, ok := h.thumbs.Get(assetID, size); ok {
+			w.Header().Set("Content-Type", contentType)
+			w.Write(data)
+			return
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	data, contentType, err := h.client.GetThumbnail(ctx, assetID, size)
 	if err != nil {
+		// Don't let clients cache the failure
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if h.thumbs != nil {
+		if err := h.thumbs.Put(assetID, size, contentType, data); err != nil {
+			fmt.Printf("warning: failed to cache thumbnail %s: %v\n", assetID, err)
+		}
+	}
+
 	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Cache-Control", "public, max-age=86400")
 	w.Write(data)
 }
 
+// thumbnailETag returns the entity tag for an asset's thumbnail at a size
+func thumbnailETag(assetID, size string) string {
+	sum := sha256.Sum256([]byte(assetID + "/" + size))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
 // HandleSyncStatus returns the last sync time
 // GET /api/immich/sync/status
 func (h *ImmichHandlers) HandleSyncStatus(w http.ResponseWriter, r *http.Request) {
@@ -767,31 +1016,12 @@ func (h *ImmichHandlers) HandleSync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get last sync time
-	lastSync, err := h.db.GetSyncState()
-	if err != nil {
-		w.Header().Set("Content-Type", "text/html")
-		h.templates.Render(w, "partials/error.html", map[string]any{
-			"Title":     "Sync failed",
-			"Message":   err.Error(),
-			"ShowRetry": true,
-		})
-		return
-	}
-
-	config := ImportConfig{
-		UserID: h.config.DefaultUser,
-	}
-	if config.UserID == "" {
-		config.UserID = "default"
+	userID := h.config.DefaultUser
+	if userID == "" {
+		userID = "default"
 	}
 
-	if lastSync != nil {
-		t := time.Unix(*lastSync, 0)
-		config.After = &t
-	}
-
-	jobID, err := h.manager.StartImport(config)
+	jobID, err := h.manager.StartSync(userID)
 	if err != nil {
 		w.Header().Set("Content-Type", "text/html")
 		h.templates.Render(w, "partials/error.html", map[string]any{
@@ -802,13 +1032,6 @@ func (h *ImmichHandlers) HandleSync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update sync state to now
-	now := time.Now().Unix()
-	if err := h.db.SetSyncState(now); err != nil {
-		// Log but don't fail
-		fmt.Printf("warning: failed to update sync state: %v\n", err)
-	}
-
 	// Return progress view
 	w.Header().Set("Content-Type", "text/html")
 	h.templates.Render(w, "partials/import-progress.html", map[string]any{
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// altitudeNoiseThresholdMeters is the smallest altitude change counted toward ascent/descent,
+// so GPS altitude jitter on flat ground doesn't inflate the totals
+const altitudeNoiseThresholdMeters = 5.0
+
+// ProfileRange identifies the locations a profile was computed over
+type ProfileRange struct {
+	UserID string `json:"user_id"`
+	Date   string `json:"date,omitempty"`
+	Start  *int64 `json:"start,omitempty"`
+	End    *int64 `json:"end,omitempty"`
+}
+
+// AltitudePoint is one sample of an altitude profile
+type AltitudePoint struct {
+	Timestamp           int64   `json:"timestamp"`
+	AltitudeM           float64 `json:"altitude_m"`
+	CumulativeDistanceM float64 `json:"cumulative_distance_m"`
+}
+
+// AltitudeProfileResponse is the API response for /api/altitude
+type AltitudeProfileResponse struct {
+	ProfileRange
+	AscentM      float64         `json:"ascent_m"`
+	DescentM     float64         `json:"descent_m"`
+	MinAltitudeM *float64        `json:"min_altitude_m,omitempty"`
+	MaxAltitudeM *float64        `json:"max_altitude_m,omitempty"`
+	Points       []AltitudePoint `json:"points"`
+}
+
+// queryProfileLocations loads the raw locations for a profile endpoint:
+// a local date (?date=YYYY-MM-DD) or a start/end time range, for one user
+func (s *Server) queryProfileLocations(r *http.Request) ([]Location, ProfileRange, error) {
+	q := r.URL.Query()
+	pr := ProfileRange{UserID: s.queryUserID(r), Date: q.Get("date")}
+
+	if pr.Date != "" {
+		if _, err := time.Parse("2006-01-02", pr.Date); err != nil {
+			return nil, pr, &httpError{code: http.StatusBadRequest, msg: "invalid date format, use YYYY-MM-DD"}
+		}
+		locations, err := s.db.QueryLocationsByUserDate(pr.UserID, pr.Date)
+		if err != nil {
+			return nil, pr, &httpError{code: http.StatusInternalServerError, msg: "database error"}
+		}
+		return locations, pr, nil
+	}
+
+	start, end, err := parseStrictTimeRange(q)
+	if err != nil {
+		return nil, pr, err
+	}
+	if start == nil || end == nil {
+		return nil, pr, &httpError{code: http.StatusBadRequest, msg: "date (YYYY-MM-DD) or start and end required"}
+	}
+	pr.Start, pr.End = start, end
+
+	var locations []Location
+	err = s.db.StreamLocations(pr.UserID, start, end, func(loc Location) error {
+		locations = append(locations, loc)
+		return nil
+	})
+	if err != nil {
+		return nil, pr, &httpError{code: http.StatusInternalServerError, msg: "database error"}
+	}
+	return locations, pr, nil
+}
+
+// writeProfileError writes an error from queryProfileLocations
+func writeProfileError(w http.ResponseWriter, err error) {
+	if he, ok := err.(*httpError); ok {
+		http.Error(w, he.msg, he.code)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// computeAltitudeProfile builds an altitude profile from time-ordered locations.
+// Distance accumulates over every point, but only points with an altitude are sampled.
+// Ascent/descent only count once the altitude has moved altitudeNoiseThresholdMeters
+// from the last counted level.
+func computeAltitudeProfile(locations []Location) AltitudeProfileResponse {
+	resp := AltitudeProfileResponse{Points: []AltitudePoint{}}
+
+	var distance float64
+	var ref *float64 // Altitude at the last counted ascent/descent
+	for i, loc := range locations {
+		if i > 0 {
+			prev := locations[i-1]
+			distance += DistanceMeters(prev.Lat, prev.Lon, loc.Lat, loc.Lon)
+		}
+		if loc.AltitudeM == nil {
+			continue
+		}
+		alt := *loc.AltitudeM
+
+		resp.Points = append(resp.Points, AltitudePoint{
+			Timestamp:           loc.Timestamp,
+			AltitudeM:           alt,
+			CumulativeDistanceM: distance,
+		})
+
+		if resp.MinAltitudeM == nil || alt < *resp.MinAltitudeM {
+			resp.MinAltitudeM = &alt
+		}
+		if resp.MaxAltitudeM == nil || alt > *resp.MaxAltitudeM {
+			resp.MaxAltitudeM = &alt
+		}
+
+		switch {
+		case ref == nil:
+			ref = &alt
+		case alt-*ref >= altitudeNoiseThresholdMeters:
+			resp.AscentM += alt - *ref
+			ref = &alt
+		case *ref-alt >= altitudeNoiseThresholdMeters:
+			resp.DescentM += *ref - alt
+			ref = &alt
+		}
+	}
+	return resp
+}
+
+// GET /api/altitude - Returns the altitude profile and total ascent/descent for a date or time range
+func (s *Server) handleAPIAltitude(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	locations, pr, err := s.queryProfileLocations(r)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	resp := computeAltitudeProfile(locations)
+	resp.ProfileRange = pr
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// movingMinSpeedKmh is the speed below which a sample counts as stationary for averages
+const movingMinSpeedKmh = 2.0
+
+// SpeedPoint is one sample of a speed profile
+type SpeedPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	SpeedKmh  float64 `json:"speed_kmh"`
+	Derived   bool    `json:"derived,omitempty"` // Computed from distance/time rather than reported
+}
+
+// SpeedProfileResponse is the API response for /api/speed
+type SpeedProfileResponse struct {
+	ProfileRange
+	MaxKmh        float64      `json:"max_kmh"`
+	AvgMovingKmh  float64      `json:"avg_moving_kmh"` // Time-weighted average over moving intervals
+	MovingSeconds int64        `json:"moving_seconds"`
+	Points        []SpeedPoint `json:"points"`
+}
+
+// computeSpeedProfile builds a speed time series from time-ordered locations.
+// Reported speeds are preferred; otherwise speed is derived from the previous point.
+// Duplicate or out-of-order timestamps clamp to a zero time delta and contribute no motion.
+func computeSpeedProfile(locations []Location) SpeedProfileResponse {
+	resp := SpeedProfileResponse{Points: []SpeedPoint{}}
+
+	var weightedSpeed float64
+	for i, loc := range locations {
+		var dt int64
+		var derived float64
+		if i > 0 {
+			prev := locations[i-1]
+			dt = max(loc.Timestamp-prev.Timestamp, 0)
+			if dt > 0 {
+				derived = DistanceMeters(prev.Lat, prev.Lon, loc.Lat, loc.Lon) / float64(dt) * 3.6
+			}
+		}
+
+		point := SpeedPoint{Timestamp: loc.Timestamp}
+		switch {
+		case loc.SpeedKmh != nil && *loc.SpeedKmh >= 0:
+			point.SpeedKmh = *loc.SpeedKmh
+		case i > 0:
+			point.SpeedKmh = derived
+			point.Derived = true
+		default:
+			continue // First point with no reported speed
+		}
+		resp.Points = append(resp.Points, point)
+		resp.MaxKmh = max(resp.MaxKmh, point.SpeedKmh)
+
+		// Long gaps are missing data, not motion
+		if point.SpeedKmh >= movingMinSpeedKmh && dt > 0 && dt <= statsMaxGapSeconds {
+			resp.MovingSeconds += dt
+			weightedSpeed += point.SpeedKmh * float64(dt)
+		}
+	}
+
+	if resp.MovingSeconds > 0 {
+		resp.AvgMovingKmh = weightedSpeed / float64(resp.MovingSeconds)
+	}
+	return resp
+}
+
+// GET /api/speed - Returns the speed time series and summary stats for a date or time range
+func (s *Server) handleAPISpeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	locations, pr, err := s.queryProfileLocations(r)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	resp := computeSpeedProfile(locations)
+	resp.ProfileRange = pr
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
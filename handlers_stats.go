@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// statsMaxGapSeconds is the longest gap between consecutive points that still counts
+// toward motion/stationary time; longer gaps are treated as missing data.
+const statsMaxGapSeconds int64 = 60 * 60
+
+// StatsResponse is the API response for /api/stats
+type StatsResponse struct {
+	UserID              string         `json:"user_id"`
+	Start               *int64         `json:"start,omitempty"`
+	End                 *int64         `json:"end,omitempty"`
+	TotalDistanceMeters float64        `json:"total_distance_meters"`
+	StopCount           int            `json:"stop_count"`
+	DaysWithData        int            `json:"days_with_data"`
+	MovingSeconds       int64          `json:"moving_seconds"`
+	StationarySeconds   int64          `json:"stationary_seconds"`
+	Home                *StatsPoint    `json:"home,omitempty"`     // Explicit or inferred home location
+	Farthest            *StatsPoint    `json:"farthest,omitempty"` // Farthest point from home
+	Days                []DayStats     `json:"days"`
+	Params              TimelineParams `json:"params"`
+}
+
+// StatsPoint is a location referenced by the stats response
+type StatsPoint struct {
+	Lat            float64  `json:"lat"`
+	Lon            float64  `json:"lon"`
+	Timestamp      int64    `json:"timestamp,omitempty"`
+	DistanceMeters *float64 `json:"distance_meters,omitempty"` // From home
+}
+
+// DayStats holds the statistics for a single local date
+type DayStats struct {
+	Date              string  `json:"date"`
+	DistanceMeters    float64 `json:"distance_meters"`
+	StopCount         int     `json:"stop_count"`
+	MovingSeconds     int64   `json:"moving_seconds"`
+	StationarySeconds int64   `json:"stationary_seconds"`
+}
+
+// statsPlace accumulates time spent at a stop location across days, for home inference
+type statsPlace struct {
+	lat, lon float64
+	seconds  int64
+}
+
+// computeDayStats computes distance, stops, and motion time for one day of raw points.
+// Distance sums consecutive haversine distances so it isn't deflated by simplification.
+// Returns the day's stops for home inference.
+func computeDayStats(date string, points []PathPoint, params TimelineParams) (DayStats, []StationaryCluster) {
+	day := DayStats{Date: date}
+
+	pruneResult := PruneStationaryPoints(points, params.StayRadiusMeters)
+
+	// Map each raw point to its cluster; clusters are consecutive runs of PointCount points
+	clusterOf := make([]int, len(points))
+	idx := 0
+	for c, cluster := range pruneResult.Clusters {
+		for range cluster.PointCount {
+			clusterOf[idx] = c
+			idx++
+		}
+	}
+
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1], points[i]
+		day.DistanceMeters += DistanceMeters(prev.Lat, prev.Lon, cur.Lat, cur.Lon)
+
+		dt := cur.Timestamp - prev.Timestamp
+		if dt <= 0 || dt > statsMaxGapSeconds {
+			continue
+		}
+		if clusterOf[i-1] == clusterOf[i] {
+			day.StationarySeconds += dt
+		} else {
+			day.MovingSeconds += dt
+		}
+	}
+
+	stops := FilterStops(pruneResult.Clusters, params)
+	day.StopCount = len(stops)
+
+	return day, stops
+}
+
+// GET /api/stats - Returns distance, stop, and motion statistics for a time range
+func (s *Server) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	start, end := parseOptionalTimeRange(q)
+	userID := s.queryUserID(r)
+
+	params, err := parseTimelineParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var home *StatsPoint
+	if homeStr := q.Get("home"); homeStr != "" {
+		home, err = parseStatsHome(homeStr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Group raw points by local date, computing each day's stats as it completes.
+	// Points arrive in timestamp order, so only one day is buffered at a time.
+	days := make(map[string]*DayStats)
+	var places []statsPlace
+	var curDate string
+	var curPoints []PathPoint
+
+	flushDay := func() {
+		if len(curPoints) == 0 {
+			return
+		}
+		day, stops := computeDayStats(curDate, curPoints, params)
+		if existing, ok := days[curDate]; ok {
+			// Timezone changes can revisit a date; fold into the existing entry
+			existing.DistanceMeters += day.DistanceMeters
+			existing.StopCount += day.StopCount
+			existing.MovingSeconds += day.MovingSeconds
+			existing.StationarySeconds += day.StationarySeconds
+		} else {
+			days[curDate] = &day
+		}
+
+		for _, stop := range stops {
+			places = addStatsPlace(places, stop, params.MergeDistMeters)
+		}
+		curPoints = curPoints[:0]
+	}
+
+	err = s.db.StreamLocations(userID, start, end, func(loc Location) error {
+		date := LocalDateFromTimestamp(loc.Timestamp, loc.Lat, loc.Lon)
+		if date != curDate {
+			flushDay()
+			curDate = date
+		}
+		curPoints = append(curPoints, PathPoint{Lat: loc.Lat, Lon: loc.Lon, Timestamp: loc.Timestamp})
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	flushDay()
+
+	resp := StatsResponse{
+		UserID:       userID,
+		Start:        start,
+		End:          end,
+		DaysWithData: len(days),
+		Days:         make([]DayStats, 0, len(days)),
+		Params:       params,
+	}
+	for _, day := range days {
+		resp.TotalDistanceMeters += day.DistanceMeters
+		resp.StopCount += day.StopCount
+		resp.MovingSeconds += day.MovingSeconds
+		resp.StationarySeconds += day.StationarySeconds
+		resp.Days = append(resp.Days, *day)
+	}
+	sort.Slice(resp.Days, func(i, j int) bool {
+		return resp.Days[i].Date < resp.Days[j].Date
+	})
+
+	// Infer home as the place with the most stationary time
+	if home == nil && len(places) > 0 {
+		best := places[0]
+		for _, p := range places[1:] {
+			if p.seconds > best.seconds {
+				best = p
+			}
+		}
+		home = &StatsPoint{Lat: best.lat, Lon: best.lon}
+	}
+	resp.Home = home
+
+	// Second pass for the farthest point, now that home is known
+	if home != nil {
+		var farthest *StatsPoint
+		var maxDist float64
+		err = s.db.StreamLocations(userID, start, end, func(loc Location) error {
+			dist := DistanceMeters(home.Lat, home.Lon, loc.Lat, loc.Lon)
+			if farthest == nil || dist > maxDist {
+				maxDist = dist
+				farthest = &StatsPoint{Lat: loc.Lat, Lon: loc.Lon, Timestamp: loc.Timestamp}
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if farthest != nil {
+			farthest.DistanceMeters = &maxDist
+			resp.Farthest = farthest
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// addStatsPlace adds a stop's duration to the nearest known place within
+// mergeDistMeters, or records it as a new place
+func addStatsPlace(places []statsPlace, stop StationaryCluster, mergeDistMeters float64) []statsPlace {
+	duration := stop.EndTS - stop.StartTS
+	for i := range places {
+		if DistanceMeters(places[i].lat, places[i].lon, stop.CentroidLat, stop.CentroidLon) <= mergeDistMeters {
+			places[i].seconds += duration
+			return places
+		}
+	}
+	return append(places, statsPlace{lat: stop.CentroidLat, lon: stop.CentroidLon, seconds: duration})
+}
+
+// parseStatsHome parses a home location in format lat,lon
+func parseStatsHome(s string) (*StatsPoint, error) {
+	errInvalidHome := &httpError{code: http.StatusBadRequest, msg: "invalid home format, use lat,lon"}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, errInvalidHome
+	}
+	lat, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, errInvalidHome
+	}
+	lon, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, errInvalidHome
+	}
+	return &StatsPoint{Lat: lat, Lon: lon}, nil
+}
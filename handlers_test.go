@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeatmapCellFromBBox(t *testing.T) {
+	tests := []struct {
+		name string
+		bbox BBox
+		want float64 // degrees
+	}{
+		// The 200-cell cap wins over the 0.1 degree clamp
+		{"world", BBox{SwLng: -180, SwLat: -90, NeLng: 180, NeLat: 90}, 1.8},
+		// 2% of 1 degree
+		{"region", BBox{SwLng: 10, SwLat: 50, NeLng: 11, NeLat: 51}, 0.02},
+		// Clamped up to 0.0005 degrees
+		{"street", BBox{SwLng: 10, SwLat: 50, NeLng: 10.001, NeLat: 50.001}, 0.0005},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := heatmapCellFromBBox(tt.bbox)
+			if diff := got - tt.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("heatmapCellFromBBox = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newUserScopedTestServer returns a server whose database holds one day of points for
+// each of alice and bob, with paths built
+func newUserScopedTestServer(t *testing.T) *Server {
+	t.Helper()
+	db := openTestDB(t)
+	base := int64(1700000000)
+	for i, user := range []string{"alice", "bob"} {
+		for j := range 3 {
+			loc := Location{
+				Timestamp: base + int64(i*1000+j*60),
+				UserID:    user,
+				DeviceID:  "phone",
+				Lat:       37.77 + float64(i) + float64(j)*0.01,
+				Lon:       -122.42,
+			}
+			if err := db.InsertLocation(loc); err != nil {
+				t.Fatalf("InsertLocation: %v", err)
+			}
+		}
+	}
+	if err := db.RebuildAllPaths(); err != nil {
+		t.Fatalf("RebuildAllPaths: %v", err)
+	}
+	return &Server{db: db, defaultUserID: "alice"}
+}
+
+// getJSON serves a GET request and decodes its JSON response into v
+func getJSON(t *testing.T, handler http.HandlerFunc, target string, v any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: decode: %v", target, err)
+	}
+}
+
+func TestHandlersScopedToUser(t *testing.T) {
+	s := newUserScopedTestServer(t)
+	const bbox = "bbox=-180,-90,180,90"
+
+	for _, user := range []string{"alice", "bob"} {
+		t.Run(user, func(t *testing.T) {
+			query := "?user=" + user
+			if user == "alice" {
+				query = "?" // The default user
+			}
+
+			var latest LatestResponse
+			getJSON(t, s.handleAPILatest, "/api/latest"+query, &latest)
+			if latest.UserID != user {
+				t.Errorf("/api/latest user = %q, want %q", latest.UserID, user)
+			}
+
+			var cells []HeatmapCell
+			getJSON(t, s.handleAPIHeatmap, "/api/heatmap"+query+"&"+bbox, &cells)
+			weight := 0
+			for _, cell := range cells {
+				weight += cell.Weight
+			}
+			if weight != 3 {
+				t.Errorf("/api/heatmap total weight = %d, want 3", weight)
+			}
+
+			var fc GeoJSONFeatureCollection
+			getJSON(t, s.handleExportGeoJSON, "/api/export/geojson"+query+"&"+bbox, &fc)
+			if len(fc.Features) != 1 {
+				t.Fatalf("/api/export/geojson returned %d features, want 1", len(fc.Features))
+			}
+			if got := fc.Features[0].Properties["user_id"]; got != user {
+				t.Errorf("/api/export/geojson feature user = %v, want %q", got, user)
+			}
+		})
+	}
+}
+
+func TestOwnTracksTransitionNotRecordedWhenRateLimited(t *testing.T) {
+	s := &Server{db: openTestDB(t), defaultUserID: "alice", ingestLimiter: NewDeviceRateLimiter(0.001, 1)}
+
+	post := func(tst int64) int {
+		body := fmt.Sprintf(`[
+			{"_type": "location", "lat": 51.5, "lon": -0.12, "tst": %d, "topic": "owntracks/alice/phone"},
+			{"_type": "transition", "event": "enter", "desc": "Home", "lat": 51.5, "lon": -0.12, "tst": %d, "topic": "owntracks/alice/phone"}
+		]`, tst, tst)
+		rec := httptest.NewRecorder()
+		s.handleOwnTracks(rec, httptest.NewRequest(http.MethodPost, "/owntracks", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := post(1700000000); code != http.StatusOK {
+		t.Fatalf("first request: status %d, want %d", code, http.StatusOK)
+	}
+	// The burst of one is spent, so the resent batch is rejected
+	if code := post(1700000060); code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	events, err := s.db.QueryGeofenceEvents("alice", nil, nil)
+	if err != nil {
+		t.Fatalf("QueryGeofenceEvents: %v", err)
+	}
+	if len(events) != 1 || events[0].Timestamp != 1700000000 {
+		t.Errorf("recorded events %+v, want only the accepted transition", events)
+	}
+}
+
+// offsetPhoto returns a photo east and north meters from lat/lon
+func offsetPhoto(id string, lat, lon, east, north float64) PhotoLocation {
+	return PhotoLocation{
+		SourceID: id,
+		Lat:      lat + north/metersPerDegreeLat,
+		Lon:      lon + east/(metersPerDegreeLat*math.Cos(lat*math.Pi/180)),
+	}
+}
+
+func TestClusterPhotosIsotropicAtHighLatitude(t *testing.T) {
+	const lat, lon = 69.65, 18.96 // Tromsø
+	const radius = 1000.0
+
+	tests := []struct {
+		name        string
+		east, north float64
+		want        int // clusters
+	}{
+		{"close east", 800, 0, 1},
+		{"close north", 0, 800, 1},
+		{"far east", 1200, 0, 2},
+		{"far north", 0, 1200, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			photos := []PhotoLocation{
+				offsetPhoto("a", lat, lon, 0, 0),
+				offsetPhoto("b", lat, lon, tt.east, tt.north),
+			}
+			if got := len(clusterPhotos(photos, radius)); got != tt.want {
+				t.Errorf("got %d clusters, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// A viewport of the same ground size gets the same radius as at the equator
+	square := func(lat float64) BBox {
+		dLat := 10000 / metersPerDegreeLat / 2
+		dLon := 10000 / (metersPerDegreeLat * math.Cos(lat*math.Pi/180)) / 2
+		return BBox{SwLat: lat - dLat, NeLat: lat + dLat, SwLng: -dLon, NeLng: dLon}
+	}
+	equator, north := clusterRadiusFromBBox(square(0)), clusterRadiusFromBBox(square(lat))
+	if math.Abs(equator-north) > 1 {
+		t.Errorf("cluster radius = %.1f m at %.2f°N, want %.1f m as at the equator", north, lat, equator)
+	}
+}
+
+func TestIngestRejectsOutOfRangeCoords(t *testing.T) {
+	s := &Server{db: openTestDB(t), defaultUserID: "alice"}
+
+	rec := httptest.NewRecorder()
+	s.handleGPSLogger(rec, httptest.NewRequest(http.MethodGet, "/gpslogger?lat=999&lon=-0.12&time=2024-01-10T10:00:00Z", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("gpslogger lat=999: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// In a recorder batch the bad message is skipped and the rest stored
+	body := `[
+		{"_type": "location", "lat": 51.5, "lon": -0.12, "tst": 1700000000},
+		{"_type": "location", "lat": 51.5, "lon": -200, "tst": 1700000060}
+	]`
+	rec = httptest.NewRecorder()
+	s.handleOwnTracks(rec, httptest.NewRequest(http.MethodPost, "/owntracks", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("owntracks batch: status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	locs, err := s.db.QueryLocations(worldBBox, nil, nil)
+	if err != nil {
+		t.Fatalf("QueryLocations: %v", err)
+	}
+	if len(locs) != 1 || locs[0].Timestamp != 1700000000 {
+		t.Errorf("stored %+v, want only the in-range OwnTracks point", locs)
+	}
+}
+
+func TestOwnTracksInvalidTransition(t *testing.T) {
+	s := &Server{db: openTestDB(t), defaultUserID: "alice"}
+	const msg = `{"_type": "transition", "event": "wander", "desc": "Home", "lat": 51.5, "lon": -0.12, "tst": 1700000000}`
+
+	rec := httptest.NewRecorder()
+	s.handleOwnTracks(rec, httptest.NewRequest(http.MethodPost, "/owntracks", strings.NewReader(msg)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid transition event") {
+		t.Errorf("single message: status %d: %s; want %d invalid transition event", rec.Code, rec.Body, http.StatusBadRequest)
+	}
+
+	// In a recorder batch it is skipped like any other bad message
+	rec = httptest.NewRecorder()
+	s.handleOwnTracks(rec, httptest.NewRequest(http.MethodPost, "/owntracks", strings.NewReader("["+msg+"]")))
+	if rec.Code != http.StatusOK {
+		t.Errorf("batch: status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestParseHourRange(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *HourRange
+	}{
+		{"hour_start=7&hour_end=10", &HourRange{7, 10}},
+		{"hour_start=22&hour_end=2", &HourRange{22, 2}},
+		{"hour_start=0&hour_end=24", &HourRange{0, 24}},
+		{"hour_start=24&hour_end=6", &HourRange{0, 6}},
+		{"hour_start=7", nil},
+		{"hour_start=7&hour_end=7", nil},
+		{"hour_start=-1&hour_end=7", nil},
+		{"hour_start=7&hour_end=25", nil},
+		{"hour_start=seven&hour_end=10", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		q, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+		}
+		got := parseHourRange(q)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("parseHourRange(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// clusterMembers returns each cluster's sorted photo IDs, sorted
+func clusterMembers(clusters []photoClusterData) [][]string {
+	var members [][]string
+	for _, c := range clusters {
+		var ids []string
+		for _, p := range c.photos {
+			ids = append(ids, p.SourceID)
+		}
+		slices.Sort(ids)
+		members = append(members, ids)
+	}
+	slices.SortFunc(members, func(a, b []string) int { return slices.Compare(a, b) })
+	return members
+}
+
+func TestClusterPhotosMergesGreedySplit(t *testing.T) {
+	const lat, lon = 51.5, -0.12
+	const radius = 1000.0
+
+	// Three photos in a 1.2 km line. A greedy pass seeded at the east end takes the
+	// middle photo but leaves the west one, whose centroid is then under 1 km away.
+	photos := []PhotoLocation{
+		offsetPhoto("east", lat, lon, 600, 0),
+		offsetPhoto("west", lat, lon, -600, 0),
+		offsetPhoto("middle", lat, lon, 0, 0),
+	}
+	got := clusterMembers(clusterPhotos(photos, radius))
+	if want := [][]string{{"east", "middle", "west"}}; !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("clusters = %v, want %v", got, want)
+	}
+}
+
+func TestClusterPhotosOrderIndependent(t *testing.T) {
+	const lat, lon = 51.5, -0.12
+	const radius = 500.0
+
+	var photos []PhotoLocation
+	for i, off := range [][2]float64{{0, 0}, {300, 0}, {-300, 100}, {5000, 0}, {5200, 200}, {-8000, -8000}, {400, 400}, {700, -200}} {
+		p := offsetPhoto(fmt.Sprint("p", i), lat, lon, off[0], off[1])
+		p.Timestamp = int64(1700000000 + i)
+		photos = append(photos, p)
+	}
+
+	clusters := clusterPhotos(photos, radius)
+	for i := range clusters {
+		for j := i + 1; j < len(clusters); j++ {
+			if d := DistanceMeters(clusters[i].lat, clusters[i].lon, clusters[j].lat, clusters[j].lon); d < radius {
+				t.Errorf("clusters %d and %d are %.0f m apart, want at least %.0f", i, j, d, radius)
+			}
+		}
+	}
+
+	want := clusterMembers(clusters)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 20 {
+		shuffled := slices.Clone(photos)
+		rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		if got := clusterMembers(clusterPhotos(shuffled, radius)); !slices.EqualFunc(got, want, slices.Equal) {
+			t.Fatalf("clusters of shuffled photos = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTraccarAccuracy(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  *float64
+	}{
+		{"explicit accuracy", "accuracy=12.5", ptrTo(12.5)},
+		{"accuracy preferred over hdop", "accuracy=12.5&hdop=0.9", ptrTo(12.5)},
+		{"hdop alone is not meters", "hdop=0.9", nil},
+		{"neither", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{db: openTestDB(t), defaultUserID: "alice"}
+			rec := httptest.NewRecorder()
+			s.handleTraccar(rec, httptest.NewRequest(http.MethodGet, "/traccar?id=phone&lat=51.5&lon=-0.12&timestamp=1700000000&"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+
+			loc, err := s.db.LatestLocation("alice")
+			if err != nil || loc == nil {
+				t.Fatalf("LatestLocation = %v, %v", loc, err)
+			}
+			if (loc.AccuracyM == nil) != (tt.want == nil) || (tt.want != nil && *loc.AccuracyM != *tt.want) {
+				t.Errorf("accuracy = %v, want %v", loc.AccuracyM, tt.want)
+			}
+		})
+	}
+}
+
+func ptrTo[T any](v T) *T { return &v }
+
+func TestPathsRebuildDateKeepsRetainedPath(t *testing.T) {
+	db := openTestDB(t)
+	timestamps := insertRetentionTestDays(t, db)
+	if _, err := db.deleteLocationsBefore(timestamps[3], retentionBatchSize); err != nil {
+		t.Fatalf("deleteLocationsBefore: %v", err)
+	}
+	s := &Server{db: db, defaultUserID: "alice"}
+
+	rec := httptest.NewRecorder()
+	s.handleAPIPathsRebuild(rec, httptest.NewRequest(http.MethodPost, "/api/paths/rebuild?date=2024-01-10", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	want := map[string]int{"2024-01-10": 3, "2024-01-11": 3}
+	if got := countPathPoints(t, db, "alice"); !maps.Equal(got, want) {
+		t.Errorf("path points after rebuild = %v, want %v", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleAPIPathsRebuild(rec, httptest.NewRequest(http.MethodPost, "/api/paths/rebuild?date=2024-01-11", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("rebuild of an unpruned day: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStreamLocationEndsOnShutdown(t *testing.T) {
+	closing, closeStreams := context.WithCancel(context.Background())
+	s := &Server{live: NewLocationBroadcaster(), closing: closing}
+
+	// The client stays connected; only shutdown ends the stream
+	done := make(chan struct{})
+	go func() {
+		s.handleAPIStreamLocation(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stream/location", nil))
+		close(done)
+	}()
+	closeStreams()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after shutdown started")
+	}
+}
+
+func TestLocationsDeleteScopedToUser(t *testing.T) {
+	s := newUserScopedTestServer(t)
+
+	remaining := func() map[string]int {
+		t.Helper()
+		locs, err := s.db.QueryLocations(worldBBox, nil, nil)
+		if err != nil {
+			t.Fatalf("QueryLocations: %v", err)
+		}
+		counts := make(map[string]int)
+		for _, loc := range locs {
+			counts[loc.UserID]++
+		}
+		return counts
+	}
+	deleteBBox := func(query string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleAPILocationsDelete(rec, httptest.NewRequest(http.MethodDelete, "/api/locations?bbox=-180,-90,180,90"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("DELETE: status %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	// Without ?user= only the default user's points go, even with auth disabled
+	deleteBBox("")
+	if got, want := remaining(), map[string]int{"bob": 3}; !maps.Equal(got, want) {
+		t.Errorf("locations left = %v, want %v", got, want)
+	}
+
+	deleteBBox("&user=bob")
+	if got := remaining(); len(got) != 0 {
+		t.Errorf("locations left = %v, want none", got)
+	}
+}
+
+func TestDuplicateIngestNotPublished(t *testing.T) {
+	// Each webhook delivery reports how many locations it carried
+	hooks := make(chan int, 10)
+	hookSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Data []LocationEvent `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		hooks <- len(payload.Data)
+	}))
+	t.Cleanup(hookSrv.Close)
+
+	first := []Location{
+		{Timestamp: 1700000000, UserID: "alice", DeviceID: "phone", Lat: 51.5, Lon: -0.12},
+		{Timestamp: 1700000060, UserID: "alice", DeviceID: "phone", Lat: 51.51, Lon: -0.12},
+	}
+	// A resend of the first batch with one new point
+	resend := append(slices.Clone(first), Location{Timestamp: 1700000120, UserID: "alice", DeviceID: "phone", Lat: 51.52, Lon: -0.12})
+
+	tests := []struct {
+		name  string
+		store func(s *Server, locs []Location) error
+	}{
+		{"batch API", func(s *Server, locs []Location) error {
+			body, err := json.Marshal(locs)
+			if err != nil {
+				return err
+			}
+			rec := httptest.NewRecorder()
+			s.handleAPILocationsPost(rec, httptest.NewRequest(http.MethodPost, "/api/locations", strings.NewReader(string(body))))
+			if rec.Code != http.StatusOK {
+				return fmt.Errorf("status %d: %s", rec.Code, rec.Body)
+			}
+			return nil
+		}},
+		{"tracking app", func(s *Server, locs []Location) error { return s.storeIngested(slices.Clone(locs)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				db:            openTestDB(t),
+				defaultUserID: "alice",
+				live:          NewLocationBroadcaster(),
+				webhooks:      NewWebhookDispatcher([]WebhookConfig{{URL: hookSrv.URL, Events: []string{WebhookLocation}}}),
+			}
+			events, unsubscribe, _ := s.live.Subscribe()
+			defer unsubscribe()
+
+			// publishes stores locs and checks that want of them reach live subscribers and webhooks
+			publishes := func(locs []Location, want int) {
+				t.Helper()
+				if err := tt.store(s, locs); err != nil {
+					t.Fatalf("store: %v", err)
+				}
+				if n := len(events); n != want {
+					t.Errorf("published %d live events, want %d", n, want)
+				}
+				for len(events) > 0 {
+					<-events
+				}
+				select {
+				case n := <-hooks:
+					if n != want {
+						t.Errorf("webhook carried %d locations, want %d", n, want)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("no webhook sent")
+				}
+			}
+			publishes(first, len(first))
+			publishes(resend, 1)
+
+			// Resending only stored points publishes nothing
+			if err := tt.store(s, first); err != nil {
+				t.Fatalf("store: %v", err)
+			}
+			if n := len(events); n != 0 {
+				t.Errorf("duplicate store published %d live events, want 0", n)
+			}
+			select {
+			case <-hooks:
+				t.Error("duplicate store sent a webhook")
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,8 +19,15 @@ type ImmichClient struct {
 	BaseURL    string
 	APIKey     string
 	HTTPClient *http.Client
+	MaxRetries int // Retries after a network error or 5xx response (0 = no retries)
 }
 
+// Backoff bounds for retried Immich requests
+const (
+	immichRetryBaseDelay = 500 * time.Millisecond
+	immichRetryMaxDelay  = 10 * time.Second
+)
+
 // NewImmichClient creates a new Immich API client
 func NewImmichClient(baseURL, apiKey string) *ImmichClient {
 	// Normalize URL - remove trailing slash
@@ -29,6 +39,44 @@ func NewImmichClient(baseURL, apiKey string) *ImmichClient {
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		MaxRetries: DefaultImmichMaxRetries,
+	}
+}
+
+// doWithRetry sends the request built by newReq, retrying network errors and 5xx
+// responses with jittered exponential backoff. Other statuses (including 401/403)
+// are returned immediately. newReq is called per attempt so request bodies are fresh.
+func (c *ImmichClient) doWithRetry(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		retryable := err != nil || resp.StatusCode >= 500
+		if !retryable || attempt >= c.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		reason := fmt.Sprint(err)
+		if resp != nil {
+			reason = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		// Full jitter: sleep a random duration up to the exponential backoff
+		backoff := min(immichRetryBaseDelay<<attempt, immichRetryMaxDelay)
+		delay := rand.N(backoff) + time.Millisecond
+		fmt.Printf("[immich] %s %s failed (%s), retry %d/%d in %v\n",
+			req.Method, req.URL.Path, reason, attempt+1, c.MaxRetries, delay.Round(time.Millisecond))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 }
 
@@ -45,9 +93,14 @@ type ImmichAsset struct {
 type ImmichExifInfo struct {
 	Latitude         *float64   `json:"latitude,omitempty"`
 	Longitude        *float64   `json:"longitude,omitempty"`
+	Altitude         *float64   `json:"altitude,omitempty"` // meters
 	DateTimeOriginal *time.Time `json:"dateTimeOriginal,omitempty"`
 	Make             *string    `json:"make,omitempty"`
 	Model            *string    `json:"model,omitempty"`
+	// Immich's own reverse geocoding of the GPS position
+	City    *string `json:"city,omitempty"`
+	State   *string `json:"state,omitempty"`
+	Country *string `json:"country,omitempty"`
 }
 
 // HasGPS returns true if the asset has GPS coordinates
@@ -107,11 +160,12 @@ func (a *ImmichAsset) OriginalFilename() string {
 
 // SearchOptions defines parameters for searching assets
 type SearchOptions struct {
-	After    *time.Time
-	Before   *time.Time
-	Page     int
-	PageSize int
-	WithExif bool
+	After     *time.Time
+	Before    *time.Time
+	AlbumID   string // Restrict to assets in this album ("" = all assets)
+	PageToken string // Opaque nextPage token from a previous response ("" = first page)
+	PageSize  int
+	WithExif  bool
 }
 
 // SearchResponse represents the response from Immich search API
@@ -195,60 +249,151 @@ func (c *ImmichClient) getServerVersion(ctx context.Context) (string, error) {
 }
 
 // SearchAssets searches for assets matching the given options
-// Returns assets, hasMore flag, and any error
-func (c *ImmichClient) SearchAssets(ctx context.Context, opts SearchOptions) ([]ImmichAsset, bool, error) {
+// Returns assets, the token for the next page ("" when there are no more), and any error
+func (c *ImmichClient) SearchAssets(ctx context.Context, opts SearchOptions) ([]ImmichAsset, string, error) {
 	if opts.PageSize == 0 {
 		opts.PageSize = 200
 	}
-	if opts.Page == 0 {
-		opts.Page = 1
-	}
 
 	// Build search request body
 	body := map[string]any{
-		"page":     opts.Page,
 		"size":     opts.PageSize,
 		"withExif": true,
 		"order":    "asc", // Oldest first for consistent pagination
 	}
 
+	// Pass the nextPage token back verbatim. Immich's search API takes a numeric
+	// page, and its tokens are currently stringified numbers, so send those as numbers.
+	if opts.PageToken != "" {
+		if n, err := strconv.Atoi(opts.PageToken); err == nil {
+			body["page"] = n
+		} else {
+			body["page"] = opts.PageToken
+		}
+	}
+
+	addSearchFilters(body, opts)
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := c.doWithRetry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/search/metadata", bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-api-key", c.APIKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("search request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, "", fmt.Errorf("search failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result MetadataSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	var nextPage string
+	if result.Assets.NextPage != nil {
+		nextPage = *result.Assets.NextPage
+	}
+	return result.Assets.Items, nextPage, nil
+}
+
+// addSearchFilters sets the date range and album filters of opts on a search request body
+func addSearchFilters(body map[string]any, opts SearchOptions) {
 	if opts.After != nil {
 		body["takenAfter"] = opts.After.Format(time.RFC3339)
 	}
 	if opts.Before != nil {
 		body["takenBefore"] = opts.Before.Format(time.RFC3339)
 	}
+	if opts.AlbumID != "" {
+		body["albumIds"] = []string{opts.AlbumID}
+	}
+}
 
+// CountAssets returns how many assets match the filters of opts (paging fields are ignored)
+func (c *ImmichClient) CountAssets(ctx context.Context, opts SearchOptions) (int, error) {
+	body := map[string]any{}
+	addSearchFilters(body, opts)
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return nil, false, err
+		return 0, err
+	}
+
+	resp, err := c.doWithRetry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/search/statistics", bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-api-key", c.APIKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("statistics request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("statistics request failed with status %d", resp.StatusCode)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/search/metadata", bytes.NewReader(jsonBody))
+	var result struct {
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to parse statistics response: %w", err)
+	}
+	return result.Total, nil
+}
+
+// ImmichAlbum represents an album returned from the Immich API
+type ImmichAlbum struct {
+	ID         string `json:"id"`
+	AlbumName  string `json:"albumName"`
+	AssetCount int    `json:"assetCount"`
+}
+
+// ListAlbums returns all albums the API key can see, owned or shared, sorted by name
+func (c *ImmichClient) ListAlbums(ctx context.Context) ([]ImmichAlbum, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/albums", nil)
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
 	req.Header.Set("x-api-key", c.APIKey)
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, false, fmt.Errorf("search request failed: %w", err)
+		return nil, fmt.Errorf("album request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, false, fmt.Errorf("search failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("album list failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var result MetadataSearchResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, false, fmt.Errorf("failed to parse search response: %w", err)
+	var albums []ImmichAlbum
+	if err := json.NewDecoder(resp.Body).Decode(&albums); err != nil {
+		return nil, fmt.Errorf("failed to parse album response: %w", err)
 	}
 
-	hasMore := result.Assets.NextPage != nil
-	return result.Assets.Items, hasMore, nil
+	sort.Slice(albums, func(i, j int) bool {
+		return strings.ToLower(albums[i].AlbumName) < strings.ToLower(albums[j].AlbumName)
+	})
+	return albums, nil
 }
 
 // GetThumbnail fetches a thumbnail for an asset
@@ -258,13 +403,14 @@ func (c *ImmichClient) GetThumbnail(ctx context.Context, assetID, size string) (
 	if size != "" && size != "thumbnail" {
 		url += "?size=" + size
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, "", err
-	}
-	req.Header.Set("x-api-key", c.APIKey)
-
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.doWithRetry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-api-key", c.APIKey)
+		return req, nil
+	})
 	if err != nil {
 		return nil, "", err
 	}
@@ -287,6 +433,29 @@ func (c *ImmichClient) GetThumbnail(ctx context.Context, assetID, size string) (
 	return data, contentType, nil
 }
 
+// OpenOriginal requests an asset's original file; the caller streams and closes the body.
+// Originals (videos especially) can take longer than the client timeout to transfer,
+// so that timeout is lifted and ctx bounds the whole request instead.
+func (c *ImmichClient) OpenOriginal(ctx context.Context, assetID string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/assets/"+assetID+"/original", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", c.APIKey)
+
+	client := *c.HTTPClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("original request failed with status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
 // WebURL returns the URL to view an asset in the Immich web UI
 func (c *ImmichClient) WebURL(assetID string) string {
 	return c.BaseURL + "/photos/" + assetID
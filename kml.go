@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zipMagic is the local file header signature that starts every KMZ (zip) archive
+var zipMagic = []byte("PK\x03\x04")
+
+// kmlTrack is a <gx:Track> with paired <when> and <gx:coord> elements
+type kmlTrack struct {
+	When  []string `xml:"when"`
+	Coord []string `xml:"coord"`
+}
+
+// kmlLineString is a <LineString> whose <coordinates> carry no timestamps
+type kmlLineString struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlTimeSpan is a <TimeSpan> used to synthesize timestamps for LineStrings
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+// ParseKML extracts locations from a KML document or KMZ archive.
+// Supports <gx:Track> (timestamped) and <LineString> (timestamps synthesized
+// evenly across the enclosing Placemark's <TimeSpan>; rejected without one).
+// Returned locations have no UserID or DeviceID set.
+func ParseKML(r io.Reader) ([]Location, []error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read KML: %w", err)}
+	}
+
+	if bytes.HasPrefix(data, zipMagic) {
+		data, err = readKMZ(data)
+		if err != nil {
+			return nil, []error{err}
+		}
+	}
+
+	var locations []Location
+	var errors []error
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	// LineStrings are resolved when their Placemark closes, since the
+	// TimeSpan may appear before or after the geometry
+	var pendingLines []kmlLineString
+	var span *kmlTimeSpan
+	trackNum, lineNum := 0, 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errors = append(errors, fmt.Errorf("failed to parse KML: %w", err))
+			break
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "Placemark":
+				pendingLines = nil
+				span = nil
+			case "TimeSpan":
+				var ts kmlTimeSpan
+				if err := dec.DecodeElement(&ts, &el); err != nil {
+					errors = append(errors, fmt.Errorf("invalid TimeSpan: %w", err))
+					continue
+				}
+				span = &ts
+			case "Track":
+				var track kmlTrack
+				if err := dec.DecodeElement(&track, &el); err != nil {
+					errors = append(errors, fmt.Errorf("track %d: %w", trackNum, err))
+					trackNum++
+					continue
+				}
+				locs, errs := kmlTrackLocations(track, trackNum)
+				locations = append(locations, locs...)
+				errors = append(errors, errs...)
+				trackNum++
+			case "LineString":
+				var line kmlLineString
+				if err := dec.DecodeElement(&line, &el); err != nil {
+					errors = append(errors, fmt.Errorf("linestring %d: %w", lineNum, err))
+					lineNum++
+					continue
+				}
+				pendingLines = append(pendingLines, line)
+			}
+		case xml.EndElement:
+			if el.Name.Local != "Placemark" {
+				continue
+			}
+			for _, line := range pendingLines {
+				locs, errs := kmlLineStringLocations(line, span, lineNum)
+				locations = append(locations, locs...)
+				errors = append(errors, errs...)
+				lineNum++
+			}
+			pendingLines = nil
+			span = nil
+		}
+	}
+
+	return locations, errors
+}
+
+// readKMZ returns the contents of doc.kml (or the first .kml file) in a KMZ archive
+func readKMZ(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMZ archive: %w", err)
+	}
+
+	var kmlFile *zip.File
+	for _, f := range zr.File {
+		if f.Name == "doc.kml" {
+			kmlFile = f
+			break
+		}
+		if kmlFile == nil && strings.EqualFold(path.Ext(f.Name), ".kml") {
+			kmlFile = f
+		}
+	}
+	if kmlFile == nil {
+		return nil, fmt.Errorf("KMZ archive contains no doc.kml")
+	}
+
+	rc, err := kmlFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in KMZ: %w", kmlFile.Name, err)
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// kmlTrackLocations converts a gx:Track into locations
+func kmlTrackLocations(track kmlTrack, trackNum int) ([]Location, []error) {
+	var locations []Location
+	var errors []error
+
+	if len(track.When) != len(track.Coord) {
+		errors = append(errors, fmt.Errorf("track %d: %d <when> elements but %d <gx:coord> elements",
+			trackNum, len(track.When), len(track.Coord)))
+	}
+
+	n := min(len(track.When), len(track.Coord))
+	for i := 0; i < n; i++ {
+		t, err := parseKMLTime(track.When[i])
+		if err != nil {
+			errors = append(errors, fmt.Errorf("track %d point %d: %w", trackNum, i, err))
+			continue
+		}
+
+		// gx:coord is space-separated "lon lat [alt]"
+		loc, err := parseKMLCoord(strings.Fields(track.Coord[i]))
+		if err != nil {
+			errors = append(errors, fmt.Errorf("track %d point %d: %w", trackNum, i, err))
+			continue
+		}
+		loc.Timestamp = t.Unix()
+		locations = append(locations, loc)
+	}
+
+	return locations, errors
+}
+
+// kmlLineStringLocations converts a LineString into locations, spreading
+// timestamps evenly across the Placemark's TimeSpan
+func kmlLineStringLocations(line kmlLineString, span *kmlTimeSpan, lineNum int) ([]Location, []error) {
+	tuples := strings.Fields(line.Coordinates)
+	if len(tuples) == 0 {
+		return nil, nil
+	}
+
+	if span == nil || span.Begin == "" || span.End == "" {
+		return nil, []error{fmt.Errorf("linestring %d: no timestamps (LineString requires a Placemark <TimeSpan> with begin and end)", lineNum)}
+	}
+	begin, err := parseKMLTime(span.Begin)
+	if err != nil {
+		return nil, []error{fmt.Errorf("linestring %d: invalid TimeSpan begin: %w", lineNum, err)}
+	}
+	end, err := parseKMLTime(span.End)
+	if err != nil {
+		return nil, []error{fmt.Errorf("linestring %d: invalid TimeSpan end: %w", lineNum, err)}
+	}
+	if end.Before(begin) {
+		return nil, []error{fmt.Errorf("linestring %d: TimeSpan end is before begin", lineNum)}
+	}
+
+	var locations []Location
+	var errors []error
+
+	// Evenly space points from begin to end (inclusive)
+	var step float64
+	if len(tuples) > 1 {
+		step = float64(end.Unix()-begin.Unix()) / float64(len(tuples)-1)
+	}
+
+	for i, tuple := range tuples {
+		// coordinates tuples are comma-separated "lon,lat[,alt]"
+		loc, err := parseKMLCoord(strings.Split(tuple, ","))
+		if err != nil {
+			errors = append(errors, fmt.Errorf("linestring %d point %d: %w", lineNum, i, err))
+			continue
+		}
+		loc.Timestamp = begin.Unix() + int64(float64(i)*step)
+		locations = append(locations, loc)
+	}
+
+	return locations, errors
+}
+
+// parseKMLCoord parses lon, lat and optional altitude components
+func parseKMLCoord(parts []string) (Location, error) {
+	if len(parts) < 2 {
+		return Location{}, fmt.Errorf("invalid coordinate %q", strings.Join(parts, " "))
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid longitude: %w", err)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid latitude: %w", err)
+	}
+	if err := validateCoords(lat, lon); err != nil {
+		return Location{}, err
+	}
+
+	src := "kml"
+	loc := Location{
+		Lat:    lat,
+		Lon:    lon,
+		Source: &src,
+	}
+
+	if len(parts) >= 3 {
+		if alt, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64); err == nil && alt != 0 {
+			loc.AltitudeM = &alt
+		}
+	}
+
+	return loc, nil
+}
+
+// parseKMLTime parses an xsd:dateTime as used by KML <when>, <begin> and <end>
+func parseKMLTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
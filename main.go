@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout bounds how long in-flight requests and import jobs get to wind down
+const shutdownTimeout = 30 * time.Second
+
 //go:embed index.html
 var indexHTML []byte
 
@@ -18,37 +27,99 @@ func main() {
 	configPath := flag.String("config", "", "config file path (default: ~/.config/whence/config.yaml)")
 	flag.Parse()
 
+	// SIGINT/SIGTERM start a graceful shutdown; a second signal kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Load config
 	cfg, err := LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
 
-	// Override default user from config if set
-	if cfg != nil && cfg.DefaultUser != "" {
+	// Settings given as flags win over the environment and config file
+	flagSet := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { flagSet[f.Name] = true })
+	if v := cfg.ListenAddr(); v != "" && !flagSet["addr"] {
+		*addr = v
+	}
+	if v := cfg.DBPath(); v != "" && !flagSet["db"] {
+		*dbPath = v
+	}
+	if cfg != nil && cfg.DefaultUser != "" && !flagSet["user"] {
 		*defaultUser = cfg.DefaultUser
 	}
 
-	db, err := OpenDB(*dbPath)
+	db, err := OpenDB(*dbPath, cfg.DBOptions())
 	if err != nil {
 		log.Fatalf("failed to open database: %v", err)
 	}
 	defer db.Close()
 
+	// Jobs still marked running were cut off when the previous process exited
+	if n, err := db.MarkInterruptedImportJobs(); err != nil {
+		log.Printf("failed to mark interrupted import jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("marked %d import jobs as interrupted", n)
+	}
+
+	// Prune old raw locations, if retention is configured
+	rawRetention, err := cfg.RawRetention()
+	if err != nil {
+		log.Fatalf("failed to configure retention: %v", err)
+	}
+	if rawRetention > 0 {
+		StartRetention(db, rawRetention)
+	}
+
+	importBatchSize, err := cfg.ImportBatchSize()
+	if err != nil {
+		log.Fatalf("failed to configure imports: %v", err)
+	}
+
 	// Initialize templates
 	templates := NewTemplates()
 
 	// Initialize geocoding service
-	geocoder := NewGeocodingService(db)
+	provider, err := NewGeocoderFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to configure geocoding: %v", err)
+	}
+	geocoder := NewGeocodingService(db, provider, cfg.GeocodingRateLimit(), cfg.GeocodingCacheTTL(), cfg.GeocodingLanguage())
+
+	// Drop expired geocache entries so the table doesn't grow without bound
+	if ttl := cfg.GeocodingCacheTTL(); ttl > 0 {
+		if pruned, err := db.PruneGeocache(ttl); err != nil {
+			log.Printf("failed to prune geocache: %v", err)
+		} else if pruned > 0 {
+			log.Printf("pruned %d expired geocache entries", pruned)
+		}
+	}
+
+	// Ended by srv.Shutdown so SSE streams close, while other in-flight requests drain
+	closing, closeStreams := context.WithCancel(context.Background())
 
 	server := &Server{
 		db:            db,
+		config:        cfg,
 		defaultUserID: *defaultUser,
 		geocoder:      geocoder,
+		live:          NewLocationBroadcaster(),
+		fileImports:   NewFileImportManager(db, importBatchSize, cfg.ImportProgressInterval()),
+		places:        NewSignificantPlacesCache(db, cfg.SignificantPlaceOptions()),
+		webhooks:      NewWebhookDispatcher(cfg.WebhookConfigs()),
+		closing:       closing,
+	}
+	if rate, burst, ok := cfg.IngestRateLimit(); ok {
+		server.ingestLimiter = NewDeviceRateLimiter(rate, burst)
 	}
 
 	// Initialize Immich handlers
 	immichHandlers := NewImmichHandlers(cfg, db, templates)
+	immichHandlers.closing = closing
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
@@ -63,23 +134,58 @@ func main() {
 	http.HandleFunc("/import", immichHandlers.HandleImportPage)
 
 	// Existing endpoints
-	http.HandleFunc("/owntracks", server.handleOwnTracks)
-	http.HandleFunc("/gpslogger", server.handleGPSLogger)
+	http.HandleFunc("/owntracks", server.requireAuth(server.handleOwnTracks))
+	http.HandleFunc("/gpslogger", server.requireAuth(server.handleGPSLogger))
+	http.HandleFunc("/traccar", server.requireAuth(server.handleTraccar))
+	http.HandleFunc("/overland", server.requireAuth(server.handleOverland))
+	http.HandleFunc("/homeassistant", server.requireAuth(server.handleHomeAssistant))
 	http.HandleFunc("/api/paths", server.handleAPIPaths)
+	http.HandleFunc("/api/paths/", server.handleAPIPathPoints)
 	http.HandleFunc("/api/paths/rebuild", server.handleAPIPathsRebuild)
+	http.HandleFunc("/api/tiles/", server.handleAPITile)
 	http.HandleFunc("/api/bounds", server.handleAPIBounds)
+	http.HandleFunc("/api/bounds/all", server.handleAPIBoundsAll)
 	http.HandleFunc("/api/latest", server.handleAPILatest)
+	http.HandleFunc("/api/users", server.handleAPIUsers)
+	http.HandleFunc("/api/devices", server.handleAPIDevices)
+	http.HandleFunc("/api/devices/meta", server.handleAPIDevicesMeta)
 	http.HandleFunc("/api/location/source", server.handleAPILocationSource)
+	http.HandleFunc("/api/locations", server.requireAuth(server.handleAPILocations))
 	http.HandleFunc("/api/photos", server.handleAPIPhotos)
+	http.HandleFunc("/api/heatmap", server.handleAPIHeatmap)
 	http.HandleFunc("/api/timeline", server.handleAPITimeline)
+	http.HandleFunc("/api/summary", server.handleAPISummary)
+	http.HandleFunc("/api/stays", server.handleAPIStays)
+	http.HandleFunc("/api/stats", server.handleAPIStats)
+	http.HandleFunc("/api/trips", server.handleAPITrips)
+	http.HandleFunc("/api/altitude", server.handleAPIAltitude)
+	http.HandleFunc("/api/speed", server.handleAPISpeed)
+	http.HandleFunc("/api/geocode/search", server.handleAPIGeocodeSearch)
+	http.HandleFunc("/api/geocode/reverse", server.handleAPIGeocodeReverse)
+	http.HandleFunc("/api/places/significant", server.handleAPISignificantPlaces)
+	http.HandleFunc("/api/geofence/events", server.handleAPIGeofenceEvents)
+	http.HandleFunc("/api/geofences", server.requireAuth(server.handleAPIGeofences))
+	http.HandleFunc("/api/places/label", server.requireAuth(server.handleAPIPlaceLabel))
+	http.HandleFunc("/api/stream/location", server.handleAPIStreamLocation)
 	http.HandleFunc("/api/import/timeline", server.handleImportTimeline)
+	http.HandleFunc("/api/import/kml", server.handleImportKML)
+	http.HandleFunc("/api/import/takeout", server.handleImportTakeout)
+	http.HandleFunc("/api/import/owntracks", server.handleImportOwnTracks)
+	http.HandleFunc("/api/import/jobs/", server.handleImportJobStream)
+	http.HandleFunc("/api/import/", server.handleImportCancel)
+	http.HandleFunc("/api/export/geojson", server.handleExportGeoJSON)
+	http.HandleFunc("/api/export/gpx", server.handleExportGPX)
+	http.HandleFunc("/api/export/csv", server.handleExportCSV)
+	http.HandleFunc("/api/admin/backup", server.requireAuth(server.handleAPIBackup))
 
 	// Immich endpoints
 	http.HandleFunc("/api/immich/status", immichHandlers.HandleStatus)
 	http.HandleFunc("/api/immich/preview/start", immichHandlers.HandlePreviewStart)
 	http.HandleFunc("/api/immich/preview", immichHandlers.HandlePreview)
+	http.HandleFunc("/api/immich/preview.json", immichHandlers.HandlePreviewJSON)
 	http.HandleFunc("/api/immich/import", immichHandlers.HandleImport)
 	http.HandleFunc("/api/immich/jobs", immichHandlers.HandleJobs)
+	http.HandleFunc("/api/immich/jobs.json", immichHandlers.HandleJobsJSON)
 	http.HandleFunc("/api/immich/jobs/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 		// Route based on path suffix
@@ -93,18 +199,60 @@ func main() {
 			immichHandlers.HandleJob(w, r)
 		}
 	})
-	http.HandleFunc("/api/immich/assets/", immichHandlers.HandleThumbnail)
+	http.HandleFunc("/api/immich/assets/", immichHandlers.HandleAsset)
 	http.HandleFunc("/api/immich/sync", immichHandlers.HandleSync)
 	http.HandleFunc("/api/immich/sync/status", immichHandlers.HandleSyncStatus)
 
 	if cfg != nil && cfg.ImmichConfigured() {
 		log.Printf("Immich configured: %s", cfg.Immich.URL)
+		if cfg.SyncEnabled() {
+			interval := cfg.SyncInterval()
+			log.Printf("Immich sync every %s", interval)
+			go immichHandlers.manager.RunSync(ctx, *defaultUser, interval)
+		}
 	} else {
 		log.Printf("Immich not configured (add immich section to config file)")
 	}
 
-	log.Printf("starting server on %s", *addr)
-	if err := http.ListenAndServe(*addr, nil); err != nil {
+	var handler http.Handler = http.DefaultServeMux
+	if cfg.AccessLogEnabled() {
+		handler = accessLog(handler)
+	}
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: handler,
+	}
+	srv.RegisterOnShutdown(closeStreams)
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("starting server on %s", *addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
 		log.Fatalf("server error: %v", err)
+	case <-ctx.Done():
+	}
+	stop() // Restore default signal handling so a second signal exits immediately
+
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("http shutdown: %v", err)
+	}
+	// Interrupted jobs are resumable from their last checkpoint after restart
+	if immichHandlers.manager != nil {
+		if err := immichHandlers.manager.Shutdown(shutdownCtx); err != nil {
+			log.Printf("import jobs did not stop in time: %v", err)
+		}
+	}
+	// File imports stop after their current batch, before the database closes
+	if err := server.fileImports.Shutdown(shutdownCtx); err != nil {
+		log.Printf("file import jobs did not stop in time: %v", err)
 	}
+	log.Printf("shutdown complete")
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"database/sql"
 	"embed"
+	"errors"
+	"fmt"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite"
@@ -12,6 +14,10 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// runMigrations applies pending migrations from migrations/NNN_name.{up,down}.sql.
+// golang-migrate records the applied version in schema_migrations and runs each
+// file in its own transaction, so startup is a no-op once the schema is current
+// and new migrations only need a new file with the next version number.
 func runMigrations(db *sql.DB) error {
 	source, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
@@ -29,6 +35,10 @@ func runMigrations(db *sql.DB) error {
 	}
 
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		var dirty migrate.ErrDirty
+		if errors.As(err, &dirty) {
+			return fmt.Errorf("schema is dirty at version %d after a failed migration; repair it and reset the dirty flag in schema_migrations: %w", dirty.Version, err)
+		}
 		return err
 	}
 	return nil
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// schemaSnapshot returns the schema version and the SQL of every schema object
+func schemaSnapshot(t *testing.T, db *DB) (int, []string) {
+	t.Helper()
+	var version int
+	var dirty bool
+	if err := db.QueryRow(`SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty); err != nil {
+		t.Fatalf("read schema_migrations: %v", err)
+	}
+	if dirty {
+		t.Fatalf("schema is dirty at version %d", version)
+	}
+
+	rows, err := db.Query(`SELECT type || ' ' || name || ': ' || COALESCE(sql, '') FROM sqlite_master ORDER BY type, name`)
+	if err != nil {
+		t.Fatalf("read sqlite_master: %v", err)
+	}
+	defer rows.Close()
+	var schema []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatalf("scan sqlite_master: %v", err)
+		}
+		schema = append(schema, s)
+	}
+	return version, schema
+}
+
+func TestMigrationsRerun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "whence.db")
+	db, err := OpenDB(path, (*Config)(nil).DBOptions())
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	version, schema := schemaSnapshot(t, db)
+
+	// Running again on the same connection is a no-op
+	if err := runMigrations(db.DB); err != nil {
+		t.Fatalf("second runMigrations: %v", err)
+	}
+	if v, s := schemaSnapshot(t, db); v != version || !slices.Equal(s, schema) {
+		t.Errorf("schema changed after rerunning migrations: version %d -> %d", version, v)
+	}
+	db.Close()
+
+	// So is reopening the database
+	db, err = OpenDB(path, (*Config)(nil).DBOptions())
+	if err != nil {
+		t.Fatalf("reopen OpenDB: %v", err)
+	}
+	defer db.Close()
+	if v, s := schemaSnapshot(t, db); v != version || !slices.Equal(s, schema) {
+		t.Errorf("schema changed after reopening: version %d -> %d", version, v)
+	}
+}
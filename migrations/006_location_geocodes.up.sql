@@ -0,0 +1,11 @@
+-- Permanent place names for timeline stop centroids
+-- Keyed by lat/lon rounded to a ~10m grid (value * 10000) so repeat views resolve instantly
+CREATE TABLE IF NOT EXISTS location_geocodes (
+    lat_key INTEGER NOT NULL,
+    lon_key INTEGER NOT NULL,
+    place_name TEXT NOT NULL,
+    place_type TEXT,
+    display_name TEXT,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (lat_key, lon_key)
+);
@@ -0,0 +1,6 @@
+-- Checkpoint Immich's opaque nextPage token instead of a sequential page number
+ALTER TABLE import_jobs ADD COLUMN next_page_token TEXT;
+
+-- Carry resumable jobs over: Immich tokens are the stringified next page number
+UPDATE import_jobs SET next_page_token = CAST(last_page + 1 AS TEXT)
+WHERE last_page > 0 AND status IN ('interrupted', 'failed');
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS paths_rtree_delete;
+DROP TRIGGER IF EXISTS paths_rtree_update;
+DROP TRIGGER IF EXISTS paths_rtree_insert;
+DROP TABLE IF EXISTS paths_rtree;
+
+DROP TRIGGER IF EXISTS locations_rtree_delete;
+DROP TRIGGER IF EXISTS locations_rtree_update;
+DROP TRIGGER IF EXISTS locations_rtree_insert;
+DROP TABLE IF EXISTS locations_rtree;
+DROP TABLE IF EXISTS locations_rtree_keys;
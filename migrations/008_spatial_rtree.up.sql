@@ -0,0 +1,74 @@
+-- R*Tree spatial indexes for bounding box queries.
+-- The lat/lon B-tree index only narrows on lat, so wide-lon viewports scan.
+
+-- locations is WITHOUT ROWID, but R*Tree entries need an integer id,
+-- so map each (timestamp, device_id) key to a stable integer
+CREATE TABLE IF NOT EXISTS locations_rtree_keys (
+    id        INTEGER PRIMARY KEY,
+    timestamp INTEGER NOT NULL,
+    device_id TEXT NOT NULL,
+    UNIQUE(timestamp, device_id)
+);
+
+-- Points are stored as degenerate boxes (min = max). R*Tree uses 32-bit floats
+-- rounded outward, so queries must still filter on the exact lat/lon.
+CREATE VIRTUAL TABLE IF NOT EXISTS locations_rtree USING rtree(
+    id,
+    min_lat, max_lat,
+    min_lon, max_lon
+);
+
+INSERT INTO locations_rtree_keys (timestamp, device_id)
+SELECT timestamp, device_id FROM locations;
+
+INSERT INTO locations_rtree (id, min_lat, max_lat, min_lon, max_lon)
+SELECT k.id, l.lat, l.lat, l.lon, l.lon
+FROM locations_rtree_keys k
+JOIN locations l ON l.timestamp = k.timestamp AND l.device_id = k.device_id;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_insert AFTER INSERT ON locations
+BEGIN
+    INSERT INTO locations_rtree_keys (timestamp, device_id) VALUES (new.timestamp, new.device_id);
+    INSERT INTO locations_rtree (id, min_lat, max_lat, min_lon, max_lon)
+    VALUES (last_insert_rowid(), new.lat, new.lat, new.lon, new.lon);
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_update AFTER UPDATE OF lat, lon ON locations
+BEGIN
+    UPDATE locations_rtree SET min_lat = new.lat, max_lat = new.lat, min_lon = new.lon, max_lon = new.lon
+    WHERE id = (SELECT id FROM locations_rtree_keys WHERE timestamp = new.timestamp AND device_id = new.device_id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_delete AFTER DELETE ON locations
+BEGIN
+    DELETE FROM locations_rtree
+    WHERE id = (SELECT id FROM locations_rtree_keys WHERE timestamp = old.timestamp AND device_id = old.device_id);
+    DELETE FROM locations_rtree_keys WHERE timestamp = old.timestamp AND device_id = old.device_id;
+END;
+
+-- paths has an integer primary key, so its R*Tree shares the id directly
+CREATE VIRTUAL TABLE IF NOT EXISTS paths_rtree USING rtree(
+    id,
+    min_lat, max_lat,
+    min_lon, max_lon
+);
+
+INSERT INTO paths_rtree (id, min_lat, max_lat, min_lon, max_lon)
+SELECT id, min_lat, max_lat, min_lon, max_lon FROM paths;
+
+CREATE TRIGGER IF NOT EXISTS paths_rtree_insert AFTER INSERT ON paths
+BEGIN
+    INSERT INTO paths_rtree (id, min_lat, max_lat, min_lon, max_lon)
+    VALUES (new.id, new.min_lat, new.max_lat, new.min_lon, new.max_lon);
+END;
+
+CREATE TRIGGER IF NOT EXISTS paths_rtree_update AFTER UPDATE OF min_lat, max_lat, min_lon, max_lon ON paths
+BEGIN
+    UPDATE paths_rtree SET min_lat = new.min_lat, max_lat = new.max_lat, min_lon = new.min_lon, max_lon = new.max_lon
+    WHERE id = new.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS paths_rtree_delete AFTER DELETE ON paths
+BEGIN
+    DELETE FROM paths_rtree WHERE id = old.id;
+END;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_import_jobs_source;
+ALTER TABLE import_jobs DROP COLUMN source;
@@ -0,0 +1,4 @@
+-- File imports (timeline, KML) are tracked as import jobs alongside Immich imports
+ALTER TABLE import_jobs ADD COLUMN source TEXT NOT NULL DEFAULT 'immich';
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_source ON import_jobs(source);
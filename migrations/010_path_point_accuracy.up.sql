@@ -0,0 +1,3 @@
+-- Carry GPS accuracy into path points so simplification can drop imprecise fixes.
+-- Existing points stay NULL (never filtered) until their paths are rebuilt.
+ALTER TABLE path_points ADD COLUMN accuracy_m REAL;
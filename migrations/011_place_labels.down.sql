@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_place_labels_user_bbox;
+DROP TABLE IF EXISTS place_labels;
@@ -0,0 +1,18 @@
+-- User-defined names for places, taking priority over reverse geocoding
+-- The bounding box of the label's circle enables indexed lookups; the exact
+-- radius check is done in Go
+CREATE TABLE IF NOT EXISTS place_labels (
+    id INTEGER PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    label TEXT NOT NULL,
+    lat REAL NOT NULL,
+    lon REAL NOT NULL,
+    radius_m REAL NOT NULL,
+    min_lat REAL NOT NULL,
+    max_lat REAL NOT NULL,
+    min_lon REAL NOT NULL,
+    max_lon REAL NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_place_labels_user_bbox ON place_labels(user_id, min_lat, max_lat, min_lon, max_lon);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_geofence_events_user_time;
+DROP TABLE IF EXISTS geofence_events;
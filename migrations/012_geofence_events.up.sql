@@ -0,0 +1,15 @@
+-- Geofence enter/leave transitions, e.g. from OwnTracks region monitoring
+CREATE TABLE IF NOT EXISTS geofence_events (
+    id        INTEGER PRIMARY KEY,
+    timestamp INTEGER NOT NULL,
+    user_id   TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    region    TEXT NOT NULL,       -- Region description
+    event     TEXT NOT NULL,       -- 'enter' or 'leave'
+    lat       REAL NOT NULL,
+    lon       REAL NOT NULL,
+    source    TEXT NOT NULL,       -- 'owntracks'
+    UNIQUE(timestamp, device_id, region, event)
+);
+
+CREATE INDEX IF NOT EXISTS idx_geofence_events_user_time ON geofence_events(user_id, timestamp);
@@ -0,0 +1,3 @@
+ALTER TABLE geofence_events DROP COLUMN geofence_id;
+DROP INDEX IF EXISTS idx_geofences_user;
+DROP TABLE IF EXISTS geofences;
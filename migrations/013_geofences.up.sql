@@ -0,0 +1,19 @@
+-- Server-side geofences, evaluated against every ingested point
+-- inside/state_ts hold the last known state so transitions can be detected
+CREATE TABLE IF NOT EXISTS geofences (
+    id         INTEGER PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    lat        REAL NOT NULL,
+    lon        REAL NOT NULL,
+    radius_m   REAL NOT NULL,
+    active     INTEGER NOT NULL DEFAULT 1,
+    inside     INTEGER,                -- NULL until the first point is evaluated
+    state_ts   INTEGER,                -- Timestamp of the point that set inside
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_geofences_user ON geofences(user_id, active);
+
+-- Links server-side transitions to their geofence (NULL for OwnTracks events)
+ALTER TABLE geofence_events ADD COLUMN geofence_id INTEGER;
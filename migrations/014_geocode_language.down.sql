@@ -0,0 +1,33 @@
+-- Keep only names fetched without a language, matching the old single-language keys
+CREATE TABLE location_geocodes_old (
+    lat_key INTEGER NOT NULL,
+    lon_key INTEGER NOT NULL,
+    place_name TEXT NOT NULL,
+    place_type TEXT,
+    display_name TEXT,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (lat_key, lon_key)
+);
+INSERT INTO location_geocodes_old (lat_key, lon_key, place_name, place_type, display_name, created_at)
+    SELECT lat_key, lon_key, place_name, place_type, display_name, created_at FROM location_geocodes WHERE language = '';
+DROP TABLE location_geocodes;
+ALTER TABLE location_geocodes_old RENAME TO location_geocodes;
+
+CREATE TABLE geocache_old (
+    id INTEGER PRIMARY KEY,
+    min_lat REAL NOT NULL,
+    max_lat REAL NOT NULL,
+    min_lon REAL NOT NULL,
+    max_lon REAL NOT NULL,
+    place_name TEXT NOT NULL,
+    place_type TEXT,
+    display_name TEXT,
+    created_at INTEGER NOT NULL,
+    UNIQUE(min_lat, max_lat, min_lon, max_lon)
+);
+INSERT INTO geocache_old (id, min_lat, max_lat, min_lon, max_lon, place_name, place_type, display_name, created_at)
+    SELECT id, min_lat, max_lat, min_lon, max_lon, place_name, place_type, display_name, created_at FROM geocache WHERE language = '';
+DROP INDEX IF EXISTS idx_geocache_bbox;
+DROP TABLE geocache;
+ALTER TABLE geocache_old RENAME TO geocache;
+CREATE INDEX IF NOT EXISTS idx_geocache_bbox ON geocache(min_lat, max_lat, min_lon, max_lon);
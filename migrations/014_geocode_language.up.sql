@@ -0,0 +1,36 @@
+-- Cached place names are per language, so changing geocoding.language never serves
+-- names in the wrong script. Existing rows were fetched without a language ('').
+CREATE TABLE location_geocodes_new (
+    lat_key INTEGER NOT NULL,
+    lon_key INTEGER NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    place_name TEXT NOT NULL,
+    place_type TEXT,
+    display_name TEXT,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (lat_key, lon_key, language)
+);
+INSERT INTO location_geocodes_new (lat_key, lon_key, language, place_name, place_type, display_name, created_at)
+    SELECT lat_key, lon_key, '', place_name, place_type, display_name, created_at FROM location_geocodes;
+DROP TABLE location_geocodes;
+ALTER TABLE location_geocodes_new RENAME TO location_geocodes;
+
+CREATE TABLE geocache_new (
+    id INTEGER PRIMARY KEY,
+    min_lat REAL NOT NULL,
+    max_lat REAL NOT NULL,
+    min_lon REAL NOT NULL,
+    max_lon REAL NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    place_name TEXT NOT NULL,
+    place_type TEXT,
+    display_name TEXT,
+    created_at INTEGER NOT NULL,
+    UNIQUE(min_lat, max_lat, min_lon, max_lon, language)
+);
+INSERT INTO geocache_new (id, min_lat, max_lat, min_lon, max_lon, language, place_name, place_type, display_name, created_at)
+    SELECT id, min_lat, max_lat, min_lon, max_lon, '', place_name, place_type, display_name, created_at FROM geocache;
+DROP INDEX IF EXISTS idx_geocache_bbox;
+DROP TABLE geocache;
+ALTER TABLE geocache_new RENAME TO geocache;
+CREATE INDEX IF NOT EXISTS idx_geocache_bbox ON geocache(min_lat, max_lat, min_lon, max_lon);
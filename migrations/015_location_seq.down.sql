@@ -0,0 +1,74 @@
+-- Tie-broken rows (seq > 0) can't be represented without seq and are dropped
+
+DROP TRIGGER IF EXISTS locations_rtree_insert;
+DROP TRIGGER IF EXISTS locations_rtree_update;
+DROP TRIGGER IF EXISTS locations_rtree_delete;
+
+DELETE FROM locations_rtree WHERE id IN (SELECT id FROM locations_rtree_keys WHERE seq > 0);
+
+CREATE TABLE locations_rtree_keys_old (
+    id        INTEGER PRIMARY KEY,
+    timestamp INTEGER NOT NULL,
+    device_id TEXT NOT NULL,
+    UNIQUE(timestamp, device_id)
+);
+INSERT INTO locations_rtree_keys_old (id, timestamp, device_id)
+    SELECT id, timestamp, device_id FROM locations_rtree_keys WHERE seq = 0;
+DROP TABLE locations_rtree_keys;
+ALTER TABLE locations_rtree_keys_old RENAME TO locations_rtree_keys;
+
+CREATE TABLE locations_old (
+    timestamp  INTEGER NOT NULL,
+    user_id    TEXT NOT NULL,
+    device_id  TEXT NOT NULL,
+    lat        REAL NOT NULL,
+    lon        REAL NOT NULL,
+    altitude_m REAL,
+    accuracy_m REAL,
+    speed_kmh  REAL,
+    source     TEXT,
+    PRIMARY KEY (timestamp, device_id)
+) WITHOUT ROWID;
+INSERT INTO locations_old (timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source)
+    SELECT timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations WHERE seq = 0;
+DROP INDEX IF EXISTS idx_locations_lat_lon;
+DROP INDEX IF EXISTS idx_locations_timestamp;
+DROP TABLE locations;
+ALTER TABLE locations_old RENAME TO locations;
+CREATE INDEX IF NOT EXISTS idx_locations_lat_lon ON locations(lat, lon);
+CREATE INDEX IF NOT EXISTS idx_locations_timestamp ON locations(timestamp);
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_insert AFTER INSERT ON locations
+BEGIN
+    INSERT INTO locations_rtree_keys (timestamp, device_id) VALUES (new.timestamp, new.device_id);
+    INSERT INTO locations_rtree (id, min_lat, max_lat, min_lon, max_lon)
+    VALUES (last_insert_rowid(), new.lat, new.lat, new.lon, new.lon);
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_update AFTER UPDATE OF lat, lon ON locations
+BEGIN
+    UPDATE locations_rtree SET min_lat = new.lat, max_lat = new.lat, min_lon = new.lon, max_lon = new.lon
+    WHERE id = (SELECT id FROM locations_rtree_keys WHERE timestamp = new.timestamp AND device_id = new.device_id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_delete AFTER DELETE ON locations
+BEGIN
+    DELETE FROM locations_rtree
+    WHERE id = (SELECT id FROM locations_rtree_keys WHERE timestamp = old.timestamp AND device_id = old.device_id);
+    DELETE FROM locations_rtree_keys WHERE timestamp = old.timestamp AND device_id = old.device_id;
+END;
+
+CREATE TABLE location_sources_old (
+    timestamp   INTEGER NOT NULL,
+    device_id   TEXT NOT NULL,
+    source_type TEXT NOT NULL,
+    source_id   TEXT NOT NULL,
+    metadata    TEXT,
+    PRIMARY KEY (timestamp, device_id)
+);
+INSERT OR IGNORE INTO location_sources_old (timestamp, device_id, source_type, source_id, metadata)
+    SELECT timestamp, device_id, source_type, source_id, metadata FROM location_sources WHERE seq = 0;
+DROP INDEX IF EXISTS idx_location_sources_location;
+DROP TABLE location_sources;
+ALTER TABLE location_sources_old RENAME TO location_sources;
+CREATE INDEX IF NOT EXISTS idx_location_sources_source ON location_sources(source_type, source_id);
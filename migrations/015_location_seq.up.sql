@@ -0,0 +1,78 @@
+-- Distinct photos from one camera can share a (timestamp, device_id). seq breaks the tie:
+-- tracker points always use 0 (so their duplicates are still ignored), while each new
+-- Immich asset takes the next free seq. location_sources is keyed by the asset itself.
+
+DROP TRIGGER IF EXISTS locations_rtree_insert;
+DROP TRIGGER IF EXISTS locations_rtree_update;
+DROP TRIGGER IF EXISTS locations_rtree_delete;
+
+CREATE TABLE locations_new (
+    timestamp  INTEGER NOT NULL,
+    user_id    TEXT NOT NULL,
+    device_id  TEXT NOT NULL,
+    seq        INTEGER NOT NULL DEFAULT 0,
+    lat        REAL NOT NULL,
+    lon        REAL NOT NULL,
+    altitude_m REAL,
+    accuracy_m REAL,
+    speed_kmh  REAL,
+    source     TEXT,
+    PRIMARY KEY (timestamp, device_id, seq)
+) WITHOUT ROWID;
+INSERT INTO locations_new (timestamp, user_id, device_id, seq, lat, lon, altitude_m, accuracy_m, speed_kmh, source)
+    SELECT timestamp, user_id, device_id, 0, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations;
+DROP INDEX IF EXISTS idx_locations_lat_lon;
+DROP INDEX IF EXISTS idx_locations_timestamp;
+DROP TABLE locations;
+ALTER TABLE locations_new RENAME TO locations;
+CREATE INDEX IF NOT EXISTS idx_locations_lat_lon ON locations(lat, lon);
+CREATE INDEX IF NOT EXISTS idx_locations_timestamp ON locations(timestamp);
+
+-- Keep the R*Tree ids, just widen the key they map to
+CREATE TABLE locations_rtree_keys_new (
+    id        INTEGER PRIMARY KEY,
+    timestamp INTEGER NOT NULL,
+    device_id TEXT NOT NULL,
+    seq       INTEGER NOT NULL DEFAULT 0,
+    UNIQUE(timestamp, device_id, seq)
+);
+INSERT INTO locations_rtree_keys_new (id, timestamp, device_id, seq)
+    SELECT id, timestamp, device_id, 0 FROM locations_rtree_keys;
+DROP TABLE locations_rtree_keys;
+ALTER TABLE locations_rtree_keys_new RENAME TO locations_rtree_keys;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_insert AFTER INSERT ON locations
+BEGIN
+    INSERT INTO locations_rtree_keys (timestamp, device_id, seq) VALUES (new.timestamp, new.device_id, new.seq);
+    INSERT INTO locations_rtree (id, min_lat, max_lat, min_lon, max_lon)
+    VALUES (last_insert_rowid(), new.lat, new.lat, new.lon, new.lon);
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_update AFTER UPDATE OF lat, lon ON locations
+BEGIN
+    UPDATE locations_rtree SET min_lat = new.lat, max_lat = new.lat, min_lon = new.lon, max_lon = new.lon
+    WHERE id = (SELECT id FROM locations_rtree_keys WHERE timestamp = new.timestamp AND device_id = new.device_id AND seq = new.seq);
+END;
+
+CREATE TRIGGER IF NOT EXISTS locations_rtree_delete AFTER DELETE ON locations
+BEGIN
+    DELETE FROM locations_rtree
+    WHERE id = (SELECT id FROM locations_rtree_keys WHERE timestamp = old.timestamp AND device_id = old.device_id AND seq = old.seq);
+    DELETE FROM locations_rtree_keys WHERE timestamp = old.timestamp AND device_id = old.device_id AND seq = old.seq;
+END;
+
+CREATE TABLE location_sources_new (
+    timestamp   INTEGER NOT NULL,
+    device_id   TEXT NOT NULL,
+    seq         INTEGER NOT NULL DEFAULT 0,
+    source_type TEXT NOT NULL,       -- 'immich'
+    source_id   TEXT NOT NULL,       -- Immich asset UUID
+    metadata    TEXT,                -- JSON: filename, dimensions, etc.
+    PRIMARY KEY (source_type, source_id)
+);
+INSERT OR IGNORE INTO location_sources_new (timestamp, device_id, seq, source_type, source_id, metadata)
+    SELECT timestamp, device_id, 0, source_type, source_id, metadata FROM location_sources;
+DROP INDEX IF EXISTS idx_location_sources_source;
+DROP TABLE location_sources;
+ALTER TABLE location_sources_new RENAME TO location_sources;
+CREATE INDEX IF NOT EXISTS idx_location_sources_location ON location_sources(timestamp, device_id, seq);
@@ -0,0 +1 @@
+ALTER TABLE path_points DROP COLUMN source;
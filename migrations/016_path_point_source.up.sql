@@ -0,0 +1,3 @@
+-- Carry the location source (GPS/WIFI/CELL, or the ingesting app) into path points
+-- so paths can be filtered by it. Existing points stay NULL until their paths are rebuilt.
+ALTER TABLE path_points ADD COLUMN source TEXT;
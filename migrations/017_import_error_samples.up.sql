@@ -0,0 +1,2 @@
+-- JSON array of the first per-row error reasons, so imports can explain what they dropped
+ALTER TABLE import_jobs ADD COLUMN error_samples TEXT;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_locations_user_timestamp;
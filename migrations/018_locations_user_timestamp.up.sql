@@ -0,0 +1,2 @@
+-- Supports per-user time lookups such as NearestLocation
+CREATE INDEX IF NOT EXISTS idx_locations_user_timestamp ON locations(user_id, timestamp);
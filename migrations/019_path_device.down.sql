@@ -0,0 +1 @@
+ALTER TABLE paths DROP COLUMN device_id;
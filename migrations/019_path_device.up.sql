@@ -0,0 +1,3 @@
+-- Device that recorded most of a path's points, so paths can be colored per device.
+-- Existing paths stay NULL until they are rebuilt.
+ALTER TABLE paths ADD COLUMN device_id TEXT;
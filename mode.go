@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Transportation mode speed thresholds (m/s).
+// Speeds are computed between consecutive raw points, so a winding route
+// is measured by its actual path rather than the straight-line displacement.
+const (
+	walkMaxAvgSpeed  = 2.2  // ~8 km/h: brisk walking or jogging
+	walkMaxPeakSpeed = 4.0  // ~14 km/h: short running bursts
+	cycleMaxAvgSpeed = 7.0  // ~25 km/h: typical cycling pace
+	cycleMaxPeak     = 12.0 // ~43 km/h: downhill cycling
+	transitMinPeak   = 36.0 // ~130 km/h: faster than road traffic, i.e. rail
+
+	// Flight requires both airliner-class speed and a large straight-line jump,
+	// since phones typically lose GPS at altitude and reappear far away.
+	flyMinSpeed = 40.0    // ~144 km/h
+	flyMinJump  = 20000.0 // meters between consecutive points
+
+	// modePeakPercentile picks the "peak" speed robustly, ignoring GPS spikes
+	modePeakPercentile = 0.9
+)
+
+// ClassifyMode infers the transportation mode of a travel segment from its raw points.
+// Returns "walk", "cycle", "drive", "transit", or "fly", or "" if there are too few points.
+func ClassifyMode(points []PathPoint) string {
+	var totalDist float64
+	var totalTime int64
+	var speeds []float64
+
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1], points[i]
+		dt := cur.Timestamp - prev.Timestamp
+		if dt <= 0 {
+			continue
+		}
+		dist := DistanceMeters(prev.Lat, prev.Lon, cur.Lat, cur.Lon)
+		speed := dist / float64(dt)
+
+		if speed >= flyMinSpeed && dist >= flyMinJump {
+			return "fly"
+		}
+
+		totalDist += dist
+		totalTime += dt
+		speeds = append(speeds, speed)
+	}
+
+	if totalTime == 0 {
+		return ""
+	}
+
+	avgSpeed := totalDist / float64(totalTime)
+	peakSpeed := percentile(speeds, modePeakPercentile)
+
+	switch {
+	case avgSpeed <= walkMaxAvgSpeed && peakSpeed <= walkMaxPeakSpeed:
+		return "walk"
+	case avgSpeed <= cycleMaxAvgSpeed && peakSpeed <= cycleMaxPeak:
+		return "cycle"
+	case peakSpeed >= transitMinPeak:
+		return "transit"
+	default:
+		return "drive"
+	}
+}
+
+// percentile returns the p-th percentile (0-1) of values using nearest rank.
+// The input slice is sorted in place.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	idx := int(math.Ceil(p*float64(len(values)))) - 1
+	return values[max(idx, 0)]
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+// syntheticTrack returns a track heading north from London, one point every dt seconds,
+// covering each leg at the given speed (m/s)
+func syntheticTrack(dt int64, speeds ...float64) []PathPoint {
+	points := []PathPoint{{Lat: 51.5, Lon: -0.12, Timestamp: 1700000000}}
+	for _, speed := range speeds {
+		prev := points[len(points)-1]
+		points = append(points, PathPoint{
+			Lat:       prev.Lat + speed*float64(dt)/metersPerDegreeLat,
+			Lon:       prev.Lon,
+			Timestamp: prev.Timestamp + dt,
+		})
+	}
+	return points
+}
+
+// repeatSpeed returns speed n times
+func repeatSpeed(speed float64, n int) []float64 {
+	speeds := make([]float64, n)
+	for i := range speeds {
+		speeds[i] = speed
+	}
+	return speeds
+}
+
+func TestClassifyMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []PathPoint
+		want   string
+	}{
+		{"too few points", syntheticTrack(30), ""},
+		{"walk", syntheticTrack(30, repeatSpeed(1.4, 20)...), "walk"},
+		{"walk with a GPS spike", syntheticTrack(30, append(repeatSpeed(1.4, 58), 30)...), "walk"},
+		{"cycle", syntheticTrack(30, repeatSpeed(5, 20)...), "cycle"},
+		{"drive", syntheticTrack(30, append(repeatSpeed(15, 15), repeatSpeed(0, 5)...)...), "drive"},
+		{"transit", syntheticTrack(30, repeatSpeed(45, 20)...), "transit"},
+		// 500 km in an hour between two fixes
+		{"fly", syntheticTrack(3600, 139), "fly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyMode(tt.points); got != tt.want {
+				t.Errorf("ClassifyMode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
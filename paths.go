@@ -1,18 +1,45 @@
 package main
 
 import (
+	"container/heap"
 	"database/sql"
+	"errors"
 	"math"
+	"strings"
 	"time"
 )
 
 // SimplifyPath reduces the number of points using the Douglas-Peucker algorithm.
 // tolerance is in degrees - points deviating less than this from the line are removed.
+// Stay points (DurationSec > 0) summarize a whole stop, so they are kept as fixed
+// vertices and each stretch between them is simplified independently.
 func SimplifyPath(points []PathPoint, tolerance float64) []PathPoint {
 	if len(points) <= 2 {
 		return points
 	}
 
+	var result []PathPoint
+	segStart := 0
+	for i := 1; i < len(points); i++ {
+		if points[i].DurationSec == 0 && i < len(points)-1 {
+			continue
+		}
+		segment := simplifyDouglasPeucker(points[segStart:i+1], tolerance)
+		if len(result) > 0 {
+			segment = segment[1:] // Shared with the end of the previous segment
+		}
+		result = append(result, segment...)
+		segStart = i
+	}
+	return result
+}
+
+// simplifyDouglasPeucker runs Douglas-Peucker over points, always keeping both endpoints
+func simplifyDouglasPeucker(points []PathPoint, tolerance float64) []PathPoint {
+	if len(points) <= 2 {
+		return points
+	}
+
 	// Find the point with the maximum distance from the line between first and last
 	maxDist := 0.0
 	maxIdx := 0
@@ -30,8 +57,8 @@ func SimplifyPath(points []PathPoint, tolerance float64) []PathPoint {
 
 	// If max distance is greater than tolerance, recursively simplify
 	if maxDist > tolerance {
-		left := SimplifyPath(points[:maxIdx+1], tolerance)
-		right := SimplifyPath(points[maxIdx:], tolerance)
+		left := simplifyDouglasPeucker(points[:maxIdx+1], tolerance)
+		right := simplifyDouglasPeucker(points[maxIdx:], tolerance)
 
 		// Combine results, avoiding duplicate point at maxIdx
 		result := make([]PathPoint, 0, len(left)+len(right)-1)
@@ -63,6 +90,93 @@ func perpendicularDistanceDeg(point, lineStart, lineEnd PathPoint) float64 {
 	return num / den
 }
 
+// SimplifyPathVW reduces the number of points using the Visvalingam-Whyatt algorithm:
+// it repeatedly removes the point whose triangle with its neighbors has the smallest
+// area, until every remaining triangle is at least minArea (in square degrees).
+// Unlike Douglas-Peucker it removes the least significant detail first, which avoids
+// spiky results on dense tracks. Endpoints and stay points are always kept.
+func SimplifyPathVW(points []PathPoint, minArea float64) []PathPoint {
+	n := len(points)
+	if n <= 2 {
+		return points
+	}
+
+	// Remaining points form a doubly linked list over the original indices
+	prev := make([]int, n)
+	next := make([]int, n)
+	for i := range points {
+		prev[i] = i - 1
+		next[i] = i + 1
+	}
+	removed := make([]bool, n)
+	version := make([]int, n) // Bumped when a point's area changes, invalidating older heap entries
+
+	area := func(i int) float64 {
+		a, b, c := points[prev[i]], points[i], points[next[i]]
+		return math.Abs((b.Lon-a.Lon)*(c.Lat-a.Lat)-(c.Lon-a.Lon)*(b.Lat-a.Lat)) / 2
+	}
+	removable := func(i int) bool {
+		return i > 0 && i < n-1 && points[i].DurationSec == 0
+	}
+
+	h := &vwHeap{}
+	for i := 1; i < n-1; i++ {
+		if removable(i) {
+			heap.Push(h, vwEntry{idx: i, area: area(i)})
+		}
+	}
+
+	for h.Len() > 0 {
+		entry := heap.Pop(h).(vwEntry)
+		if removed[entry.idx] || entry.version != version[entry.idx] {
+			continue // Stale entry
+		}
+		if entry.area >= minArea {
+			break
+		}
+
+		i := entry.idx
+		removed[i] = true
+		p, q := prev[i], next[i]
+		next[p] = q
+		prev[q] = p
+
+		for _, neighbor := range []int{p, q} {
+			if removable(neighbor) {
+				version[neighbor]++
+				heap.Push(h, vwEntry{idx: neighbor, area: area(neighbor), version: version[neighbor]})
+			}
+		}
+	}
+
+	result := make([]PathPoint, 0, n)
+	for i := 0; i < n; i = next[i] {
+		result = append(result, points[i])
+	}
+	return result
+}
+
+// vwEntry is a candidate point for removal in SimplifyPathVW
+type vwEntry struct {
+	idx     int
+	area    float64
+	version int
+}
+
+// vwHeap is a min-heap of removal candidates ordered by triangle area
+type vwHeap []vwEntry
+
+func (h vwHeap) Len() int           { return len(h) }
+func (h vwHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h vwHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *vwHeap) Push(x any)        { *h = append(*h, x.(vwEntry)) }
+func (h *vwHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
 // StationaryCluster represents a period where the user was stationary at one location.
 // Used for timeline features and path simplification.
 type StationaryCluster struct {
@@ -82,8 +196,8 @@ type PruneResult struct {
 	Clusters []StationaryCluster `json:"clusters"`
 }
 
-// haversineMeters calculates the distance in meters between two lat/lon points.
-func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+// DistanceMeters calculates the great-circle (haversine) distance in meters between two lat/lon points.
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
 	const earthRadius = 6371000 // meters
 
 	lat1Rad := lat1 * math.Pi / 180
@@ -138,7 +252,7 @@ func PruneStationaryPoints(points []PathPoint, minDistMeters float64) PruneResul
 
 	for i := 1; i < len(points); i++ {
 		pt := points[i]
-		dist := haversineMeters(cluster.Lat, cluster.Lon, pt.Lat, pt.Lon)
+		dist := DistanceMeters(cluster.Lat, cluster.Lon, pt.Lat, pt.Lon)
 
 		if dist < minDistMeters {
 			// Point is within threshold - add to current cluster
@@ -154,11 +268,12 @@ func PruneStationaryPoints(points []PathPoint, minDistMeters float64) PruneResul
 			cluster.CentroidLat = sumLat / float64(cluster.PointCount)
 			cluster.CentroidLon = sumLon / float64(cluster.PointCount)
 
-			// Emit representative point for the cluster
+			// Emit representative point for the cluster, carrying its time span
 			result = append(result, PathPoint{
-				Lat:       cluster.CentroidLat,
-				Lon:       cluster.CentroidLon,
-				Timestamp: cluster.StartTS,
+				Lat:         cluster.CentroidLat,
+				Lon:         cluster.CentroidLon,
+				Timestamp:   cluster.StartTS,
+				DurationSec: cluster.EndTS - cluster.StartTS,
 			})
 			clusters = append(clusters, cluster)
 
@@ -179,9 +294,10 @@ func PruneStationaryPoints(points []PathPoint, minDistMeters float64) PruneResul
 	cluster.CentroidLon = sumLon / float64(cluster.PointCount)
 
 	result = append(result, PathPoint{
-		Lat:       cluster.CentroidLat,
-		Lon:       cluster.CentroidLon,
-		Timestamp: cluster.StartTS,
+		Lat:         cluster.CentroidLat,
+		Lon:         cluster.CentroidLon,
+		Timestamp:   cluster.StartTS,
+		DurationSec: cluster.EndTS - cluster.StartTS,
 	})
 	clusters = append(clusters, cluster)
 
@@ -192,6 +308,122 @@ func PruneStationaryPoints(points []PathPoint, minDistMeters float64) PruneResul
 	}
 }
 
+// MergeNearbyClusters merges consecutive clusters that are within mergeDistMeters
+// and mergeGapSeconds of each other, so GPS drift doesn't split a single stop.
+// Merged centroids are weighted by point count.
+func MergeNearbyClusters(clusters []StationaryCluster, mergeDistMeters float64, mergeGapSeconds int64) []StationaryCluster {
+	var merged []StationaryCluster
+	for _, cluster := range clusters {
+		if len(merged) == 0 {
+			merged = append(merged, cluster)
+			continue
+		}
+
+		last := &merged[len(merged)-1]
+		dist := DistanceMeters(last.CentroidLat, last.CentroidLon, cluster.CentroidLat, cluster.CentroidLon)
+		gap := cluster.StartTS - last.EndTS
+
+		if dist <= mergeDistMeters && gap <= mergeGapSeconds {
+			// Merge: extend the previous cluster and update centroid (weighted average)
+			totalPoints := last.PointCount + cluster.PointCount
+			last.CentroidLat = (last.CentroidLat*float64(last.PointCount) + cluster.CentroidLat*float64(cluster.PointCount)) / float64(totalPoints)
+			last.CentroidLon = (last.CentroidLon*float64(last.PointCount) + cluster.CentroidLon*float64(cluster.PointCount)) / float64(totalPoints)
+			last.EndTS = cluster.EndTS
+			last.PointCount = totalPoints
+		} else {
+			merged = append(merged, cluster)
+		}
+	}
+	return merged
+}
+
+// DetectStops clusters a day's time-ordered points into the stops the timeline shows
+func DetectStops(points []PathPoint, params TimelineParams) []StationaryCluster {
+	return FilterStops(PruneStationaryPoints(points, params.StayRadiusMeters).Clusters, params)
+}
+
+// FilterStops turns stationary clusters into stops: first nearby clusters (close together
+// AND a short gap apart) are merged to absorb GPS drift, then short ones are dropped.
+// Merging comes first so that distant stops break the merge chain.
+func FilterStops(clusters []StationaryCluster, params TimelineParams) []StationaryCluster {
+	var stops []StationaryCluster
+	for _, cluster := range MergeNearbyClusters(clusters, params.MergeDistMeters, params.MergeGapSeconds) {
+		if cluster.EndTS-cluster.StartTS >= params.MinStopSeconds {
+			stops = append(stops, cluster)
+		}
+	}
+	return stops
+}
+
+// FilterSources keeps only points whose source matches one of sources (case-insensitively).
+// Points with an unknown source are dropped.
+func FilterSources(points []PathPoint, sources []string) []PathPoint {
+	kept := make([]PathPoint, 0, len(points))
+	for _, pt := range points {
+		if pt.Source == nil {
+			continue
+		}
+		for _, src := range sources {
+			if strings.EqualFold(*pt.Source, src) {
+				kept = append(kept, pt)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// HourRange selects points by local hour of day: Start inclusive to End exclusive, 0-24.
+// A Start after End wraps past midnight, so 22-2 keeps 22:00 to 01:59.
+type HourRange struct {
+	Start, End int
+}
+
+// Contains reports whether an hour of day (0-23) is in the range
+func (h HourRange) Contains(hour int) bool {
+	if h.Start <= h.End {
+		return hour >= h.Start && hour < h.End
+	}
+	return hour >= h.Start || hour < h.End
+}
+
+// LocalHour returns the hour of day (0-23) for a timestamp in the timezone at the given coordinates
+func LocalHour(ts int64, lat, lon float64) int {
+	return time.Unix(ts, 0).In(TimezoneFromCoords(lat, lon)).Hour()
+}
+
+// FilterHours keeps only points recorded within hours, in each point's local time
+func FilterHours(points []PathPoint, hours HourRange) []PathPoint {
+	kept := make([]PathPoint, 0, len(points))
+	for _, pt := range points {
+		if hours.Contains(LocalHour(pt.Timestamp, pt.Lat, pt.Lon)) {
+			kept = append(kept, pt)
+		}
+	}
+	return kept
+}
+
+// AccuracyResult contains the filtered path and removed low-accuracy points.
+type AccuracyResult struct {
+	Points  []PathPoint `json:"points"`
+	Removed []PathPoint `json:"removed"`
+}
+
+// FilterInaccurate removes points whose reported accuracy radius exceeds maxAccuracyMeters.
+// Points without an accuracy value are kept, since most sources don't report one.
+func FilterInaccurate(points []PathPoint, maxAccuracyMeters float64) AccuracyResult {
+	kept := make([]PathPoint, 0, len(points))
+	var removed []PathPoint
+	for _, pt := range points {
+		if pt.AccuracyM != nil && *pt.AccuracyM > maxAccuracyMeters {
+			removed = append(removed, pt)
+		} else {
+			kept = append(kept, pt)
+		}
+	}
+	return AccuracyResult{Points: kept, Removed: removed}
+}
+
 // SpikeResult contains the filtered path and removed spike points.
 type SpikeResult struct {
 	Points  []PathPoint `json:"points"`
@@ -218,9 +450,9 @@ func RemoveSpikes(points []PathPoint, thresholdMeters float64) SpikeResult {
 		B := points[i]
 		C := points[i+1]
 
-		distAB := haversineMeters(A.Lat, A.Lon, B.Lat, B.Lon)
-		distBC := haversineMeters(B.Lat, B.Lon, C.Lat, C.Lon)
-		distAC := haversineMeters(A.Lat, A.Lon, C.Lat, C.Lon)
+		distAB := DistanceMeters(A.Lat, A.Lon, B.Lat, B.Lon)
+		distBC := DistanceMeters(B.Lat, B.Lon, C.Lat, C.Lon)
+		distAC := DistanceMeters(A.Lat, A.Lon, C.Lat, C.Lon)
 
 		// B is a spike if it's far from both A and C, but A and C are close
 		if distAB > thresholdMeters && distBC > thresholdMeters && distAC < thresholdMeters {
@@ -240,6 +472,37 @@ func RemoveSpikes(points []PathPoint, thresholdMeters float64) SpikeResult {
 	}
 }
 
+// RemoveImplausibleSpeed drops points that would require traveling faster than maxKmh
+// from the last kept point, catching teleports that don't fit the A-B-A spike pattern.
+// Timestamps have one-second resolution, so non-positive time deltas (duplicate or
+// out-of-order timestamps) are treated as one second rather than dividing by zero.
+func RemoveImplausibleSpeed(points []PathPoint, maxKmh float64) SpikeResult {
+	if len(points) < 2 {
+		return SpikeResult{Points: points}
+	}
+
+	maxMps := maxKmh / 3.6
+	kept := []PathPoint{points[0]} // Always keep first point
+	var removed []PathPoint
+
+	for _, pt := range points[1:] {
+		prev := kept[len(kept)-1]
+		dt := max(pt.Timestamp-prev.Timestamp, 1)
+		dist := DistanceMeters(prev.Lat, prev.Lon, pt.Lat, pt.Lon)
+
+		if dist/float64(dt) > maxMps {
+			removed = append(removed, pt)
+		} else {
+			kept = append(kept, pt)
+		}
+	}
+
+	return SpikeResult{
+		Points:  kept,
+		Removed: removed,
+	}
+}
+
 // ToleranceFromBBox calculates an appropriate simplification tolerance based on viewport size.
 // Returns tolerance in degrees - smaller viewport = smaller tolerance = more detail.
 func ToleranceFromBBox(bbox BBox) float64 {
@@ -269,6 +532,79 @@ func ToleranceFromBBox(bbox BBox) float64 {
 	return tolerance
 }
 
+// Level-of-detail modes for QueryPathsWithPoints
+const (
+	LODDay   = "day"   // One path per user per day
+	LODMonth = "month" // Daily paths merged per user per month
+)
+
+const (
+	// monthLODMinSpanDeg is the viewport span (smaller dimension, degrees) from which
+	// paths are automatically aggregated per month
+	monthLODMinSpanDeg = 20.0
+
+	// monthLODTolerance is the Douglas-Peucker tolerance (~1km) for monthly overviews
+	monthLODTolerance = 0.01
+)
+
+// LODFromBBox picks the level of detail for a viewport: monthly overviews for
+// continent/world-sized views, daily paths otherwise
+func LODFromBBox(bbox BBox) string {
+	if min(bbox.NeLat-bbox.SwLat, bbox.NeLng-bbox.SwLng) >= monthLODMinSpanDeg {
+		return LODMonth
+	}
+	return LODDay
+}
+
+// AggregatePathsByMonth merges each user's daily paths into one polyline per month,
+// simplified with tolerance. Paths must be sorted by start time, as QueryPathsByBBox returns them.
+// The merged paths have no ID, since they don't exist in the database.
+func AggregatePathsByMonth(paths []Path, tolerance float64) []Path {
+	var months []Path
+	index := make(map[string]int) // user+month -> index in months
+	for _, p := range paths {
+		month := p.Date[:min(len(p.Date), 7)]
+		key := p.UserID + "|" + month
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(months)
+			p.ID = 0
+			p.Date = month
+			p.LOD = LODMonth
+			p.Points = append([]PathPoint(nil), p.Points...)
+			months = append(months, p)
+			continue
+		}
+
+		m := &months[i]
+		m.StartTS = min(m.StartTS, p.StartTS)
+		m.EndTS = max(m.EndTS, p.EndTS)
+		m.MinLat = min(m.MinLat, p.MinLat)
+		m.MaxLat = max(m.MaxLat, p.MaxLat)
+		m.MinLon = min(m.MinLon, p.MinLon)
+		m.MaxLon = max(m.MaxLon, p.MaxLon)
+		m.PointCount += p.PointCount
+		m.Points = append(m.Points, p.Points...)
+	}
+
+	for i := range months {
+		// Stationary stand-ins lose their meaning once days are merged
+		for j := range months[i].Points {
+			months[i].Points[j].DurationSec = 0
+		}
+		months[i].Points = SimplifyPath(months[i].Points, tolerance)
+	}
+	return months
+}
+
+// AreaFromBBox calculates a Visvalingam-Whyatt area threshold (in square degrees)
+// comparable to ToleranceFromBBox: the area of a triangle whose base and height
+// are both the Douglas-Peucker tolerance, doubled to match its perceived detail.
+func AreaFromBBox(bbox BBox) float64 {
+	tolerance := ToleranceFromBBox(bbox)
+	return tolerance * tolerance
+}
+
 // Path represents a pre-computed path for a user on a specific day
 type Path struct {
 	ID         int64       `json:"id"`
@@ -281,25 +617,12 @@ type Path struct {
 	MinLon     float64     `json:"min_lon"`
 	MaxLon     float64     `json:"max_lon"`
 	PointCount int         `json:"point_count"`
+	DeviceID   string      `json:"device_id,omitempty"` // Device that recorded most of the points
+	Color      string      `json:"color,omitempty"`     // The device's color from device_meta config
 	Points     []PathPoint `json:"points,omitempty"`
-}
-
-// TimezoneFromCoords returns a time.Location based on longitude.
-// Uses a simple 15-degree-per-hour approximation.
-// For more accuracy, this could be replaced with a proper timezone database.
-func TimezoneFromCoords(lat, lon float64) *time.Location {
-	// Each 15 degrees of longitude = 1 hour offset from UTC
-	// This is a rough approximation that works reasonably well for most locations
-	offsetHours := int(math.Round(lon / 15.0))
-
-	// Clamp to valid range
-	if offsetHours < -12 {
-		offsetHours = -12
-	} else if offsetHours > 14 {
-		offsetHours = 14
-	}
-
-	return time.FixedZone("", offsetHours*3600)
+	// Segments replaces Points when paths are split at GPS gaps (SimplifyOptions.MaxGapSeconds)
+	Segments [][]PathPoint `json:"segments,omitempty"`
+	LOD      string        `json:"lod,omitempty"` // "month" for an aggregated overview; Date is then YYYY-MM
 }
 
 // LocalDateFromTimestamp returns the local date (YYYY-MM-DD) for a timestamp at given coordinates
@@ -313,10 +636,15 @@ func LocalDateFromTimestamp(ts int64, lat, lon float64) string {
 // Returns a map of userID+date -> Path
 func ComputePathsForLocations(locations []Location) map[string]*Path {
 	paths := make(map[string]*Path)
+	deviceCounts := make(map[string]map[string]int) // Path key -> device ID -> points
 
 	for _, loc := range locations {
 		date := LocalDateFromTimestamp(loc.Timestamp, loc.Lat, loc.Lon)
 		key := loc.UserID + "|" + date
+		if deviceCounts[key] == nil {
+			deviceCounts[key] = make(map[string]int)
+		}
+		deviceCounts[key][loc.DeviceID]++
 
 		path, exists := paths[key]
 		if !exists {
@@ -361,18 +689,32 @@ func ComputePathsForLocations(locations []Location) map[string]*Path {
 			Lat:       loc.Lat,
 			Lon:       loc.Lon,
 			Timestamp: loc.Timestamp,
+			AccuracyM: loc.AccuracyM,
+			Source:    loc.Source,
 		})
 		path.PointCount++
 	}
 
 	// Sort points within each path by timestamp
-	for _, path := range paths {
+	for key, path := range paths {
 		sortPathPoints(path.Points)
+		path.DeviceID = primaryDevice(deviceCounts[key])
 	}
 
 	return paths
 }
 
+// primaryDevice returns the device with the most points, preferring the lowest ID on ties
+func primaryDevice(counts map[string]int) string {
+	best := ""
+	for deviceID, n := range counts {
+		if n > counts[best] || (n == counts[best] && deviceID < best) {
+			best = deviceID
+		}
+	}
+	return best
+}
+
 // sortPathPoints sorts path points by timestamp (insertion sort, typically small arrays)
 func sortPathPoints(points []PathPoint) {
 	for i := 1; i < len(points); i++ {
@@ -410,10 +752,10 @@ func (db *DB) CreateOrUpdatePath(path *Path) error {
 	if err == sql.ErrNoRows {
 		// Insert new path
 		result, err := tx.Exec(
-			`INSERT INTO paths (user_id, date, start_ts, end_ts, min_lat, max_lat, min_lon, max_lon, point_count)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			`INSERT INTO paths (user_id, date, start_ts, end_ts, min_lat, max_lat, min_lon, max_lon, point_count, device_id)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			path.UserID, path.Date, path.StartTS, path.EndTS,
-			path.MinLat, path.MaxLat, path.MinLon, path.MaxLon, path.PointCount,
+			path.MinLat, path.MaxLat, path.MinLon, path.MaxLon, path.PointCount, path.DeviceID,
 		)
 		if err != nil {
 			return err
@@ -428,9 +770,9 @@ func (db *DB) CreateOrUpdatePath(path *Path) error {
 		// Update existing path
 		path.ID = existingID
 		_, err = tx.Exec(
-			`UPDATE paths SET start_ts = ?, end_ts = ?, min_lat = ?, max_lat = ?, min_lon = ?, max_lon = ?, point_count = ?
+			`UPDATE paths SET start_ts = ?, end_ts = ?, min_lat = ?, max_lat = ?, min_lon = ?, max_lon = ?, point_count = ?, device_id = ?
 			 WHERE id = ?`,
-			path.StartTS, path.EndTS, path.MinLat, path.MaxLat, path.MinLon, path.MaxLon, path.PointCount,
+			path.StartTS, path.EndTS, path.MinLat, path.MaxLat, path.MinLon, path.MaxLon, path.PointCount, path.DeviceID,
 			path.ID,
 		)
 		if err != nil {
@@ -446,7 +788,7 @@ func (db *DB) CreateOrUpdatePath(path *Path) error {
 
 	// Insert path points
 	stmt, err := tx.Prepare(
-		`INSERT INTO path_points (path_id, seq, timestamp, lat, lon) VALUES (?, ?, ?, ?, ?)`,
+		`INSERT INTO path_points (path_id, seq, timestamp, lat, lon, accuracy_m, source) VALUES (?, ?, ?, ?, ?, ?, ?)`,
 	)
 	if err != nil {
 		return err
@@ -454,7 +796,7 @@ func (db *DB) CreateOrUpdatePath(path *Path) error {
 	defer stmt.Close()
 
 	for i, pt := range path.Points {
-		_, err = stmt.Exec(path.ID, i, pt.Timestamp, pt.Lat, pt.Lon)
+		_, err = stmt.Exec(path.ID, i, pt.Timestamp, pt.Lat, pt.Lon, pt.AccuracyM, pt.Source)
 		if err != nil {
 			return err
 		}
@@ -463,12 +805,45 @@ func (db *DB) CreateOrUpdatePath(path *Path) error {
 	return tx.Commit()
 }
 
+// DeletePath removes the path (and its points) for a user+date
+func (db *DB) DeletePath(userID, date string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(`DELETE FROM path_points WHERE path_id IN (SELECT id FROM paths WHERE user_id = ? AND date = ?)`, userID, date)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM paths WHERE user_id = ? AND date = ?`, userID, date)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // QueryPathsByBBox returns all paths that intersect the given bounding box
-func (db *DB) QueryPathsByBBox(bbox BBox, start, end *int64) ([]Path, error) {
-	query := `SELECT id, user_id, date, start_ts, end_ts, min_lat, max_lat, min_lon, max_lon, point_count
+// If userID is non-empty, only that user's paths are returned.
+func (db *DB) QueryPathsByBBox(userID string, bbox BBox, start, end *int64) ([]Path, error) {
+	query := `SELECT id, user_id, date, start_ts, end_ts, min_lat, max_lat, min_lon, max_lon, point_count, device_id
 			  FROM paths
-			  WHERE max_lat >= ? AND min_lat <= ? AND max_lon >= ? AND min_lon <= ?`
-	args := []any{bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng}
+			  WHERE id IN (SELECT id FROM paths_rtree WHERE max_lat >= ? AND min_lat <= ? AND max_lon >= ? AND min_lon <= ?)
+			    AND max_lat >= ? AND min_lat <= ? AND max_lon >= ? AND min_lon <= ?`
+	// The R*Tree narrows candidates; repeating the check on the exact columns
+	// trims the slack from its outward-rounded 32-bit coordinates
+	args := []any{bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng, bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng}
+
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
 
 	if start != nil {
 		query += " AND end_ts >= ?"
@@ -490,20 +865,42 @@ func (db *DB) QueryPathsByBBox(bbox BBox, start, end *int64) ([]Path, error) {
 	var paths []Path
 	for rows.Next() {
 		var p Path
+		var deviceID sql.NullString
 		if err := rows.Scan(&p.ID, &p.UserID, &p.Date, &p.StartTS, &p.EndTS,
-			&p.MinLat, &p.MaxLat, &p.MinLon, &p.MaxLon, &p.PointCount); err != nil {
+			&p.MinLat, &p.MaxLat, &p.MinLon, &p.MaxLon, &p.PointCount, &deviceID); err != nil {
 			return nil, err
 		}
+		p.DeviceID = deviceID.String
 		paths = append(paths, p)
 	}
 
 	return paths, rows.Err()
 }
 
+// GetPath retrieves a path's metadata by ID (without points). Returns nil if not found.
+func (db *DB) GetPath(pathID int64) (*Path, error) {
+	var p Path
+	var deviceID sql.NullString
+	err := db.QueryRow(
+		`SELECT id, user_id, date, start_ts, end_ts, min_lat, max_lat, min_lon, max_lon, point_count, device_id
+		 FROM paths WHERE id = ?`,
+		pathID,
+	).Scan(&p.ID, &p.UserID, &p.Date, &p.StartTS, &p.EndTS,
+		&p.MinLat, &p.MaxLat, &p.MinLon, &p.MaxLon, &p.PointCount, &deviceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.DeviceID = deviceID.String
+	return &p, nil
+}
+
 // GetPathPoints retrieves all points for a given path ID
 func (db *DB) GetPathPoints(pathID int64) ([]PathPoint, error) {
 	rows, err := db.Query(
-		`SELECT timestamp, lat, lon FROM path_points WHERE path_id = ? ORDER BY seq`,
+		`SELECT timestamp, lat, lon, accuracy_m, source FROM path_points WHERE path_id = ? ORDER BY seq`,
 		pathID,
 	)
 	if err != nil {
@@ -514,7 +911,7 @@ func (db *DB) GetPathPoints(pathID int64) ([]PathPoint, error) {
 	var points []PathPoint
 	for rows.Next() {
 		var pt PathPoint
-		if err := rows.Scan(&pt.Timestamp, &pt.Lat, &pt.Lon); err != nil {
+		if err := rows.Scan(&pt.Timestamp, &pt.Lat, &pt.Lon, &pt.AccuracyM, &pt.Source); err != nil {
 			return nil, err
 		}
 		points = append(points, pt)
@@ -525,13 +922,22 @@ func (db *DB) GetPathPoints(pathID int64) ([]PathPoint, error) {
 
 // SimplifyOptions configures the path simplification pipeline.
 type SimplifyOptions struct {
-	PruneMeters float64  // Stationary point pruning threshold (0 = disabled)
-	SpikeMeters float64  // Spike detection threshold (0 = disabled)
-	Order       []string // Order of operations, e.g. ["stationary", "spikes"]
+	LOD           string     // Level of detail: LODDay, LODMonth, or "" to choose from the viewport
+	MaxGapSeconds int64      // Split paths where no points were recorded for longer than this (0 = disabled)
+	Sources       []string   // Keep only points from these sources, e.g. ["GPS"] (empty = all)
+	Hours         *HourRange // Keep only points recorded in these local hours (nil = all)
+	Algorithm     string     // Final viewport simplification: "dp" (Douglas-Peucker, default) or "vw" (Visvalingam-Whyatt)
+	MaxAccuracyM  float64    // Drop points with accuracy worse than this (0 = disabled)
+	MaxSpeedKmh   float64    // Drop points implying travel faster than this (0 = disabled)
+	PruneMeters   float64    // Stationary point pruning threshold (0 = disabled)
+	SpikeMeters   float64    // Spike detection threshold (0 = disabled)
+	Order         []string   // Order of operations, e.g. ["accuracy", "speed", "stationary", "spikes"]
 }
 
 // RemovedPoints tracks points removed by each simplification stage.
 type RemovedPoints struct {
+	Inaccurate []PathPoint `json:"inaccurate"`
+	Speed      []PathPoint `json:"speed"`
 	Stationary []PathPoint `json:"stationary"`
 	Spikes     []PathPoint `json:"spikes"`
 }
@@ -543,18 +949,22 @@ type PathsResult struct {
 }
 
 // QueryPathsWithPoints returns paths with their points loaded and simplified for the viewport.
-// The simplification pipeline is configured via SimplifyOptions.
-func (db *DB) QueryPathsWithPoints(bbox BBox, start, end *int64, opts SimplifyOptions) (PathsResult, error) {
-	paths, err := db.QueryPathsByBBox(bbox, start, end)
+// The simplification pipeline is configured via SimplifyOptions. Large viewports (or
+// LODMonth) get one coarse path per user per month instead of daily paths. With MaxGapSeconds
+// set, daily paths are returned as Segments split at tracking gaps.
+// If userID is non-empty, only that user's paths are returned.
+func (db *DB) QueryPathsWithPoints(userID string, bbox BBox, start, end *int64, opts SimplifyOptions) (PathsResult, error) {
+	paths, err := db.QueryPathsByBBox(userID, bbox, start, end)
 	if err != nil {
 		return PathsResult{}, err
 	}
 
-	// Calculate simplification tolerance based on viewport
-	tolerance := ToleranceFromBBox(bbox)
+	lod := opts.LOD
+	if lod == "" {
+		lod = LODFromBBox(bbox)
+	}
 
-	var allRemovedStationary []PathPoint
-	var allRemovedSpikes []PathPoint
+	var removed RemovedPoints
 
 	for i := range paths {
 		points, err := db.GetPathPoints(paths[i].ID)
@@ -562,39 +972,118 @@ func (db *DB) QueryPathsWithPoints(bbox BBox, start, end *int64, opts SimplifyOp
 			return PathsResult{}, err
 		}
 
-		// Apply simplification stages in specified order
-		for _, stage := range opts.Order {
-			switch stage {
-			case "stationary":
-				if opts.PruneMeters > 0 {
-					result := PruneStationaryPoints(points, opts.PruneMeters)
-					points = result.Points
-					allRemovedStationary = append(allRemovedStationary, result.Removed...)
-				}
-			case "spikes":
-				if opts.SpikeMeters > 0 {
-					result := RemoveSpikes(points, opts.SpikeMeters)
-					points = result.Points
-					allRemovedSpikes = append(allRemovedSpikes, result.Removed...)
-				}
+		points = applySimplifyStages(points, opts, &removed)
+
+		// Monthly overviews merge days anyway, so gaps only split daily paths
+		if opts.MaxGapSeconds > 0 && lod != LODMonth {
+			segments := SplitAtGaps(points, opts.MaxGapSeconds)
+			for j := range segments {
+				segments[j] = simplifyForViewport(segments[j], bbox, opts.Algorithm)
 			}
+			paths[i].Segments = segments
+			continue
+		}
+
+		paths[i].Points = simplifyForViewport(points, bbox, opts.Algorithm)
+	}
+
+	if lod == LODMonth {
+		paths = AggregatePathsByMonth(paths, max(ToleranceFromBBox(bbox), monthLODTolerance))
+	}
+
+	return PathsResult{Paths: paths, Removed: removed}, nil
+}
+
+// simplifyForViewport applies the final viewport simplification with the chosen algorithm
+func simplifyForViewport(points []PathPoint, bbox BBox, algorithm string) []PathPoint {
+	if algorithm == "vw" {
+		return SimplifyPathVW(points, AreaFromBBox(bbox))
+	}
+	return SimplifyPath(points, ToleranceFromBBox(bbox))
+}
+
+// SplitAtGaps splits points into segments wherever tracking stopped for more than
+// maxGapSeconds, so the lost stretch isn't drawn as a straight line. A stationary
+// stand-in point's stay counts as tracked time.
+func SplitAtGaps(points []PathPoint, maxGapSeconds int64) [][]PathPoint {
+	if len(points) == 0 {
+		return nil
+	}
+
+	var segments [][]PathPoint
+	start := 0
+	for i := 1; i < len(points); i++ {
+		prev := points[i-1]
+		if points[i].Timestamp-(prev.Timestamp+prev.DurationSec) > maxGapSeconds {
+			segments = append(segments, points[start:i])
+			start = i
 		}
+	}
+	return append(segments, points[start:])
+}
 
-		// Finally, apply Douglas-Peucker simplification for viewport
-		paths[i].Points = SimplifyPath(points, tolerance)
+// applySimplifyStages drops points from sources not in opts.Sources or outside opts.Hours, then runs the filtering
+// stages in opts.Order, appending the points each stage drops to removed.
+// The final viewport simplification is left to the caller.
+func applySimplifyStages(points []PathPoint, opts SimplifyOptions, removed *RemovedPoints) []PathPoint {
+	if len(opts.Sources) > 0 {
+		points = FilterSources(points, opts.Sources)
+	}
+	if opts.Hours != nil {
+		points = FilterHours(points, *opts.Hours)
+	}
+	for _, stage := range opts.Order {
+		switch stage {
+		case "accuracy":
+			if opts.MaxAccuracyM > 0 {
+				result := FilterInaccurate(points, opts.MaxAccuracyM)
+				points = result.Points
+				removed.Inaccurate = append(removed.Inaccurate, result.Removed...)
+			}
+		case "speed":
+			if opts.MaxSpeedKmh > 0 {
+				result := RemoveImplausibleSpeed(points, opts.MaxSpeedKmh)
+				points = result.Points
+				removed.Speed = append(removed.Speed, result.Removed...)
+			}
+		case "stationary":
+			if opts.PruneMeters > 0 {
+				result := PruneStationaryPoints(points, opts.PruneMeters)
+				points = result.Points
+				removed.Stationary = append(removed.Stationary, result.Removed...)
+			}
+		case "spikes":
+			if opts.SpikeMeters > 0 {
+				result := RemoveSpikes(points, opts.SpikeMeters)
+				points = result.Points
+				removed.Spikes = append(removed.Spikes, result.Removed...)
+			}
+		}
 	}
+	return points
+}
 
-	return PathsResult{
-		Paths: paths,
-		Removed: RemovedPoints{
-			Stationary: allRemovedStationary,
-			Spikes:     allRemovedSpikes,
-		},
-	}, nil
+// retainedPath matches paths that retention pruned raw locations from. Retention prunes
+// the oldest locations, so a path with no location of its user at or before its start has
+// lost points and is kept as the only record of them.
+const retainedPath = `NOT EXISTS (SELECT 1 FROM locations l
+	WHERE l.user_id = paths.user_id AND l.timestamp <= paths.start_ts)`
+
+// ErrPathRetained is returned when rebuilding a path that retention pruned raw locations from
+var ErrPathRetained = errors.New("path is kept after retention pruned its locations")
+
+// isPathRetained reports whether the stored path for a user+date can't be recomputed
+// because retention pruned some of its raw locations
+func (db *DB) isPathRetained(userID, date string) (bool, error) {
+	var retained bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM paths WHERE user_id = ? AND date = ? AND `+retainedPath+`)`, userID, date).Scan(&retained)
+	return retained, err
 }
 
 // RebuildAllPaths recomputes all paths from scratch
-// Useful after algorithm changes or data corrections
+// Useful after algorithm changes or data corrections.
+// Paths whose raw locations were pruned, even partly, by retention are kept, since they
+// can't be recomputed.
 func (db *DB) RebuildAllPaths() error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -606,22 +1095,41 @@ func (db *DB) RebuildAllPaths() error {
 		}
 	}()
 
-	// Clear existing paths
-	_, err = tx.Exec(`DELETE FROM path_points`)
+	// Clear existing paths whose whole range is still covered by raw locations
+	_, err = tx.Exec(`DELETE FROM path_points WHERE path_id IN (SELECT id FROM paths WHERE NOT ` + retainedPath + `)`)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(`DELETE FROM paths`)
+	_, err = tx.Exec(`DELETE FROM paths WHERE NOT ` + retainedPath)
 	if err != nil {
 		return err
 	}
 
+	// Remaining paths must not be overwritten by their surviving locations
+	kept := make(map[UserDate]bool)
+	keptRows, err := tx.Query(`SELECT user_id, date FROM paths`)
+	if err != nil {
+		return err
+	}
+	for keptRows.Next() {
+		var ud UserDate
+		if err = keptRows.Scan(&ud.UserID, &ud.Date); err != nil {
+			keptRows.Close()
+			return err
+		}
+		kept[ud] = true
+	}
+	keptRows.Close()
+	if err = keptRows.Err(); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
 
 	// Query all locations
-	rows, err := db.Query(`SELECT timestamp, user_id, device_id, lat, lon FROM locations ORDER BY timestamp`)
+	rows, err := db.Query(`SELECT timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations ORDER BY timestamp`)
 	if err != nil {
 		return err
 	}
@@ -630,9 +1138,12 @@ func (db *DB) RebuildAllPaths() error {
 	var locations []Location
 	for rows.Next() {
 		var loc Location
-		if err := rows.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon); err != nil {
+		if err := rows.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon, &loc.AltitudeM, &loc.AccuracyM, &loc.SpeedKmh, &loc.Source); err != nil {
 			return err
 		}
+		if kept[UserDateForLocation(loc)] {
+			continue
+		}
 		locations = append(locations, loc)
 	}
 	if err = rows.Err(); err != nil {
@@ -652,46 +1163,80 @@ func (db *DB) RebuildAllPaths() error {
 	return nil
 }
 
-// UpdatePathsForLocations updates paths for a batch of new locations
-func (db *DB) UpdatePathsForLocations(locations []Location) error {
-	if len(locations) == 0 {
-		return nil
-	}
+// UserDate identifies a per-user, per-local-date path bucket
+type UserDate struct {
+	UserID string
+	Date   string // Local date YYYY-MM-DD
+}
+
+// UserDateForLocation returns the path bucket a location belongs to
+func UserDateForLocation(loc Location) UserDate {
+	return UserDate{UserID: loc.UserID, Date: LocalDateFromTimestamp(loc.Timestamp, loc.Lat, loc.Lon)}
+}
 
-	// Group locations by user+date
-	byUserDate := make(map[string][]Location)
+// UpdatePathsForLocations recomputes paths for the user+dates touched by a batch of new or deleted locations
+func (db *DB) UpdatePathsForLocations(locations []Location) error {
+	seen := make(map[UserDate]bool)
+	var pairs []UserDate
 	for _, loc := range locations {
-		date := LocalDateFromTimestamp(loc.Timestamp, loc.Lat, loc.Lon)
-		key := loc.UserID + "|" + date
-		byUserDate[key] = append(byUserDate[key], loc)
+		ud := UserDateForLocation(loc)
+		if !seen[ud] {
+			seen[ud] = true
+			pairs = append(pairs, ud)
+		}
 	}
+	return db.RebuildPathsForDates(pairs)
+}
 
-	// For each user+date, fetch existing path and merge
-	for key, locs := range byUserDate {
-		userID := locs[0].UserID
-		date := LocalDateFromTimestamp(locs[0].Timestamp, locs[0].Lat, locs[0].Lon)
-
-		// Fetch all locations for this user+date from DB
-		// We need to recompute the entire path for that day
-		allLocs, err := db.QueryLocationsByUserDate(userID, date)
-		if err != nil {
+// RebuildPathsForDates recomputes the paths for only the given user+date buckets,
+// so the cost is proportional to the data touched rather than the whole history.
+// Paths kept after retention are left as they are.
+func (db *DB) RebuildPathsForDates(pairs []UserDate) error {
+	for _, ud := range pairs {
+		if _, err := db.RebuildPathForDate(ud.UserID, ud.Date); err != nil && !errors.Is(err, ErrPathRetained) {
 			return err
 		}
+	}
 
-		// Compute the path
-		paths := ComputePathsForLocations(allLocs)
-		path := paths[key]
-		if path == nil {
-			continue // Should not happen
-		}
+	return nil
+}
 
-		// Store/update the path
-		if err := db.CreateOrUpdatePath(path); err != nil {
-			return err
-		}
+// RebuildPathForDate recomputes the path for one user+date bucket from its locations.
+// Returns the rebuilt path's point count, or 0 if the day has no locations and its path was dropped.
+// A path retention pruned locations from is neither dropped nor overwritten; ErrPathRetained is returned.
+func (db *DB) RebuildPathForDate(userID, date string) (int, error) {
+	retained, err := db.isPathRetained(userID, date)
+	if err != nil {
+		return 0, err
+	}
+	if retained {
+		return 0, ErrPathRetained
 	}
 
-	return nil
+	// Fetch all locations for this user+date from DB
+	// We need to recompute the entire path for that day
+	allLocs, err := db.QueryLocationsByUserDate(userID, date)
+	if err != nil {
+		return 0, err
+	}
+
+	// All locations for the day were deleted - drop the stale path
+	if len(allLocs) == 0 {
+		return 0, db.DeletePath(userID, date)
+	}
+
+	// Compute the path
+	paths := ComputePathsForLocations(allLocs)
+	path := paths[userID+"|"+date]
+	if path == nil {
+		return 0, nil // Should not happen
+	}
+
+	// Store/update the path
+	if err := db.CreateOrUpdatePath(path); err != nil {
+		return 0, err
+	}
+	return path.PointCount, nil
 }
 
 // QueryLocationsByUserDate returns all locations for a user on a specific date
@@ -713,7 +1258,7 @@ func (db *DB) QueryLocationsByUserDate(userID, date string) ([]Location, error)
 	endTS := t.Add(48 * time.Hour).Unix()
 
 	rows, err := db.Query(
-		`SELECT timestamp, user_id, device_id, lat, lon FROM locations
+		`SELECT timestamp, user_id, device_id, lat, lon, altitude_m, accuracy_m, speed_kmh, source FROM locations
 		 WHERE user_id = ? AND timestamp >= ? AND timestamp <= ?
 		 ORDER BY timestamp`,
 		userID, startTS, endTS,
@@ -726,7 +1271,7 @@ func (db *DB) QueryLocationsByUserDate(userID, date string) ([]Location, error)
 	var locations []Location
 	for rows.Next() {
 		var loc Location
-		if err := rows.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon); err != nil {
+		if err := rows.Scan(&loc.Timestamp, &loc.UserID, &loc.DeviceID, &loc.Lat, &loc.Lon, &loc.AltitudeM, &loc.AccuracyM, &loc.SpeedKmh, &loc.Source); err != nil {
 			return nil, err
 		}
 		// Filter by actual local date
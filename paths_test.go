@@ -0,0 +1,357 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		wantKm                 float64
+	}{
+		{"same point", 51.5074, -0.1278, 51.5074, -0.1278, 0},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.6},
+		{"New York to Los Angeles", 40.7128, -74.0060, 34.0522, -118.2437, 3935.7},
+		{"Sydney to Tokyo", -33.8688, 151.2093, 35.6762, 139.6503, 7826.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DistanceMeters(tt.lat1, tt.lon1, tt.lat2, tt.lon2) / 1000
+			if math.Abs(got-tt.wantKm) > tt.wantKm*0.005+0.001 {
+				t.Errorf("DistanceMeters = %.1f km, want %.1f km", got, tt.wantKm)
+			}
+			// Distance is symmetric
+			if back := DistanceMeters(tt.lat2, tt.lon2, tt.lat1, tt.lon1) / 1000; math.Abs(back-got) > 1e-9 {
+				t.Errorf("reverse distance = %f km, want %f km", back, got)
+			}
+		})
+	}
+}
+
+func TestRebuildAllPathsKeepsSource(t *testing.T) {
+	db := openTestDB(t)
+
+	gps, wifi := "GPS", "WIFI"
+	base := int64(1700000000)
+	locs := []Location{
+		{Timestamp: base, UserID: "alice", DeviceID: "phone", Lat: 37.77, Lon: -122.42, Source: &gps},
+		{Timestamp: base + 60, UserID: "alice", DeviceID: "phone", Lat: 37.78, Lon: -122.41, Source: &wifi},
+		{Timestamp: base + 120, UserID: "alice", DeviceID: "phone", Lat: 37.79, Lon: -122.40, Source: &gps},
+	}
+	if _, _, err := db.InsertLocationBatch(locs); err != nil {
+		t.Fatalf("InsertLocationBatch: %v", err)
+	}
+	if err := db.RebuildAllPaths(); err != nil {
+		t.Fatalf("RebuildAllPaths: %v", err)
+	}
+
+	points := testPathPoints(t, db, "alice")
+	if len(points) != len(locs) {
+		t.Fatalf("got %d path points, want %d", len(points), len(locs))
+	}
+	for i, pt := range points {
+		if pt.Source == nil || *pt.Source != *locs[i].Source {
+			t.Errorf("point %d source = %v, want %q", i, pt.Source, *locs[i].Source)
+		}
+	}
+	if got := FilterSources(points, []string{"gps"}); len(got) != 2 {
+		t.Errorf("FilterSources(gps) kept %d points, want 2", len(got))
+	}
+}
+
+// sampleTrack returns a deterministic L-shaped urban walk: east, then north around a
+// corner, with ~2 m of GPS jitter on every point
+func sampleTrack() []PathPoint {
+	rng := rand.New(rand.NewPCG(1, 2))
+	jitter := func() float64 { return (rng.Float64() - 0.5) * 0.00004 }
+
+	var points []PathPoint
+	ts := int64(1700000000)
+	for i := range 200 {
+		points = append(points, PathPoint{Lat: 51.5 + jitter(), Lon: -0.12 + float64(i)*0.00005 + jitter(), Timestamp: ts})
+		ts += 5
+	}
+	for i := range 200 {
+		points = append(points, PathPoint{Lat: 51.5 + float64(i+1)*0.00005 + jitter(), Lon: -0.11 + jitter(), Timestamp: ts})
+		ts += 5
+	}
+	return points
+}
+
+func TestSimplifyPathReduction(t *testing.T) {
+	points := sampleTrack()
+	const tolerance = 0.0001 // ~11 m, well above the jitter
+	corner := points[199]
+
+	dp := SimplifyPath(points, tolerance)
+	vw := SimplifyPathVW(points, tolerance*tolerance)
+	// VW only drops the least significant points, so it keeps more of the shape
+	if len(vw) < len(dp) {
+		t.Errorf("vw kept %d points, fewer than dp's %d", len(vw), len(dp))
+	}
+
+	tests := []struct {
+		name string
+		got  []PathPoint
+	}{
+		{"dp", dp},
+		{"vw", vw},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Logf("%d -> %d points", len(points), len(tt.got))
+			if len(tt.got) > len(points)/10 {
+				t.Errorf("kept %d of %d points, want at most %d", len(tt.got), len(points), len(points)/10)
+			}
+			if tt.got[0] != points[0] || tt.got[len(tt.got)-1] != points[len(points)-1] {
+				t.Error("endpoints not kept")
+			}
+			// The corner is the track's only real feature
+			nearCorner := false
+			for _, p := range tt.got {
+				if DistanceMeters(p.Lat, p.Lon, corner.Lat, corner.Lon) < 15 {
+					nearCorner = true
+				}
+			}
+			if !nearCorner {
+				t.Error("corner not kept")
+			}
+		})
+	}
+}
+
+func TestSimplifyPathVW(t *testing.T) {
+	points := sampleTrack()
+
+	if got := SimplifyPathVW(points, 0); len(got) != len(points) {
+		t.Errorf("zero area kept %d of %d points, want all", len(got), len(points))
+	}
+
+	// Stay points are never removed
+	points[100].DurationSec = 600
+	got := SimplifyPathVW(points, 1)
+	want := []PathPoint{points[0], points[100], points[len(points)-1]}
+	if len(got) != len(want) {
+		t.Fatalf("huge area kept %d points, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("point %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// commutePath returns a day's path of 50 points along the same ~7 km commute
+func commutePath(userID, date string, startTS int64) Path {
+	p := Path{UserID: userID, Date: date, StartTS: startTS, EndTS: startTS + 49*60, PointCount: 50, ID: 1}
+	for i := range 50 {
+		p.Points = append(p.Points, PathPoint{Lat: 51.50 + float64(i)*0.001, Lon: -0.12 + float64(i%2)*0.0001, Timestamp: startTS + int64(i*60)})
+	}
+	p.MinLat, p.MaxLat = 51.50, 51.549
+	p.MinLon, p.MaxLon = -0.12, -0.1199
+	return p
+}
+
+func TestAggregatePathsByMonth(t *testing.T) {
+	var paths []Path
+	start := time.Date(2024, time.January, 1, 8, 0, 0, 0, time.UTC)
+	for day := range 60 { // January and February
+		d := start.AddDate(0, 0, day)
+		paths = append(paths, commutePath("alice", d.Format("2006-01-02"), d.Unix()))
+		if day < 3 {
+			paths = append(paths, commutePath("bob", d.Format("2006-01-02"), d.Unix()+1))
+		}
+	}
+	totalPoints := 0
+	for _, p := range paths {
+		totalPoints += len(p.Points)
+	}
+
+	months := AggregatePathsByMonth(paths, monthLODTolerance)
+
+	type key struct{ user, month string }
+	wantCounts := map[key]int{{"alice", "2024-01"}: 31 * 50, {"alice", "2024-02"}: 29 * 50, {"bob", "2024-01"}: 3 * 50}
+	if len(months) != len(wantCounts) {
+		t.Fatalf("got %d monthly paths, want %d", len(months), len(wantCounts))
+	}
+	keptPoints := 0
+	for _, m := range months {
+		k := key{m.UserID, m.Date}
+		if m.PointCount != wantCounts[k] {
+			t.Errorf("%v point count = %d, want %d", k, m.PointCount, wantCounts[k])
+		}
+		if m.LOD != LODMonth || m.ID != 0 {
+			t.Errorf("%v LOD = %q, ID = %d; want %q and no ID", k, m.LOD, m.ID, LODMonth)
+		}
+		keptPoints += len(m.Points)
+	}
+	if keptPoints > totalPoints/100 {
+		t.Errorf("monthly overview kept %d of %d points, want at most %d", keptPoints, totalPoints, totalPoints/100)
+	}
+	if len(paths[0].Points) != 50 {
+		t.Errorf("daily path modified: %d points left", len(paths[0].Points))
+	}
+}
+
+func TestLODFromBBox(t *testing.T) {
+	if got := LODFromBBox(worldBBox); got != LODMonth {
+		t.Errorf("world LOD = %q, want %q", got, LODMonth)
+	}
+	if got := LODFromBBox(BBox{SwLng: -0.2, SwLat: 51.4, NeLng: 0, NeLat: 51.6}); got != LODDay {
+		t.Errorf("city LOD = %q, want %q", got, LODDay)
+	}
+}
+
+func TestHourRangeContains(t *testing.T) {
+	tests := []struct {
+		hours HourRange
+		in    []int
+		out   []int
+	}{
+		{HourRange{7, 10}, []int{7, 8, 9}, []int{6, 10, 23, 0}},
+		{HourRange{22, 2}, []int{22, 23, 0, 1}, []int{21, 2, 12}},
+		{HourRange{0, 24}, []int{0, 12, 23}, nil},
+		{HourRange{23, 0}, []int{23}, []int{0, 22}},
+	}
+	for _, tt := range tests {
+		for _, hour := range tt.in {
+			if !tt.hours.Contains(hour) {
+				t.Errorf("%+v doesn't contain %d", tt.hours, hour)
+			}
+		}
+		for _, hour := range tt.out {
+			if tt.hours.Contains(hour) {
+				t.Errorf("%+v contains %d", tt.hours, hour)
+			}
+		}
+	}
+}
+
+func TestFilterHoursWrapsPastMidnight(t *testing.T) {
+	// Hourly points over a summer day in New York (EDT, UTC-4)
+	var points []PathPoint
+	start := time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)
+	for h := range 24 {
+		points = append(points, PathPoint{Lat: 40.7128, Lon: -74.0060, Timestamp: start.Add(time.Duration(h) * time.Hour).Unix()})
+	}
+
+	var gotHours []int
+	for _, pt := range FilterHours(points, HourRange{Start: 22, End: 2}) {
+		gotHours = append(gotHours, time.Unix(pt.Timestamp, 0).UTC().Hour())
+	}
+	// 20:00 EDT on June 30 is 00:00 UTC, so local 22:00-01:59 is 02:00-05:59 UTC
+	if want := []int{2, 3, 4, 5}; !slices.Equal(gotHours, want) {
+		t.Errorf("kept UTC hours %v, want %v", gotHours, want)
+	}
+}
+
+func TestQueryHeatmapHours(t *testing.T) {
+	db := openTestDB(t)
+	// London in January is on UTC
+	for _, hour := range []int{12, 23, 1} {
+		ts := time.Date(2024, time.January, 10, hour, 0, 0, 0, time.UTC).Unix()
+		if err := db.InsertLocation(Location{Timestamp: ts, UserID: "alice", DeviceID: "phone", Lat: 51.5, Lon: -0.12}); err != nil {
+			t.Fatalf("InsertLocation: %v", err)
+		}
+	}
+
+	cells, err := db.QueryHeatmap("alice", worldBBox, nil, nil, &HourRange{Start: 22, End: 2}, 1)
+	if err != nil {
+		t.Fatalf("QueryHeatmap: %v", err)
+	}
+	if len(cells) != 1 || cells[0].Weight != 2 {
+		t.Errorf("cells = %+v, want one cell of weight 2", cells)
+	}
+}
+
+// dayBuilder appends one point a minute to a synthetic day, starting at 08:00 UTC
+type dayBuilder struct {
+	points []PathPoint
+	ts     int64
+}
+
+func newDayBuilder() *dayBuilder {
+	return &dayBuilder{ts: time.Date(2024, time.January, 15, 8, 0, 0, 0, time.UTC).Unix()}
+}
+
+// stay adds minutes of points at east/north meters from a London origin, with ~5 m of drift
+func (d *dayBuilder) stay(east, north float64, minutes int) *dayBuilder {
+	for i := range minutes {
+		jitter := float64(i%3-1) * 5
+		d.add(east+jitter, north-jitter)
+	}
+	return d
+}
+
+// travel adds minutes of points moving in a straight line between two offsets
+func (d *dayBuilder) travel(fromEast, fromNorth, toEast, toNorth float64, minutes int) *dayBuilder {
+	for i := 1; i <= minutes; i++ {
+		f := float64(i) / float64(minutes+1)
+		d.add(fromEast+(toEast-fromEast)*f, fromNorth+(toNorth-fromNorth)*f)
+	}
+	return d
+}
+
+func (d *dayBuilder) add(east, north float64) {
+	lat, lon := londonOffset(east, north)
+	d.points = append(d.points, PathPoint{Lat: lat, Lon: lon, Timestamp: d.ts})
+	d.ts += 60
+}
+
+// londonOffset returns the point east and north meters from central London
+func londonOffset(east, north float64) (lat, lon float64) {
+	const lat0, lon0 = 51.5, -0.12
+	return lat0 + north/metersPerDegreeLat, lon0 + east/(metersPerDegreeLat*math.Cos(lat0*math.Pi/180))
+}
+
+func TestDetectStops(t *testing.T) {
+	type place struct{ east, north float64 }
+	tests := []struct {
+		name       string
+		day        *dayBuilder
+		want       []place
+		minMinutes int // Shortest stop expected
+	}{
+		{
+			// A 200 m GPS excursion splits the stay into three clusters, merged back into one
+			name:       "GPS drift merged",
+			day:        newDayBuilder().stay(0, 0, 30).stay(200, 0, 5).stay(0, 0, 30),
+			want:       []place{{0, 0}},
+			minMinutes: 60,
+		},
+		{
+			name:       "short blip filtered",
+			day:        newDayBuilder().stay(0, 0, 30).travel(0, 0, 3000, 0, 10).stay(3000, 0, 5).travel(3000, 0, 6000, 0, 10).stay(6000, 0, 30),
+			want:       []place{{0, 0}, {6000, 0}},
+			minMinutes: 29,
+		},
+		{
+			name:       "adjacent distinct stops kept apart",
+			day:        newDayBuilder().stay(0, 0, 30).travel(0, 0, 2000, 0, 4).stay(2000, 0, 30),
+			want:       []place{{0, 0}, {2000, 0}},
+			minMinutes: 29,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stops := DetectStops(tt.day.points, defaultTimelineParams)
+			if len(stops) != len(tt.want) {
+				t.Fatalf("got %d stops, want %d: %+v", len(stops), len(tt.want), stops)
+			}
+			for i, stop := range stops {
+				lat, lon := londonOffset(tt.want[i].east, tt.want[i].north)
+				if d := DistanceMeters(stop.CentroidLat, stop.CentroidLon, lat, lon); d > 50 {
+					t.Errorf("stop %d is %.0f m from where it should be", i, d)
+				}
+				if minutes := int(stop.EndTS-stop.StartTS) / 60; minutes < tt.minMinutes {
+					t.Errorf("stop %d lasted %d minutes, want at least %d", i, minutes, tt.minMinutes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// significantPlaceRadiusMeters is how close stops must be to count as the same place,
+	// and how close a timeline stop must be to a significant place to take its label
+	significantPlaceRadiusMeters = 200.0
+
+	// significantPlacesCacheTTL is how long detected places are reused before rescanning history
+	significantPlacesCacheTTL = time.Hour
+)
+
+// SignificantPlaceOptions controls home/work detection.
+// Hour windows are local [start, end) and may wrap past midnight (e.g. 22-6).
+type SignificantPlaceOptions struct {
+	NightStartHour int `json:"night_start"`
+	NightEndHour   int `json:"night_end"`
+	WorkStartHour  int `json:"work_start"`
+	WorkEndHour    int `json:"work_end"`
+	MinVisits      int `json:"min_visits"` // Visits required before a place is reported
+}
+
+// SignificantPlace is a frequently visited location inferred from stop history
+type SignificantPlace struct {
+	Label        string  `json:"label,omitempty"` // "Home", "Work", or empty
+	Lat          float64 `json:"lat"`
+	Lon          float64 `json:"lon"`
+	Visits       int     `json:"visits"`
+	NightVisits  int     `json:"night_visits"` // Visits overlapping the night window
+	WorkVisits   int     `json:"work_visits"`  // Weekday visits overlapping the work window
+	TotalSeconds int64   `json:"total_seconds"`
+}
+
+// inHourWindow reports whether hour falls in [start, end), wrapping past midnight if start > end
+func inHourWindow(hour, start, end int) bool {
+	if start <= end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+// stopOverlapsWindow reports whether any hour of a stop (in its local time zone) falls in
+// the window. With weekdaysOnly, only Monday-Friday hours count.
+func stopOverlapsWindow(stop StationaryCluster, start, end int, weekdaysOnly bool) bool {
+	tz := TimezoneFromCoords(stop.CentroidLat, stop.CentroidLon)
+	matches := func(ts int64) bool {
+		t := time.Unix(ts, 0).In(tz)
+		if weekdaysOnly && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
+			return false
+		}
+		return inHourWindow(t.Hour(), start, end)
+	}
+
+	// Sample hourly, so a stop spanning the whole window is caught even if neither end is in it
+	for ts := stop.StartTS; ts < stop.EndTS; ts += 60 * 60 {
+		if matches(ts) {
+			return true
+		}
+	}
+	return matches(stop.EndTS)
+}
+
+// DetectSignificantPlaces clusters all of a user's stops into places and labels the place
+// with the most night visits "Home" and the one with the most weekday daytime visits "Work".
+// Only places with at least MinVisits visits are returned, most visited first.
+func (db *DB) DetectSignificantPlaces(userID string, opts SignificantPlaceOptions) ([]SignificantPlace, error) {
+	params := defaultTimelineParams
+	var places []SignificantPlace
+
+	addStop := func(stop StationaryCluster) {
+		night := stopOverlapsWindow(stop, opts.NightStartHour, opts.NightEndHour, false)
+		work := stopOverlapsWindow(stop, opts.WorkStartHour, opts.WorkEndHour, true)
+
+		place := -1
+		for i := range places {
+			if DistanceMeters(places[i].Lat, places[i].Lon, stop.CentroidLat, stop.CentroidLon) <= significantPlaceRadiusMeters {
+				place = i
+				break
+			}
+		}
+		if place < 0 {
+			places = append(places, SignificantPlace{Lat: stop.CentroidLat, Lon: stop.CentroidLon})
+			place = len(places) - 1
+		} else {
+			// Running mean of visit centroids, so the place settles on its true center
+			p := &places[place]
+			n := float64(p.Visits)
+			p.Lat = (p.Lat*n + stop.CentroidLat) / (n + 1)
+			p.Lon = (p.Lon*n + stop.CentroidLon) / (n + 1)
+		}
+
+		p := &places[place]
+		p.Visits++
+		p.TotalSeconds += stop.EndTS - stop.StartTS
+		if night {
+			p.NightVisits++
+		}
+		if work {
+			p.WorkVisits++
+		}
+	}
+
+	// Detect stops one local day at a time, as the timeline does
+	var curDate string
+	var curPoints []PathPoint
+	flushDay := func() {
+		if len(curPoints) == 0 {
+			return
+		}
+		pruneResult := PruneStationaryPoints(curPoints, params.StayRadiusMeters)
+		for _, cluster := range MergeNearbyClusters(pruneResult.Clusters, params.MergeDistMeters, params.MergeGapSeconds) {
+			if cluster.EndTS-cluster.StartTS >= params.MinStopSeconds {
+				addStop(cluster)
+			}
+		}
+		curPoints = curPoints[:0]
+	}
+
+	err := db.StreamLocations(userID, nil, nil, func(loc Location) error {
+		date := LocalDateFromTimestamp(loc.Timestamp, loc.Lat, loc.Lon)
+		if date != curDate {
+			flushDay()
+			curDate = date
+		}
+		curPoints = append(curPoints, PathPoint{Lat: loc.Lat, Lon: loc.Lon, Timestamp: loc.Timestamp})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	flushDay()
+
+	var result []SignificantPlace
+	for _, p := range places {
+		if p.Visits >= opts.MinVisits {
+			result = append(result, p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Visits > result[j].Visits
+	})
+
+	home := -1
+	for i, p := range result {
+		if p.NightVisits >= opts.MinVisits && (home < 0 || p.NightVisits > result[home].NightVisits) {
+			home = i
+		}
+	}
+	if home >= 0 {
+		result[home].Label = "Home"
+	}
+
+	work := -1
+	for i, p := range result {
+		if i != home && p.WorkVisits >= opts.MinVisits && (work < 0 || p.WorkVisits > result[work].WorkVisits) {
+			work = i
+		}
+	}
+	if work >= 0 {
+		result[work].Label = "Work"
+	}
+
+	return result, nil
+}
+
+// SignificantPlacesCache memoizes DetectSignificantPlaces per user, since it scans all history
+type SignificantPlacesCache struct {
+	db   *DB
+	opts SignificantPlaceOptions
+
+	mu      sync.Mutex
+	entries map[string]significantPlacesEntry
+}
+
+type significantPlacesEntry struct {
+	places     []SignificantPlace
+	computedAt time.Time
+}
+
+// NewSignificantPlacesCache creates a cache that detects places with the given options
+func NewSignificantPlacesCache(db *DB, opts SignificantPlaceOptions) *SignificantPlacesCache {
+	return &SignificantPlacesCache{
+		db:      db,
+		opts:    opts,
+		entries: make(map[string]significantPlacesEntry),
+	}
+}
+
+// Get returns the significant places for a user, recomputing them if the cached copy is stale
+func (c *SignificantPlacesCache) Get(userID string) ([]SignificantPlace, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && time.Since(entry.computedAt) < significantPlacesCacheTTL {
+		return entry.places, nil
+	}
+
+	places, err := c.db.DetectSignificantPlaces(userID, c.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[userID] = significantPlacesEntry{places: places, computedAt: time.Now()}
+	c.mu.Unlock()
+	return places, nil
+}
+
+// significantPlaceLabel returns the Home/Work label of a labeled place near lat/lon, or "" if none
+func significantPlaceLabel(places []SignificantPlace, lat, lon float64) string {
+	for _, p := range places {
+		if p.Label != "" && DistanceMeters(p.Lat, p.Lon, lat, lon) <= significantPlaceRadiusMeters {
+			return p.Label
+		}
+	}
+	return ""
+}
+
+// SignificantPlacesResponse is the API response for /api/places/significant
+type SignificantPlacesResponse struct {
+	UserID  string                  `json:"user_id"`
+	Options SignificantPlaceOptions `json:"options"`
+	Places  []SignificantPlace      `json:"places"`
+}
+
+// GET /api/places/significant - Returns frequently visited places with inferred Home/Work labels
+func (s *Server) handleAPISignificantPlaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := s.queryUserID(r)
+	places, err := s.places.Get(userID)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if places == nil {
+		places = []SignificantPlace{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SignificantPlacesResponse{
+		UserID:  userID,
+		Options: s.places.opts,
+		Places:  places,
+	})
+}
+
+const (
+	// maxPlaceLabelRadiusMeters bounds how large an area a single label may cover
+	maxPlaceLabelRadiusMeters = 5000.0
+
+	// defaultPlaceLabelRadiusMeters is used when a label is created without a radius
+	defaultPlaceLabelRadiusMeters = 100.0
+
+	// metersPerDegreeLat is the approximate length of one degree of latitude
+	metersPerDegreeLat = 111320.0
+)
+
+// PlaceLabel is a user-chosen name for every stop within RadiusM of a point.
+// Labels take priority over inferred Home/Work and reverse geocoding.
+type PlaceLabel struct {
+	ID        int64   `json:"id"`
+	UserID    string  `json:"user_id"`
+	Label     string  `json:"label"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	RadiusM   float64 `json:"radius_m"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+// radiusBBox returns a bounding box enclosing a circle of radiusM around lat/lon
+func radiusBBox(lat, lon, radiusM float64) BBox {
+	dLat := radiusM / metersPerDegreeLat
+	// Clamp near the poles, where a degree of longitude shrinks to nothing
+	dLon := radiusM / (metersPerDegreeLat * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+	return BBox{
+		SwLng: lon - dLon,
+		SwLat: lat - dLat,
+		NeLng: lon + dLon,
+		NeLat: lat + dLat,
+	}
+}
+
+// InsertPlaceLabel stores a place label and returns its ID
+func (db *DB) InsertPlaceLabel(label PlaceLabel) (int64, error) {
+	bbox := radiusBBox(label.Lat, label.Lon, label.RadiusM)
+	result, err := db.Exec(`
+		INSERT INTO place_labels (user_id, label, lat, lon, radius_m, min_lat, max_lat, min_lon, max_lon, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, label.UserID, label.Label, label.Lat, label.Lon, label.RadiusM,
+		bbox.SwLat, bbox.NeLat, bbox.SwLng, bbox.NeLng, label.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// DeletePlaceLabel removes a place label. Returns false if no label with that ID belongs to the user.
+// Empty userID matches labels of any user.
+func (db *DB) DeletePlaceLabel(userID string, id int64) (bool, error) {
+	query := `DELETE FROM place_labels WHERE id = ?`
+	args := []any{id}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListPlaceLabels returns a user's place labels, newest first (empty userID = all users)
+func (db *DB) ListPlaceLabels(userID string) ([]PlaceLabel, error) {
+	query := `SELECT id, user_id, label, lat, lon, radius_m, created_at FROM place_labels`
+	var args []any
+	if userID != "" {
+		query += " WHERE user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []PlaceLabel{}
+	for rows.Next() {
+		var l PlaceLabel
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Label, &l.Lat, &l.Lon, &l.RadiusM, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	return labels, rows.Err()
+}
+
+// LookupPlaceLabel returns the user's label whose circle contains lat/lon, or nil if none.
+// When labels overlap, the one centered closest to the point wins.
+func (db *DB) LookupPlaceLabel(userID string, lat, lon float64) (*PlaceLabel, error) {
+	// The bbox index narrows candidates; the exact radius check is done below
+	query := `
+		SELECT id, user_id, label, lat, lon, radius_m, created_at FROM place_labels
+		WHERE ? >= min_lat AND ? <= max_lat AND ? >= min_lon AND ? <= max_lon`
+	args := []any{lat, lat, lon, lon}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var best *PlaceLabel
+	var bestDist float64
+	for rows.Next() {
+		var l PlaceLabel
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Label, &l.Lat, &l.Lon, &l.RadiusM, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		dist := DistanceMeters(l.Lat, l.Lon, lat, lon)
+		if dist <= l.RadiusM && (best == nil || dist < bestDist) {
+			best, bestDist = &l, dist
+		}
+	}
+	return best, rows.Err()
+}
+
+// PlaceLabelRequest is the body of POST /api/places/label
+type PlaceLabelRequest struct {
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	RadiusM float64 `json:"radius_m"`
+	Label   string  `json:"label"`
+}
+
+// /api/places/label - Manages user place labels
+// GET lists labels, POST creates one from {lat, lon, radius_m, label}, DELETE ?id= removes one.
+func (s *Server) handleAPIPlaceLabel(w http.ResponseWriter, r *http.Request) {
+	// With auth enabled, users can only see and change their own labels
+	userID := ingestUserID(r, s.queryUserID(r))
+
+	switch r.Method {
+	case http.MethodGet:
+		labels, err := s.db.ListPlaceLabels(userID)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(labels)
+
+	case http.MethodPost:
+		var req PlaceLabelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Label = strings.TrimSpace(req.Label)
+		if req.Label == "" {
+			http.Error(w, "label required", http.StatusBadRequest)
+			return
+		}
+		if req.Lat < -90 || req.Lat > 90 || req.Lon < -180 || req.Lon > 180 {
+			http.Error(w, "invalid lat/lon", http.StatusBadRequest)
+			return
+		}
+		if req.RadiusM <= 0 {
+			req.RadiusM = defaultPlaceLabelRadiusMeters
+		}
+		req.RadiusM = math.Min(req.RadiusM, maxPlaceLabelRadiusMeters)
+
+		label := PlaceLabel{
+			UserID:    userID,
+			Label:     req.Label,
+			Lat:       req.Lat,
+			Lon:       req.Lon,
+			RadiusM:   req.RadiusM,
+			CreatedAt: time.Now().Unix(),
+		}
+		id, err := s.db.InsertPlaceLabel(label)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		label.ID = id
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(label)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id required", http.StatusBadRequest)
+			return
+		}
+		found, err := s.db.DeletePlaceLabel(userID, id)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "label not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// placeNames names points in priority order: user label -> inferred Home/Work -> geocache -> Nominatim.
+// Points named by an earlier source skip the later ones; unnamed points get "".
+func (s *Server) placeNames(ctx context.Context, userID string, points []LatLon) []string {
+	return s.placeNamesWithHints(ctx, userID, points, nil)
+}
+
+// placeNamesWithHints is placeNames with an optional known name per point (such as Immich's
+// place for a photo), used after user labels and Home/Work but before geocoding.
+// hints may be nil or have "" for points without one.
+func (s *Server) placeNamesWithHints(ctx context.Context, userID string, points []LatLon, hints []string) []string {
+	names := make([]string, len(points))
+
+	for i, pt := range points {
+		label, err := s.db.LookupPlaceLabel(userID, pt.Lat, pt.Lon)
+		if err != nil {
+			fmt.Printf("warning: failed to look up place label: %v\n", err)
+		} else if label != nil {
+			names[i] = label.Label
+		}
+	}
+
+	if s.places != nil && len(points) > 0 {
+		places, err := s.places.Get(userID)
+		if err != nil {
+			fmt.Printf("warning: failed to detect significant places: %v\n", err)
+		}
+		for i, pt := range points {
+			if names[i] == "" {
+				names[i] = significantPlaceLabel(places, pt.Lat, pt.Lon)
+			}
+		}
+	}
+
+	for i, hint := range hints {
+		if names[i] == "" {
+			names[i] = hint
+		}
+	}
+
+	// Batch geocode only the points still unnamed
+	if s.geocoder != nil {
+		var geoIndices []int
+		var geoPoints []LatLon
+		for i, pt := range points {
+			if names[i] == "" {
+				geoIndices = append(geoIndices, i)
+				geoPoints = append(geoPoints, pt)
+			}
+		}
+
+		if len(geoPoints) > 0 {
+			geocoded, err := s.geocoder.ReverseGeocodeBatch(ctx, geoPoints)
+			if err == nil {
+				for geoIdx, pointIdx := range geoIndices {
+					if place, ok := geocoded[geoIdx]; ok && place != nil {
+						names[pointIdx] = place.PlaceName
+					}
+				}
+			}
+		}
+	}
+
+	return names
+}
@@ -2,7 +2,12 @@ package main
 
 // PathPoint represents a single point in a path
 type PathPoint struct {
-	Lat       float64 `json:"lat"`
-	Lon       float64 `json:"lon"`
-	Timestamp int64   `json:"timestamp"`
+	Lat       float64  `json:"lat"`
+	Lon       float64  `json:"lon"`
+	Timestamp int64    `json:"timestamp"`
+	AccuracyM *float64 `json:"accuracy_m,omitempty"` // meters, nil if unknown
+	Source    *string  `json:"source,omitempty"`     // Location source (GPS, WIFI, CELL, app name), nil if unknown
+	// DurationSec is set on points that stand in for a stationary cluster:
+	// the stay began at Timestamp and lasted this many seconds
+	DurationSec int64 `json:"duration_s,omitempty"`
 }
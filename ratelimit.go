@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// deviceBucketIdle is how long a device's bucket is kept after its last request.
+// A bucket idle this long has refilled completely, so forgetting it changes nothing.
+const deviceBucketIdle = 10 * time.Minute
+
+// tokenBucket allows bursts of up to burst requests, refilling at rate per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// DeviceRateLimiter limits ingestion requests per user and device with a token bucket each.
+// Buckets live in a sync.Map with their own locks, so devices never wait on each other,
+// and are dropped once idle.
+type DeviceRateLimiter struct {
+	rate    float64 // Tokens added per second
+	burst   float64 // Bucket capacity
+	buckets sync.Map
+}
+
+type deviceRateKey struct{ userID, deviceID string }
+
+// NewDeviceRateLimiter creates a limiter and starts expiring idle buckets
+func NewDeviceRateLimiter(rate float64, burst int) *DeviceRateLimiter {
+	l := &DeviceRateLimiter{rate: rate, burst: float64(burst)}
+	go func() {
+		ticker := time.NewTicker(deviceBucketIdle)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			l.expire(now)
+		}
+	}()
+	return l
+}
+
+// Allow takes a token from the device's bucket, reporting false if it is empty.
+// A nil limiter allows everything.
+func (l *DeviceRateLimiter) Allow(userID, deviceID string) bool {
+	if l == nil {
+		return true
+	}
+
+	now := time.Now()
+	v, ok := l.buckets.Load(deviceRateKey{userID, deviceID})
+	if !ok {
+		v, _ = l.buckets.LoadOrStore(deviceRateKey{userID, deviceID}, &tokenBucket{tokens: l.burst, last: now})
+	}
+	b := v.(*tokenBucket)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// expire forgets buckets not used for deviceBucketIdle
+func (l *DeviceRateLimiter) expire(now time.Time) {
+	l.buckets.Range(func(key, v any) bool {
+		b := v.(*tokenBucket)
+		b.mu.Lock()
+		idle := now.Sub(b.last) >= deviceBucketIdle
+		b.mu.Unlock()
+		if idle {
+			l.buckets.CompareAndDelete(key, v)
+		}
+		return true
+	})
+}
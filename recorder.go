@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxRecLineBytes bounds a single .rec line; location messages are well under 1 KB
+const maxRecLineBytes = 1 << 20
+
+// ParseOwnTracksRec extracts locations from an OwnTracks Recorder .rec file.
+// Each line is "<ISO time>\t<label>\t<JSON message>"; bare line-delimited JSON messages
+// are accepted too. Blank lines, lines without a JSON object, and non-location messages
+// are skipped. Malformed messages are reported and skipped.
+// Returned locations have no UserID or DeviceID set.
+func ParseOwnTracksRec(r io.Reader) ([]Location, []error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecLineBytes)
+
+	var locations []Location
+	var errors []error
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		start := bytes.IndexByte(line, '{')
+		if start < 0 {
+			continue
+		}
+
+		var payload OwnTracksPayload
+		if err := json.Unmarshal(line[start:], &payload); err != nil {
+			errors = append(errors, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		if payload.Type != "location" {
+			continue
+		}
+
+		loc, err := payload.toLocation()
+		if err != nil {
+			errors = append(errors, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		locations = append(locations, loc)
+	}
+	if err := scanner.Err(); err != nil {
+		errors = append(errors, fmt.Errorf("failed to read .rec file: %w", err))
+	}
+	return locations, errors
+}
+
+// toLocation converts an OwnTracks location message to a Location without user or device
+func (p OwnTracksPayload) toLocation() (Location, error) {
+	ts := p.FixTimestamp()
+	if ts == 0 {
+		return Location{}, fmt.Errorf("missing tst")
+	}
+	if err := validateCoords(p.Lat, p.Lon); err != nil {
+		return Location{}, err
+	}
+
+	src := "owntracks"
+	return Location{
+		Timestamp: ts,
+		Lat:       p.Lat,
+		Lon:       p.Lon,
+		AccuracyM: p.Accuracy,
+		AltitudeM: p.Altitude,
+		SpeedKmh:  p.Velocity,
+		Source:    &src,
+	}, nil
+}
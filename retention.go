@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// retentionInterval is how often raw location retention is applied after startup
+	retentionInterval = 24 * time.Hour
+
+	// retentionBatchSize bounds how many rows each delete transaction removes,
+	// so pruning a large backlog doesn't hold the write lock for long
+	retentionBatchSize = 10000
+)
+
+// ApplyRetention deletes raw locations (and their location_sources rows) older than maxAge.
+// Pre-computed paths are left intact, so the map keeps showing pruned days.
+// Returns the number of locations deleted.
+func (db *DB) ApplyRetention(maxAge time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-maxAge).Unix()
+
+	var total int64
+	for {
+		n, err := db.deleteLocationsBefore(cutoff, retentionBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// deleteLocationsBefore deletes up to limit locations older than cutoff in one transaction
+func (db *DB) deleteLocationsBefore(cutoff int64, limit int) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const batch = `SELECT timestamp, device_id, seq FROM locations WHERE timestamp < ? ORDER BY timestamp, device_id, seq LIMIT ?`
+
+	_, err = tx.Exec(`DELETE FROM location_sources WHERE (timestamp, device_id, seq) IN (`+batch+`)`, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM locations WHERE (timestamp, device_id, seq) IN (`+batch+`)`, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+// StartRetention applies raw location retention now and then daily in the background
+func StartRetention(db *DB, maxAge time.Duration) {
+	apply := func() {
+		pruned, err := db.ApplyRetention(maxAge)
+		if err != nil {
+			log.Printf("retention: failed to prune raw locations: %v", err)
+			return
+		}
+		log.Printf("retention: pruned %d raw locations older than %s", pruned, maxAge)
+	}
+
+	go func() {
+		apply()
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			apply()
+		}
+	}()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+)
+
+// insertRetentionTestDays stores three hourly London points on each of two January days,
+// builds their paths, and returns the timestamps in order
+func insertRetentionTestDays(t *testing.T, db *DB) []int64 {
+	t.Helper()
+	var timestamps []int64
+	for _, day := range []int{10, 11} {
+		for hour := 10; hour <= 12; hour++ {
+			ts := time.Date(2024, time.January, day, hour, 0, 0, 0, time.UTC).Unix()
+			loc := Location{
+				Timestamp: ts,
+				UserID:    "alice",
+				DeviceID:  "phone",
+				Lat:       51.5074 + float64(hour-10)*0.01,
+				Lon:       -0.1278,
+			}
+			if err := db.InsertLocation(loc); err != nil {
+				t.Fatalf("InsertLocation: %v", err)
+			}
+			timestamps = append(timestamps, ts)
+		}
+	}
+	if err := db.RebuildAllPaths(); err != nil {
+		t.Fatalf("RebuildAllPaths: %v", err)
+	}
+	return timestamps
+}
+
+// countPathPoints returns the number of path points per local date for a user
+func countPathPoints(t *testing.T, db *DB, userID string) map[string]int {
+	t.Helper()
+	paths, err := db.QueryPathsByBBox(userID, worldBBox, nil, nil)
+	if err != nil {
+		t.Fatalf("QueryPathsByBBox: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, path := range paths {
+		points, err := db.GetPathPoints(path.ID)
+		if err != nil {
+			t.Fatalf("GetPathPoints: %v", err)
+		}
+		counts[path.Date] += len(points)
+	}
+	return counts
+}
+
+func TestApplyRetentionKeepsPaths(t *testing.T) {
+	db := openTestDB(t)
+	timestamps := insertRetentionTestDays(t, db)
+
+	// Prune all of the first day
+	maxAge := time.Since(time.Unix(timestamps[3]-1800, 0))
+	pruned, err := db.ApplyRetention(maxAge)
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	if pruned != 3 {
+		t.Errorf("pruned %d locations, want 3", pruned)
+	}
+
+	locs, err := db.QueryLocationsByUserDate("alice", "2024-01-10")
+	if err != nil {
+		t.Fatalf("QueryLocationsByUserDate: %v", err)
+	}
+	if len(locs) != 0 {
+		t.Errorf("%d raw locations left on the pruned day, want 0", len(locs))
+	}
+
+	want := map[string]int{"2024-01-10": 3, "2024-01-11": 3}
+	if got := countPathPoints(t, db, "alice"); !maps.Equal(got, want) {
+		t.Errorf("path points after retention = %v, want %v", got, want)
+	}
+}
+
+func TestRebuildAllPathsKeepsPartlyPrunedPaths(t *testing.T) {
+	db := openTestDB(t)
+	timestamps := insertRetentionTestDays(t, db)
+
+	// Prune the first point of the first day only
+	if _, err := db.deleteLocationsBefore(timestamps[1], retentionBatchSize); err != nil {
+		t.Fatalf("deleteLocationsBefore: %v", err)
+	}
+	if err := db.RebuildAllPaths(); err != nil {
+		t.Fatalf("RebuildAllPaths: %v", err)
+	}
+
+	want := map[string]int{"2024-01-10": 3, "2024-01-11": 3}
+	if got := countPathPoints(t, db, "alice"); !maps.Equal(got, want) {
+		t.Errorf("path points after rebuild = %v, want %v", got, want)
+	}
+}
+
+func TestRebuildPathForDateKeepsRetainedPaths(t *testing.T) {
+	want := map[string]int{"2024-01-10": 3, "2024-01-11": 3}
+
+	t.Run("fully pruned day", func(t *testing.T) {
+		db := openTestDB(t)
+		timestamps := insertRetentionTestDays(t, db)
+		if _, err := db.deleteLocationsBefore(timestamps[3], retentionBatchSize); err != nil {
+			t.Fatalf("deleteLocationsBefore: %v", err)
+		}
+
+		if _, err := db.RebuildPathForDate("alice", "2024-01-10"); !errors.Is(err, ErrPathRetained) {
+			t.Errorf("RebuildPathForDate error = %v, want %v", err, ErrPathRetained)
+		}
+		if got := countPathPoints(t, db, "alice"); !maps.Equal(got, want) {
+			t.Errorf("path points after rebuild = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("partly pruned day with a new point", func(t *testing.T) {
+		db := openTestDB(t)
+		timestamps := insertRetentionTestDays(t, db)
+		if _, err := db.deleteLocationsBefore(timestamps[2], retentionBatchSize); err != nil {
+			t.Fatalf("deleteLocationsBefore: %v", err)
+		}
+
+		loc := Location{Timestamp: timestamps[2] + 600, UserID: "alice", DeviceID: "phone", Lat: 51.53, Lon: -0.1278}
+		if err := db.InsertLocation(loc); err != nil {
+			t.Fatalf("InsertLocation: %v", err)
+		}
+		if err := db.UpdatePathsForLocations([]Location{loc}); err != nil {
+			t.Fatalf("UpdatePathsForLocations: %v", err)
+		}
+		if got := countPathPoints(t, db, "alice"); !maps.Equal(got, want) {
+			t.Errorf("path points after update = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("deleted day after unpruned history", func(t *testing.T) {
+		db := openTestDB(t)
+		timestamps := insertRetentionTestDays(t, db)
+
+		var deleted []Location
+		for _, ts := range timestamps[3:] {
+			locs, err := db.DeleteLocation("alice", ts, "phone")
+			if err != nil {
+				t.Fatalf("DeleteLocation: %v", err)
+			}
+			deleted = append(deleted, locs...)
+		}
+		if err := db.UpdatePathsForLocations(deleted); err != nil {
+			t.Fatalf("UpdatePathsForLocations: %v", err)
+		}
+		want := map[string]int{"2024-01-10": 3}
+		if got := countPathPoints(t, db, "alice"); !maps.Equal(got, want) {
+			t.Errorf("path points after delete = %v, want %v", got, want)
+		}
+	})
+}
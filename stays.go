@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Stay is a place the user stopped, as found by the timeline's stop detection
+type Stay struct {
+	StationaryCluster
+	Date            string `json:"date"` // Local day the stay began
+	DurationSeconds int64  `json:"duration_seconds"`
+	PlaceName       string `json:"place_name,omitempty"`
+}
+
+// StaysResponse is the API response for /api/stays
+type StaysResponse struct {
+	Params TimelineParams `json:"params"`
+	Stays  []Stay         `json:"stays"`
+}
+
+// dayStays detects the stays for one local day. Places are unnamed.
+func (s *Server) dayStays(userID, date string, params TimelineParams) ([]Stay, error) {
+	locations, err := s.db.QueryLocationsByUserDate(userID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]PathPoint, len(locations))
+	for i, loc := range locations {
+		points[i] = PathPoint{Lat: loc.Lat, Lon: loc.Lon, Timestamp: loc.Timestamp}
+	}
+
+	var stays []Stay
+	for _, stop := range DetectStops(points, params) {
+		stays = append(stays, Stay{
+			StationaryCluster: stop,
+			Date:              date,
+			DurationSeconds:   stop.EndTS - stop.StartTS,
+		})
+	}
+	return stays, nil
+}
+
+// GET /api/stays - Returns the places stopped at on a date, or each day of a start/end date range
+// Lighter than /api/timeline: no travel segments or photos. Accepts the same stay params.
+func (s *Server) handleAPIStays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	params, err := parseTimelineParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	startStr, endStr := q.Get("start"), q.Get("end")
+	if date := q.Get("date"); date != "" {
+		startStr, endStr = date, date
+	}
+	start, err1 := time.Parse("2006-01-02", startStr)
+	end, err2 := time.Parse("2006-01-02", endStr)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "date or start and end required (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) {
+		http.Error(w, "end must not be before start", http.StatusBadRequest)
+		return
+	}
+	if end.Sub(start) >= maxTimelineRangeDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("range too long (max %d days)", maxTimelineRangeDays), http.StatusBadRequest)
+		return
+	}
+
+	userID := s.queryUserID(r)
+	stays := []Stay{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		dayStays, err := s.dayStays(userID, d.Format("2006-01-02"), params)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		stays = append(stays, dayStays...)
+	}
+
+	// Name every stay in one batch
+	points := make([]LatLon, len(stays))
+	for i, stay := range stays {
+		points[i] = LatLon{Lat: stay.CentroidLat, Lon: stay.CentroidLon}
+	}
+	names := s.placeNames(context.Background(), userID, points)
+	for i := range stays {
+		stays[i].PlaceName = names[i]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StaysResponse{Params: params, Stays: stays})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLiveSubscribers caps concurrent /api/stream/location clients
+	maxLiveSubscribers = 100
+
+	// liveSubscriberBuffer is how many events a slow subscriber may fall behind
+	// before further events are dropped for it
+	liveSubscriberBuffer = 32
+
+	// liveKeepaliveInterval is how often an idle stream sends a comment to keep proxies from closing it
+	liveKeepaliveInterval = 30 * time.Second
+)
+
+// LocationEvent is a newly ingested point sent to live stream subscribers
+type LocationEvent struct {
+	UserID    string  `json:"user_id"`
+	DeviceID  string  `json:"device_id"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// newLocationEvent converts a stored location to its event form
+func newLocationEvent(loc Location) LocationEvent {
+	return LocationEvent{
+		UserID:    loc.UserID,
+		DeviceID:  loc.DeviceID,
+		Lat:       loc.Lat,
+		Lon:       loc.Lon,
+		Timestamp: loc.Timestamp,
+	}
+}
+
+// LocationBroadcaster fans out newly ingested locations to live subscribers.
+// Publishing never blocks: events for a subscriber whose buffer is full are dropped.
+type LocationBroadcaster struct {
+	mu   sync.Mutex
+	subs map[chan LocationEvent]struct{}
+}
+
+// NewLocationBroadcaster creates a broadcaster with no subscribers
+func NewLocationBroadcaster() *LocationBroadcaster {
+	return &LocationBroadcaster{
+		subs: make(map[chan LocationEvent]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber. Returns ok=false if the subscriber cap is reached.
+// The returned function must be called to unsubscribe.
+func (b *LocationBroadcaster) Subscribe() (<-chan LocationEvent, func(), bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.subs) >= maxLiveSubscribers {
+		return nil, nil, false
+	}
+
+	ch := make(chan LocationEvent, liveSubscriberBuffer)
+	b.subs[ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, ch)
+	}
+	return ch, unsubscribe, true
+}
+
+// Publish sends locations to all subscribers (non-blocking). Safe to call on a nil broadcaster.
+func (b *LocationBroadcaster) Publish(locs []Location) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, loc := range locs {
+		event := newLocationEvent(loc)
+		for ch := range b.subs {
+			select {
+			case ch <- event:
+			default:
+				// Drop if channel is full (slow consumer)
+			}
+		}
+	}
+}
+
+// untilClosing returns a context that also ends when closing does. Long-lived SSE streams
+// use it so they end when shutdown starts, while other requests drain normally.
+func untilClosing(ctx, closing context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if closing == nil {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(closing, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// GET /api/stream/location - Streams newly ingested locations via SSE
+// Optional ?user= limits events to one user; without it all users are streamed.
+func (s *Server) handleAPIStreamLocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe, ok := s.live.Subscribe()
+	if !ok {
+		http.Error(w, "too many subscribers", http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(liveKeepaliveInterval)
+	defer keepalive.Stop()
+
+	ctx, cancel := untilClosing(r.Context(), s.closing)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			// Client disconnected
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			if userID != "" && event.UserID != userID {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: location\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DaySummary is the API response for /api/summary
+type DaySummary struct {
+	Date    string `json:"date"`
+	Summary string `json:"summary"`
+}
+
+// travelVerbs describes a travel segment by its detected mode
+var travelVerbs = map[string]string{
+	"walk":    "walked",
+	"cycle":   "cycled",
+	"drive":   "drove",
+	"transit": "took transit",
+	"fly":     "flew",
+}
+
+// summarizeDay renders a day's timeline entries as a sentence, e.g.
+// "Home until 9:12, drove 14 km to Downtown Office (9:31–17:40), then drove 4.2 km home by 18:30."
+// Stops must already be named. points are the day's raw locations, used to describe a day
+// with no stops.
+func summarizeDay(date string, entries []TimelineEntry, points []PathPoint) string {
+	if len(entries) == 0 {
+		return summarizeMovingDay(date, points)
+	}
+	if len(entries) == 1 && entries[0].EntryType == "stop" {
+		return capitalize(summaryPlace(entries[0])) + " all day."
+	}
+
+	var clauses []string
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if e.EntryType == "stop" {
+			if i == 0 {
+				clauses = append(clauses, summaryPlace(e)+" until "+summaryTime(entryEnd(e), e.Lat, e.Lon))
+			} else {
+				clauses = append(clauses, summaryStop(e, i == len(entries)-1))
+			}
+			continue
+		}
+
+		// Describe travel together with the stop it ends at
+		travel := summaryTravel(e)
+		if i+1 < len(entries) && entries[i+1].EntryType == "stop" {
+			i++
+			stop := entries[i]
+			if i == len(entries)-1 {
+				travel += " " + summaryArrival(stop)
+			} else {
+				travel += " to " + summaryStop(stop, false)
+			}
+		} else {
+			travel += " until " + summaryTime(entryEnd(e), e.Lat, e.Lon)
+		}
+		clauses = append(clauses, travel)
+	}
+
+	// "then" marks each step after the first journey
+	for i := 2; i < len(clauses); i++ {
+		clauses[i] = "then " + clauses[i]
+	}
+	return capitalize(strings.Join(clauses, ", ")) + "."
+}
+
+// summarizeMovingDay describes a day with locations but no stops as one journey
+func summarizeMovingDay(date string, points []PathPoint) string {
+	switch len(points) {
+	case 0:
+		return fmt.Sprintf("No location data for %s.", date)
+	case 1:
+		return "One location recorded, at " + summaryTime(points[0].Timestamp, points[0].Lat, points[0].Lon) + "."
+	}
+
+	var distance float64
+	for i := 1; i < len(points); i++ {
+		distance += DistanceMeters(points[i-1].Lat, points[i-1].Lon, points[i].Lat, points[i].Lon)
+	}
+	first, last := points[0], points[len(points)-1]
+	travel := summaryTravel(TimelineEntry{Mode: ClassifyMode(points), DistanceMeters: &distance})
+	return fmt.Sprintf("%s from %s to %s without stopping.", capitalize(travel),
+		summaryTime(first.Timestamp, first.Lat, first.Lon), summaryTime(last.Timestamp, last.Lat, last.Lon))
+}
+
+// summaryStop describes a stop as its place and visit times
+func summaryStop(e TimelineEntry, last bool) string {
+	if last {
+		return summaryArrival(e)
+	}
+	return fmt.Sprintf("%s (%s–%s)", summaryPlace(e), summaryTime(e.Timestamp, e.Lat, e.Lon), summaryTime(entryEnd(e), e.Lat, e.Lon))
+}
+
+// summaryArrival describes the day's final stop by when it was reached
+func summaryArrival(e TimelineEntry) string {
+	place := "to " + summaryPlace(e)
+	if e.PlaceName == "Home" {
+		place = "home"
+	}
+	return place + " by " + summaryTime(e.Timestamp, e.Lat, e.Lon)
+}
+
+// summaryTravel describes a travel segment's mode and distance
+func summaryTravel(e TimelineEntry) string {
+	verb, ok := travelVerbs[e.Mode]
+	if !ok {
+		verb = "traveled"
+	}
+	if e.DistanceMeters == nil {
+		return verb
+	}
+	return verb + " " + summaryDistance(*e.DistanceMeters)
+}
+
+// summaryPlace returns a stop's place name
+func summaryPlace(e TimelineEntry) string {
+	if e.PlaceName == "" {
+		return "an unnamed place"
+	}
+	return e.PlaceName
+}
+
+// summaryDistance formats meters as e.g. "450 m", "4.2 km", or "14 km"
+func summaryDistance(meters float64) string {
+	switch {
+	case meters < 1000:
+		return fmt.Sprintf("%.0f m", meters)
+	case meters < 10000:
+		return fmt.Sprintf("%.1f km", meters/1000)
+	default:
+		return fmt.Sprintf("%.0f km", meters/1000)
+	}
+}
+
+// summaryTime formats a timestamp as H:MM in the local time at lat/lon
+func summaryTime(ts int64, lat, lon float64) string {
+	t := time.Unix(ts, 0).In(TimezoneFromCoords(lat, lon))
+	return fmt.Sprintf("%d:%02d", t.Hour(), t.Minute())
+}
+
+// entryEnd returns when an entry ended, or when it started if it has no end
+func entryEnd(e TimelineEntry) int64 {
+	if e.EndTimestamp != nil {
+		return *e.EndTimestamp
+	}
+	return e.Timestamp
+}
+
+// capitalize upper-cases the first letter of s, which may be multi-byte (e.g. "école")
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// GET /api/summary - Returns a one-sentence description of a day, built from its timeline
+// Accepts the same date and stay params as /api/timeline.
+func (s *Server) handleAPISummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	params, err := parseTimelineParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dateStr := q.Get("date")
+	if _, err := time.Parse("2006-01-02", dateStr); err != nil {
+		http.Error(w, "date parameter required (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+
+	userID := s.queryUserID(r)
+	entries, err := s.timelineDayEntries(userID, dateStr, params)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.nameTimelineStops(context.Background(), userID, [][]TimelineEntry{entries})
+
+	// Without stops, the summary is built from the raw locations, if there are any
+	var points []PathPoint
+	if len(entries) == 0 {
+		locations, err := s.db.QueryLocationsByUserDate(userID, dateStr)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		for _, loc := range locations {
+			points = append(points, PathPoint{Lat: loc.Lat, Lon: loc.Lon, Timestamp: loc.Timestamp})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DaySummary{
+		Date:    dateStr,
+		Summary: summarizeDay(dateStr, entries, points),
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCapitalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"home", "Home"},
+		{"école", "École"},
+		{"über", "Über"},
+		{"東京", "東京"},
+		{"Home", "Home"},
+	}
+	for _, tt := range tests {
+		if got := capitalize(tt.in); got != tt.want {
+			t.Errorf("capitalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeDay(t *testing.T) {
+	// London in January is on UTC, so local times match these
+	const lat, lon = 51.5074, -0.1278
+	at := func(hour, minute int) int64 {
+		return time.Date(2024, 1, 15, hour, minute, 0, 0, time.UTC).Unix()
+	}
+	ptr := func(v int64) *int64 { return &v }
+	dist := func(m float64) *float64 { return &m }
+
+	t.Run("no data", func(t *testing.T) {
+		want := "No location data for 2024-01-15."
+		if got := summarizeDay("2024-01-15", nil, nil); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("one stop all day", func(t *testing.T) {
+		entries := []TimelineEntry{
+			{EntryType: "stop", PlaceName: "Home", Timestamp: at(0, 0), EndTimestamp: ptr(at(23, 59)), Lat: lat, Lon: lon},
+		}
+		want := "Home all day."
+		if got := summarizeDay("2024-01-15", entries, nil); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("commute", func(t *testing.T) {
+		entries := []TimelineEntry{
+			{EntryType: "stop", PlaceName: "Home", Timestamp: at(0, 0), EndTimestamp: ptr(at(9, 12)), Lat: lat, Lon: lon},
+			{EntryType: "travel", Mode: "drive", DistanceMeters: dist(14000), Timestamp: at(9, 12), EndTimestamp: ptr(at(9, 31)), Lat: lat, Lon: lon},
+			{EntryType: "stop", PlaceName: "Office", Timestamp: at(9, 31), EndTimestamp: ptr(at(17, 40)), Lat: lat, Lon: lon},
+			{EntryType: "travel", Mode: "drive", DistanceMeters: dist(4200), Timestamp: at(17, 40), EndTimestamp: ptr(at(18, 30)), Lat: lat, Lon: lon},
+			{EntryType: "stop", PlaceName: "Home", Timestamp: at(18, 30), EndTimestamp: ptr(at(23, 59)), Lat: lat, Lon: lon},
+		}
+		want := "Home until 9:12, drove 14 km to Office (9:31–17:40), then drove 4.2 km home by 18:30."
+		if got := summarizeDay("2024-01-15", entries, nil); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("moving all day", func(t *testing.T) {
+		// About 1.1 km north every 10 minutes (walking pace), never stopping
+		var points []PathPoint
+		for i := range 6 {
+			points = append(points, PathPoint{Lat: lat + float64(i)*0.01, Lon: lon, Timestamp: at(9, 10*i)})
+		}
+		want := "Walked 5.6 km from 9:00 to 9:50 without stopping."
+		if got := summarizeDay("2024-01-15", nil, points); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("single point", func(t *testing.T) {
+		points := []PathPoint{{Lat: lat, Lon: lon, Timestamp: at(12, 5)}}
+		want := "One location recorded, at 12:05."
+		if got := summarizeDay("2024-01-15", nil, points); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
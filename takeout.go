@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// takeoutRecord is one entry of a Google Takeout Records.json "locations" array
+type takeoutRecord struct {
+	LatitudeE7  *int64 `json:"latitudeE7"`
+	LongitudeE7 *int64 `json:"longitudeE7"`
+	TimestampMs string `json:"timestampMs"` // Older exports: Unix milliseconds as a string
+	Timestamp   string `json:"timestamp"`   // Newer exports: ISO 8601
+	Accuracy    *int   `json:"accuracy"`    // meters
+	Altitude    *int   `json:"altitude"`    // meters
+	Velocity    *int   `json:"velocity"`    // m/s
+	Source      string `json:"source"`      // GPS, WIFI, CELL, UNKNOWN
+}
+
+// e7ToDegrees converts an E7 coordinate to decimal degrees.
+// Some exports store values past the valid range as unsigned 32-bit overflows; unwrap them.
+func e7ToDegrees(e7 int64, limit float64) float64 {
+	deg := float64(e7) / 1e7
+	if deg > limit {
+		deg = float64(e7-(1<<32)) / 1e7
+	}
+	return deg
+}
+
+// ParseTakeoutRecords extracts locations from a Google Takeout Records.json file.
+// The locations array is decoded one element at a time, so multi-gigabyte exports
+// never need to be held in memory as JSON. Malformed records are reported and skipped.
+// Returned locations have no UserID or DeviceID set.
+func ParseTakeoutRecords(r io.Reader) ([]Location, []error) {
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, []error{fmt.Errorf("failed to parse Records.json: %w", err)}
+	}
+
+	var locations []Location
+	var errors []error
+	foundLocations := false
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return locations, append(errors, fmt.Errorf("failed to parse Records.json: %w", err))
+		}
+		if key != "locations" {
+			// Skip unrelated top-level values
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return locations, append(errors, fmt.Errorf("failed to parse Records.json: %w", err))
+			}
+			continue
+		}
+
+		foundLocations = true
+		if err := expectDelim(dec, '['); err != nil {
+			return locations, append(errors, fmt.Errorf("failed to parse locations array: %w", err))
+		}
+		for i := 0; dec.More(); i++ {
+			var rec takeoutRecord
+			if err := dec.Decode(&rec); err != nil {
+				// The stream can't be resynchronized after a syntax error
+				return locations, append(errors, fmt.Errorf("record %d: %w", i, err))
+			}
+			loc, err := rec.toLocation()
+			if err != nil {
+				errors = append(errors, fmt.Errorf("record %d: %w", i, err))
+				continue
+			}
+			locations = append(locations, loc)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return locations, append(errors, fmt.Errorf("failed to parse locations array: %w", err))
+		}
+	}
+
+	if !foundLocations {
+		errors = append(errors, fmt.Errorf("no locations array found; is this a Takeout Records.json file?"))
+	}
+	return locations, errors
+}
+
+// expectDelim reads the next token and checks that it is the given delimiter
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// toLocation converts a Takeout record to a Location
+func (rec takeoutRecord) toLocation() (Location, error) {
+	if rec.LatitudeE7 == nil || rec.LongitudeE7 == nil {
+		return Location{}, fmt.Errorf("missing latitudeE7/longitudeE7")
+	}
+
+	var ts int64
+	switch {
+	case rec.TimestampMs != "":
+		ms, err := strconv.ParseInt(rec.TimestampMs, 10, 64)
+		if err != nil {
+			return Location{}, fmt.Errorf("invalid timestampMs %q: %w", rec.TimestampMs, err)
+		}
+		ts = ms / 1000
+	case rec.Timestamp != "":
+		t, err := time.Parse(time.RFC3339, rec.Timestamp)
+		if err != nil {
+			return Location{}, fmt.Errorf("invalid timestamp %q: %w", rec.Timestamp, err)
+		}
+		ts = t.Unix()
+	default:
+		return Location{}, fmt.Errorf("missing timestamp")
+	}
+
+	loc := Location{
+		Timestamp: ts,
+		Lat:       e7ToDegrees(*rec.LatitudeE7, 90),
+		Lon:       e7ToDegrees(*rec.LongitudeE7, 180),
+	}
+	if err := validateCoords(loc.Lat, loc.Lon); err != nil {
+		return Location{}, err
+	}
+
+	if rec.Accuracy != nil {
+		acc := float64(*rec.Accuracy)
+		loc.AccuracyM = &acc
+	}
+	if rec.Altitude != nil {
+		alt := float64(*rec.Altitude)
+		loc.AltitudeM = &alt
+	}
+	if rec.Velocity != nil {
+		// Convert m/s to km/h
+		speed := float64(*rec.Velocity) * 3.6
+		loc.SpeedKmh = &speed
+	}
+	if rec.Source != "" {
+		src := rec.Source
+		loc.Source = &src
+	}
+
+	return loc, nil
+}
@@ -4,6 +4,7 @@ import (
 	"embed"
 	"html/template"
 	"io"
+	"strconv"
 	"sync"
 )
 
@@ -78,43 +79,25 @@ func formatDate(ts int64) string {
 	return formatTimestamp(ts)
 }
 
+// formatNum renders an integer with thousands separators, e.g. 1234567 -> "1,234,567"
 func formatNum(n int) string {
-	if n < 1000 {
-		return string(rune('0'+n%10) + rune('0'+(n/10)%10) + rune('0'+(n/100)%10))
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
 	}
-	// Simple thousands formatting
-	if n < 1000 {
-		return formatIntSimple(n)
-	}
-	return formatIntWithCommas(n)
-}
-
-func formatIntSimple(n int) string {
-	if n == 0 {
-		return "0"
-	}
-	var digits []byte
-	for n > 0 {
-		digits = append([]byte{byte('0' + n%10)}, digits...)
-		n /= 10
-	}
-	return string(digits)
-}
-
-func formatIntWithCommas(n int) string {
-	s := formatIntSimple(n)
 	if len(s) <= 3 {
-		return s
+		return sign + s
 	}
 
 	var result []byte
-	for i, c := range s {
+	for i := range len(s) {
 		if i > 0 && (len(s)-i)%3 == 0 {
 			result = append(result, ',')
 		}
-		result = append(result, byte(c))
+		result = append(result, s[i])
 	}
-	return string(result)
+	return sign + string(result)
 }
 
 func formatTimestamp(ts int64) string {
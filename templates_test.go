@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestFormatNum(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{7, "7"},
+		{42, "42"},
+		{999, "999"},
+		{1000, "1,000"},
+		{1234, "1,234"},
+		{1000000, "1,000,000"},
+		{-1234, "-1,234"},
+	}
+	for _, tt := range tests {
+		if got := formatNum(tt.n); got != tt.want {
+			t.Errorf("formatNum(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
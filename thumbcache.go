@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// thumbCacheExt is the file extension for cached thumbnails.
+// Each file holds the content type on the first line followed by the image bytes.
+const thumbCacheExt = ".thumb"
+
+// ThumbnailCache is an on-disk LRU cache of Immich thumbnails, keyed by asset ID and size
+type ThumbnailCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // file name -> element in lru
+	lru     *list.List               // front = most recently used
+	size    int64
+}
+
+type thumbCacheEntry struct {
+	name string
+	size int64
+}
+
+// NewThumbnailCache opens (creating if needed) a thumbnail cache in dir.
+// Existing files are indexed with their modification time as the recency order.
+func NewThumbnailCache(dir string, maxBytes int64) (*ThumbnailCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail cache dir: %w", err)
+	}
+
+	c := &ThumbnailCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read thumbnail cache dir: %w", err)
+	}
+
+	type existing struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []existing
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), thumbCacheExt) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, existing{name: de.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+
+	// Oldest first, so each PushFront leaves the newest at the front
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		c.entries[f.name] = c.lru.PushFront(&thumbCacheEntry{name: f.name, size: f.size})
+		c.size += f.size
+	}
+
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// thumbCacheName returns the file name for an asset ID and size.
+// Hashing keeps arbitrary asset IDs from escaping the cache dir.
+func thumbCacheName(assetID, size string) string {
+	sum := sha256.Sum256([]byte(assetID + "|" + size))
+	return hex.EncodeToString(sum[:]) + thumbCacheExt
+}
+
+// Get returns a cached thumbnail and its content type, or ok=false on a miss
+func (c *ThumbnailCache) Get(assetID, size string) ([]byte, string, bool) {
+	name := thumbCacheName(assetID, size)
+
+	c.mu.Lock()
+	elem, found := c.entries[name]
+	if found {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !found {
+		return nil, "", false
+	}
+
+	path := filepath.Join(c.dir, name)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		c.remove(name)
+		return nil, "", false
+	}
+
+	header, body, cut := bytes.Cut(raw, []byte("\n"))
+	if !cut {
+		c.remove(name)
+		return nil, "", false
+	}
+
+	// Persist recency across restarts
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return body, string(header), true
+}
+
+// Put stores a thumbnail, evicting least-recently-used entries to stay under the size cap
+func (c *ThumbnailCache) Put(assetID, size, contentType string, data []byte) error {
+	name := thumbCacheName(assetID, size)
+	path := filepath.Join(c.dir, name)
+
+	// Write to a temp file and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(contentType + "\n")
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	fileSize := int64(len(contentType) + 1 + len(data))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[name]; ok {
+		entry := elem.Value.(*thumbCacheEntry)
+		c.size += fileSize - entry.size
+		entry.size = fileSize
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[name] = c.lru.PushFront(&thumbCacheEntry{name: name, size: fileSize})
+		c.size += fileSize
+	}
+	c.evictLocked()
+
+	return nil
+}
+
+// remove drops an entry whose file is missing or corrupt
+func (c *ThumbnailCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[name]; ok {
+		c.size -= elem.Value.(*thumbCacheEntry).size
+		c.lru.Remove(elem)
+		delete(c.entries, name)
+	}
+	os.Remove(filepath.Join(c.dir, name))
+}
+
+// evictLocked deletes least-recently-used files until the cache fits its cap
+func (c *ThumbnailCache) evictLocked() {
+	for c.size > c.maxBytes {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+		entry := elem.Value.(*thumbCacheEntry)
+		os.Remove(filepath.Join(c.dir, entry.name))
+		c.size -= entry.size
+		c.lru.Remove(elem)
+		delete(c.entries, entry.name)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const (
+	// mvtExtent is the tile's coordinate range; MapLibre's default
+	mvtExtent = 4096
+
+	// mvtBuffer is how far (in tile units) geometry is kept past the tile edge, so lines
+	// crossing between tiles join without visible seams
+	mvtBuffer = 64
+
+	// maxTileZoom caps the zoom levels served by /api/tiles
+	maxTileZoom = 22
+
+	// mvtPathsLayer is the vector tile layer holding paths
+	mvtPathsLayer = "paths"
+)
+
+// TileBBox returns the bounding box of Web Mercator tile z/x/y
+func TileBBox(z, x, y int) BBox {
+	n := float64(int(1) << z)
+	tileLat := func(y float64) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+	}
+	return BBox{
+		SwLng: float64(x)/n*360 - 180,
+		SwLat: tileLat(float64(y + 1)),
+		NeLng: float64(x+1)/n*360 - 180,
+		NeLat: tileLat(float64(y)),
+	}
+}
+
+// ToleranceFromZoom returns a simplification tolerance (degrees) of one tile unit at zoom z,
+// so simplified paths differ from the originals by less than the tile can resolve
+func ToleranceFromZoom(z int) float64 {
+	return 360 / (float64(int(1)<<z) * mvtExtent)
+}
+
+// parseTilePath parses "/api/tiles/{z}/{x}/{y}.mvt", checking the tile exists at that zoom
+func parseTilePath(path string) (z, x, y int, ok bool) {
+	rest, ok := strings.CutSuffix(strings.TrimPrefix(path, "/api/tiles/"), ".mvt")
+	if !ok {
+		return 0, 0, 0, false
+	}
+	if _, err := fmt.Sscanf(rest, "%d/%d/%d", &z, &x, &y); err != nil || fmt.Sprintf("%d/%d/%d", z, x, y) != rest {
+		return 0, 0, 0, false
+	}
+	if z < 0 || z > maxTileZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return 0, 0, 0, false
+	}
+	return z, x, y, true
+}
+
+// tileProjector converts coordinates to tile units, where the tile spans 0..mvtExtent
+type tileProjector struct {
+	z, x, y int
+}
+
+func (p tileProjector) project(lat, lon float64) (float64, float64) {
+	n := float64(int(1) << p.z)
+	latRad := lat * math.Pi / 180
+	worldX := (lon + 180) / 360 * n
+	worldY := (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+	return (worldX - float64(p.x)) * mvtExtent, (worldY - float64(p.y)) * mvtExtent
+}
+
+// tilePoint is a position in tile units
+type tilePoint struct{ X, Y int }
+
+// clipLine projects points into the tile and clips them to the tile envelope plus mvtBuffer,
+// returning the pieces that fall inside. Consecutive points that round to the same tile
+// unit are collapsed, and pieces shorter than two points are dropped.
+func clipLine(points []PathPoint, proj tileProjector) [][]tilePoint {
+	const lo, hi = -mvtBuffer, mvtExtent + mvtBuffer
+
+	var lines [][]tilePoint
+	var cur []tilePoint
+	flush := func() {
+		if len(cur) >= 2 {
+			lines = append(lines, cur)
+		}
+		cur = nil
+	}
+	add := func(x, y float64) {
+		pt := tilePoint{int(math.Round(x)), int(math.Round(y))}
+		if len(cur) == 0 || cur[len(cur)-1] != pt {
+			cur = append(cur, pt)
+		}
+	}
+
+	for i := 1; i < len(points); i++ {
+		x0, y0 := proj.project(points[i-1].Lat, points[i-1].Lon)
+		x1, y1 := proj.project(points[i].Lat, points[i].Lon)
+
+		// Liang-Barsky: find the part of the segment inside the clip rectangle
+		t0, t1 := 0.0, 1.0
+		dx, dy := x1-x0, y1-y0
+		inside := true
+		for _, edge := range [4][2]float64{
+			{-dx, x0 - lo}, {dx, hi - x0}, {-dy, y0 - lo}, {dy, hi - y0},
+		} {
+			p, q := edge[0], edge[1]
+			if p == 0 {
+				if q < 0 {
+					inside = false
+					break
+				}
+				continue
+			}
+			r := q / p
+			if p < 0 {
+				t0 = math.Max(t0, r)
+			} else {
+				t1 = math.Min(t1, r)
+			}
+			if t0 > t1 {
+				inside = false
+				break
+			}
+		}
+		if !inside {
+			flush()
+			continue
+		}
+
+		// A segment entering from outside starts a new piece
+		if t0 > 0 {
+			flush()
+		}
+		add(x0+t0*dx, y0+t0*dy)
+		add(x0+t1*dx, y0+t1*dy)
+		if t1 < 1 {
+			flush()
+		}
+	}
+	flush()
+	return lines
+}
+
+// mvtLayer accumulates features for one vector tile layer
+type mvtLayer struct {
+	name     string
+	features [][]byte
+	keys     []string
+	keyIndex map[string]int
+	values   [][]byte
+	valIndex map[string]int
+}
+
+func newMVTLayer(name string) *mvtLayer {
+	return &mvtLayer{name: name, keyIndex: make(map[string]int), valIndex: make(map[string]int)}
+}
+
+// tag returns the key and value indexes for a property, adding them to the layer if new
+func (l *mvtLayer) tag(key string, value []byte) []uint64 {
+	ki, ok := l.keyIndex[key]
+	if !ok {
+		ki = len(l.keys)
+		l.keys = append(l.keys, key)
+		l.keyIndex[key] = ki
+	}
+	vi, ok := l.valIndex[string(value)]
+	if !ok {
+		vi = len(l.values)
+		l.values = append(l.values, value)
+		l.valIndex[string(value)] = vi
+	}
+	return []uint64{uint64(ki), uint64(vi)}
+}
+
+// mvtString and mvtInt encode tile property values
+func mvtString(s string) []byte { return pbBytes(nil, 1, []byte(s)) }
+func mvtInt(n int64) []byte     { return pbVarint(nil, 4, uint64(n)) }
+
+// addLineFeature adds a (multi)linestring feature with the given properties
+func (l *mvtLayer) addLineFeature(id uint64, lines [][]tilePoint, props [][2]any) {
+	var tags []uint64
+	for _, prop := range props {
+		key := prop[0].(string)
+		switch v := prop[1].(type) {
+		case string:
+			tags = append(tags, l.tag(key, mvtString(v))...)
+		case int64:
+			tags = append(tags, l.tag(key, mvtInt(v))...)
+		}
+	}
+
+	// Geometry commands: MoveTo (1) and LineTo (2), with zigzag-encoded deltas
+	var geom []uint64
+	var cx, cy int
+	for _, line := range lines {
+		geom = append(geom, 1|1<<3)
+		geom = append(geom, zigzag(line[0].X-cx), zigzag(line[0].Y-cy))
+		cx, cy = line[0].X, line[0].Y
+		geom = append(geom, uint64(2|(len(line)-1)<<3))
+		for _, pt := range line[1:] {
+			geom = append(geom, zigzag(pt.X-cx), zigzag(pt.Y-cy))
+			cx, cy = pt.X, pt.Y
+		}
+	}
+
+	var f []byte
+	f = pbVarint(f, 1, id)
+	f = pbPacked(f, 2, tags)
+	f = pbVarint(f, 3, 2) // LINESTRING
+	f = pbPacked(f, 4, geom)
+	l.features = append(l.features, f)
+}
+
+// encode returns the layer as a Tile.Layer message
+func (l *mvtLayer) encode() []byte {
+	var b []byte
+	b = pbVarint(b, 15, 2) // MVT version
+	b = pbBytes(b, 1, []byte(l.name))
+	for _, f := range l.features {
+		b = pbBytes(b, 2, f)
+	}
+	for _, k := range l.keys {
+		b = pbBytes(b, 3, []byte(k))
+	}
+	for _, v := range l.values {
+		b = pbBytes(b, 4, v)
+	}
+	return pbVarint(b, 5, mvtExtent)
+}
+
+// encodeTile returns a vector tile holding the non-empty layers
+func encodeTile(layers ...*mvtLayer) []byte {
+	var b []byte
+	for _, l := range layers {
+		if len(l.features) > 0 {
+			b = pbBytes(b, 3, l.encode())
+		}
+	}
+	return b
+}
+
+// zigzag maps signed tile deltas to unsigned values, as MVT geometry requires
+func zigzag(n int) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+// Minimal protobuf encoding for the few MVT message types used here
+
+func pbVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func pbBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func pbPacked(b []byte, field int, vs []uint64) []byte {
+	var data []byte
+	for _, v := range vs {
+		data = binary.AppendUvarint(data, v)
+	}
+	return pbBytes(b, field, data)
+}
+
+// GET /api/tiles/{z}/{x}/{y}.mvt - Returns paths intersecting a tile as a Mapbox Vector Tile
+// Paths are in the "paths" layer, simplified to the tile's resolution and clipped to it.
+// Accepts the same user/start/end and filter params as /api/paths.
+func (s *Server) handleAPITile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	z, x, y, ok := parseTilePath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	start, end := parseOptionalTimeRange(q)
+	opts := parseSimplifyOptions(q)
+	bbox := TileBBox(z, x, y)
+	proj := tileProjector{z: z, x: x, y: y}
+	tolerance := ToleranceFromZoom(z)
+
+	paths, err := s.db.QueryPathsByBBox(s.queryUserID(r), bbox, start, end)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	layer := newMVTLayer(mvtPathsLayer)
+	var removed RemovedPoints
+	for _, path := range paths {
+		points, err := s.db.GetPathPoints(path.ID)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		points = applySimplifyStages(points, opts, &removed)
+
+		segments := [][]PathPoint{points}
+		if opts.MaxGapSeconds > 0 {
+			segments = SplitAtGaps(points, opts.MaxGapSeconds)
+		}
+		var lines [][]tilePoint
+		for _, seg := range segments {
+			lines = append(lines, clipLine(SimplifyPath(seg, tolerance), proj)...)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		layer.addLineFeature(uint64(path.ID), lines, [][2]any{
+			{"user_id", path.UserID},
+			{"date", path.Date},
+			{"start_ts", path.StartTS},
+			{"end_ts", path.EndTS},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Write(encodeTile(layer))
+}
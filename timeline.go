@@ -9,11 +9,6 @@ import (
 	"time"
 )
 
-// Timeline represents the root structure of Android Timeline JSON export
-type Timeline struct {
-	RawSignals []RawSignal `json:"rawSignals"`
-}
-
 // RawSignal represents a single signal entry in the timeline
 type RawSignal struct {
 	Position *TimelinePosition `json:"position,omitempty"`
@@ -30,6 +25,7 @@ type TimelinePosition struct {
 }
 
 // ParseLatLng extracts latitude and longitude from a string like "37.422°, -122.084°"
+// or "37.422° N, 122.084° W", where an S or W suffix negates the value
 func ParseLatLng(s string) (lat, lon float64, err error) {
 	// Remove degree symbols and split by comma
 	s = strings.ReplaceAll(s, "°", "")
@@ -38,12 +34,12 @@ func ParseLatLng(s string) (lat, lon float64, err error) {
 		return 0, 0, fmt.Errorf("invalid LatLng format: %s", s)
 	}
 
-	lat, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lat, err = parseCoordinate(parts[0], "N", "S")
 	if err != nil {
 		return 0, 0, fmt.Errorf("invalid latitude: %w", err)
 	}
 
-	lon, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	lon, err = parseCoordinate(parts[1], "E", "W")
 	if err != nil {
 		return 0, 0, fmt.Errorf("invalid longitude: %w", err)
 	}
@@ -51,6 +47,33 @@ func ParseLatLng(s string) (lat, lon float64, err error) {
 	return lat, lon, nil
 }
 
+// parseCoordinate parses a signed decimal coordinate with an optional hemisphere suffix.
+// A suffix can't be combined with an explicit sign, since "-37 S" is ambiguous.
+func parseCoordinate(s, positive, negative string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	sign := 0.0
+	if suffix := strings.ToUpper(s[max(len(s)-1, 0):]); suffix == positive || suffix == negative {
+		sign = 1
+		if suffix == negative {
+			sign = -1
+		}
+		s = strings.TrimSpace(s[:len(s)-1])
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if sign == 0 {
+		return v, nil
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		return 0, fmt.Errorf("signed value %q with hemisphere suffix", s)
+	}
+	return sign * v, nil
+}
+
 // TimelineImportStats tracks import progress
 type TimelineImportStats struct {
 	Total    int `json:"total"`
@@ -58,84 +81,162 @@ type TimelineImportStats struct {
 	Inserted int `json:"inserted"`
 	Skipped  int `json:"skipped"`
 	Errors   int `json:"errors"`
+	// ErrorSamples holds the reasons for the first maxImportErrorSamples errors
+	ErrorSamples []string `json:"error_samples,omitempty"`
+}
+
+// addError counts a record that failed to parse, keeping its reason if fewer than
+// maxImportErrorSamples are held
+func (s *TimelineImportStats) addError(err error) {
+	s.Errors++
+	if len(s.ErrorSamples) < maxImportErrorSamples {
+		s.ErrorSamples = append(s.ErrorSamples, err.Error())
+	}
+}
+
+// parseErrorStats builds stats counting errs, with a sample of their reasons
+func parseErrorStats(errs []error) TimelineImportStats {
+	var stats TimelineImportStats
+	for _, err := range errs {
+		stats.addError(err)
+	}
+	return stats
 }
 
 // TimelineImportProgress is sent via SSE during import
 type TimelineImportProgress struct {
+	JobID    string              `json:"job_id,omitempty"` // Set once the import job is created
 	Stats    TimelineImportStats `json:"stats"`
 	Message  string              `json:"message,omitempty"`
 	Error    string              `json:"error,omitempty"`
 	Complete bool                `json:"complete"`
 }
 
-// ParseTimeline reads an Android Timeline JSON file and extracts locations
-func ParseTimeline(r io.Reader) (*Timeline, error) {
-	var timeline Timeline
-	if err := json.NewDecoder(r).Decode(&timeline); err != nil {
-		return nil, fmt.Errorf("failed to parse timeline JSON: %w", err)
-	}
-	return &timeline, nil
-}
+// StreamTimeline walks the rawSignals array of an Android Timeline JSON export one element
+// at a time, so files far larger than memory can be imported. fn is called for each position
+// converted to a Location, and onErr for each position that can't be converted. Other top-level
+// fields (semanticSegments etc.) are skipped token by token without being buffered.
+// Returns the number of positions seen; a decode error or an error from fn stops the walk.
+func StreamTimeline(r io.Reader, userID, deviceID string, fn func(Location) error, onErr func(error)) (int, error) {
+	dec := json.NewDecoder(r)
 
-// ExtractLocations converts Timeline positions to Location structs
-func ExtractLocations(timeline *Timeline, userID, deviceID string) ([]Location, []error) {
-	var locations []Location
-	var errors []error
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, fmt.Errorf("failed to parse timeline JSON: %w", err)
+	}
 
-	for i, signal := range timeline.RawSignals {
-		if signal.Position == nil {
+	positions := 0
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return positions, fmt.Errorf("failed to parse timeline JSON: %w", err)
+		}
+		if key != "rawSignals" {
+			if err := skipJSONValue(dec); err != nil {
+				return positions, fmt.Errorf("failed to parse timeline JSON: %w", err)
+			}
 			continue
 		}
 
-		pos := signal.Position
-
-		// Parse coordinates
-		lat, lon, err := ParseLatLng(pos.LatLng)
-		if err != nil {
-			errors = append(errors, fmt.Errorf("signal %d: %w", i, err))
-			continue
+		if err := expectDelim(dec, '['); err != nil {
+			return positions, fmt.Errorf("failed to parse rawSignals: %w", err)
 		}
+		for i := 0; dec.More(); i++ {
+			var signal RawSignal
+			if err := dec.Decode(&signal); err != nil {
+				// The stream can't be resynchronized after a syntax error
+				return positions, fmt.Errorf("signal %d: %w", i, err)
+			}
+			if signal.Position == nil {
+				continue
+			}
+			positions++
 
-		// Parse timestamp
-		t, err := time.Parse(time.RFC3339, pos.Timestamp)
-		if err != nil {
-			// Try alternate format without timezone
-			t, err = time.Parse("2006-01-02T15:04:05.000-07:00", pos.Timestamp)
+			loc, err := signal.Position.toLocation(userID, deviceID)
 			if err != nil {
-				errors = append(errors, fmt.Errorf("signal %d: invalid timestamp %q: %w", i, pos.Timestamp, err))
+				onErr(fmt.Errorf("signal %d: %w", i, err))
 				continue
 			}
+			if err := fn(loc); err != nil {
+				return positions, err
+			}
 		}
-
-		loc := Location{
-			Timestamp: t.Unix(),
-			UserID:    userID,
-			DeviceID:  deviceID,
-			Lat:       lat,
-			Lon:       lon,
+		if err := expectDelim(dec, ']'); err != nil {
+			return positions, fmt.Errorf("failed to parse rawSignals: %w", err)
 		}
+	}
 
-		// Set extended fields if present
-		if pos.AltitudeM != 0 {
-			alt := pos.AltitudeM
-			loc.AltitudeM = &alt
+	return positions, nil
+}
+
+// skipJSONValue consumes the next value from dec, however deeply nested, without buffering it
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
 		}
-		if pos.AccuracyM != 0 {
-			acc := pos.AccuracyM
-			loc.AccuracyM = &acc
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
 		}
-		if pos.SpeedMPS != 0 {
-			// Convert m/s to km/h
-			speed := pos.SpeedMPS * 3.6
-			loc.SpeedKmh = &speed
+		if depth == 0 {
+			return nil
 		}
-		if pos.Source != "" {
-			src := pos.Source
-			loc.Source = &src
+	}
+}
+
+// toLocation converts a Timeline position to a Location
+func (pos *TimelinePosition) toLocation(userID, deviceID string) (Location, error) {
+	// Parse coordinates
+	lat, lon, err := ParseLatLng(pos.LatLng)
+	if err != nil {
+		return Location{}, err
+	}
+	if err := validateCoords(lat, lon); err != nil {
+		return Location{}, err
+	}
+
+	// Parse timestamp
+	t, err := time.Parse(time.RFC3339, pos.Timestamp)
+	if err != nil {
+		// Try alternate format without timezone
+		t, err = time.Parse("2006-01-02T15:04:05.000-07:00", pos.Timestamp)
+		if err != nil {
+			return Location{}, fmt.Errorf("invalid timestamp %q: %w", pos.Timestamp, err)
 		}
+	}
+
+	loc := Location{
+		Timestamp: t.Unix(),
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Lat:       lat,
+		Lon:       lon,
+	}
 
-		locations = append(locations, loc)
+	// Set extended fields if present
+	if pos.AltitudeM != 0 {
+		alt := pos.AltitudeM
+		loc.AltitudeM = &alt
+	}
+	if pos.AccuracyM != 0 {
+		acc := pos.AccuracyM
+		loc.AccuracyM = &acc
+	}
+	if pos.SpeedMPS != 0 {
+		// Convert m/s to km/h
+		speed := pos.SpeedMPS * 3.6
+		loc.SpeedKmh = &speed
+	}
+	if pos.Source != "" {
+		src := pos.Source
+		loc.Source = &src
 	}
 
-	return locations, errors
+	return loc, nil
 }
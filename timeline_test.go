@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestParseLatLng(t *testing.T) {
+	tests := []struct {
+		in       string
+		lat, lon float64
+		wantErr  bool
+	}{
+		{in: "37.422°, -122.084°", lat: 37.422, lon: -122.084},
+		{in: "37.422°N, 122.084°W", lat: 37.422, lon: -122.084},
+		{in: "37.422° N, 122.084° W", lat: 37.422, lon: -122.084},
+		{in: "33.868° S, 151.209° E", lat: -33.868, lon: 151.209},
+		{in: "33.868° s, 151.209° e", lat: -33.868, lon: 151.209},
+		{in: " 37.422°, -122.084°", lat: 37.422, lon: -122.084},
+		{in: "37.422 N,122.084 W ", lat: 37.422, lon: -122.084},
+		// One coordinate with a suffix, the other signed
+		{in: "37.422° N, -122.084°", lat: 37.422, lon: -122.084},
+		{in: "0°, 0°", lat: 0, lon: 0},
+		{in: "-37.422° S, 122.084° W", wantErr: true},
+		{in: "37.422° E, 122.084° W", wantErr: true}, // Longitude suffix on latitude
+		{in: "37.422°", wantErr: true},
+		{in: "37.422°, 122.084°, 5", wantErr: true},
+		{in: "N, W", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			lat, lon, err := ParseLatLng(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseLatLng(%q) = %v, %v, want error", tt.in, lat, lon)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLatLng(%q): %v", tt.in, err)
+			}
+			if lat != tt.lat || lon != tt.lon {
+				t.Errorf("ParseLatLng(%q) = %v, %v, want %v, %v", tt.in, lat, lon, tt.lat, tt.lon)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+	_ "time/tzdata" // Embed IANA zone data so lookups work without system tzdata
+
+	"github.com/ringsaturn/tzf"
+)
+
+// tzCacheResolution is the grid size (in degrees) used to cache timezone lookups.
+// 0.01 degrees is roughly 1km, so nearby points share a single polygon lookup.
+const tzCacheResolution = 0.01
+
+var (
+	tzFinder     tzf.F
+	tzFinderOnce sync.Once
+
+	// tzCache maps a coordinate grid cell to its *time.Location
+	tzCache sync.Map
+	// tzLocations maps IANA zone names to loaded *time.Location
+	tzLocations sync.Map
+)
+
+type tzCacheKey struct {
+	lat, lon int32
+}
+
+// getTZFinder lazily builds the embedded timezone polygon finder
+func getTZFinder() tzf.F {
+	tzFinderOnce.Do(func() {
+		finder, err := tzf.NewDefaultFinder()
+		if err != nil {
+			log.Printf("timezone finder unavailable, using longitude approximation: %v", err)
+			return
+		}
+		tzFinder = finder
+	})
+	return tzFinder
+}
+
+// TimezoneFromCoords returns the IANA time zone for a coordinate, with correct DST rules.
+// Lookups are cached per ~1km grid cell. Falls back to a 15-degree-per-hour
+// longitude approximation when no zone can be resolved.
+func TimezoneFromCoords(lat, lon float64) *time.Location {
+	key := tzCacheKey{
+		lat: int32(math.Round(lat / tzCacheResolution)),
+		lon: int32(math.Round(lon / tzCacheResolution)),
+	}
+	if cached, ok := tzCache.Load(key); ok {
+		return cached.(*time.Location)
+	}
+
+	loc := lookupTimezone(lat, lon)
+	tzCache.Store(key, loc)
+	return loc
+}
+
+// lookupTimezone resolves the zone for a coordinate without caching by coordinate
+func lookupTimezone(lat, lon float64) *time.Location {
+	finder := getTZFinder()
+	if finder == nil {
+		return timezoneFromLongitude(lon)
+	}
+
+	name := finder.GetTimezoneName(lon, lat)
+	if name == "" {
+		return timezoneFromLongitude(lon)
+	}
+
+	if cached, ok := tzLocations.Load(name); ok {
+		return cached.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("failed to load timezone %q: %v", name, err)
+		return timezoneFromLongitude(lon)
+	}
+	tzLocations.Store(name, loc)
+	return loc
+}
+
+// timezoneFromLongitude approximates a fixed UTC offset from longitude.
+// Each 15 degrees of longitude = 1 hour offset from UTC.
+func timezoneFromLongitude(lon float64) *time.Location {
+	offsetHours := int(math.Round(lon / 15.0))
+
+	// Clamp to valid range
+	if offsetHours < -12 {
+		offsetHours = -12
+	} else if offsetHours > 14 {
+		offsetHours = 14
+	}
+
+	return time.FixedZone("", offsetHours*3600)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimezoneFromCoords(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		{"New York", 40.7128, -74.0060, "America/New_York"},
+		{"London", 51.5074, -0.1278, "Europe/London"},
+		{"Kolkata", 22.5726, 88.3639, "Asia/Kolkata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimezoneFromCoords(tt.lat, tt.lon).String(); got != tt.want {
+				t.Errorf("TimezoneFromCoords = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalDateFromTimestampDST(t *testing.T) {
+	const lat, lon = 40.7128, -74.0060 // New York
+
+	tests := []struct {
+		name string
+		utc  time.Time
+		want string
+	}{
+		// EST is UTC-5, so 04:30 UTC is still the previous evening
+		{"standard time before midnight", time.Date(2024, time.January, 15, 4, 30, 0, 0, time.UTC), "2024-01-14"},
+		{"standard time after midnight", time.Date(2024, time.January, 15, 5, 30, 0, 0, time.UTC), "2024-01-15"},
+		// EDT is UTC-4, so 04:30 UTC is already past midnight; a fixed -5h offset would say July 14
+		{"daylight time after midnight", time.Date(2024, time.July, 15, 4, 30, 0, 0, time.UTC), "2024-07-15"},
+		{"daylight time before midnight", time.Date(2024, time.July, 15, 3, 30, 0, 0, time.UTC), "2024-07-14"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LocalDateFromTimestamp(tt.utc.Unix(), lat, lon); got != tt.want {
+				t.Errorf("LocalDateFromTimestamp(%s) = %s, want %s", tt.utc, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	// defaultTripMinDistanceMeters is how far from home the user must go for a trip to begin
+	defaultTripMinDistanceMeters = 50000.0
+
+	// defaultTripMinSeconds drops short outings so only multi-day journeys are reported
+	defaultTripMinSeconds int64 = 24 * 60 * 60
+
+	// tripMaxPlaces caps the places listed (and geocoded) per trip, keeping the longest stays
+	tripMaxPlaces = 10
+)
+
+// Trip is a journey away from home, possibly spanning many days
+type Trip struct {
+	StartTS        int64       `json:"start_ts"`
+	EndTS          int64       `json:"end_ts"`
+	Title          string      `json:"title"`
+	DistanceMeters float64     `json:"distance_m"`
+	Ongoing        bool        `json:"ongoing,omitempty"` // Still away at the end of the range
+	Places         []TripPlace `json:"places"`
+}
+
+// TripPlace is a stop made during a trip; repeat stops at the same place are combined
+type TripPlace struct {
+	Name              string  `json:"name,omitempty"`
+	Lat               float64 `json:"lat"`
+	Lon               float64 `json:"lon"`
+	ArrivalTS         int64   `json:"arrival_ts"` // First arrival
+	Seconds           int64   `json:"seconds"`    // Total time spent
+	DistanceFromHomeM float64 `json:"distance_from_home_m"`
+}
+
+// TripOptions controls trip detection for /api/trips
+type TripOptions struct {
+	MinDistanceMeters float64
+	MinSeconds        int64
+	Stops             TimelineParams
+}
+
+// parseTripOptions parses the min_dist/min_duration query params plus the timeline stay params
+func parseTripOptions(q url.Values) (TripOptions, error) {
+	opts := TripOptions{
+		MinDistanceMeters: defaultTripMinDistanceMeters,
+		MinSeconds:        defaultTripMinSeconds,
+	}
+
+	if v := q.Get("min_dist"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return opts, &httpError{code: http.StatusBadRequest, msg: "invalid min_dist (meters)"}
+		}
+		opts.MinDistanceMeters = f
+	}
+
+	if v := q.Get("min_duration"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return opts, &httpError{code: http.StatusBadRequest, msg: "invalid min_duration (seconds)"}
+		}
+		opts.MinSeconds = n
+	}
+
+	stops, err := parseTimelineParams(q)
+	if err != nil {
+		return opts, err
+	}
+	opts.Stops = stops
+	return opts, nil
+}
+
+// DetectTrips finds journeys away from home: a trip begins when the user moves beyond
+// MinDistanceMeters of home and ends when they return. Stops along the way are found with
+// the same stationary clustering as the timeline. Places are unnamed; the caller names them.
+func (db *DB) DetectTrips(userID string, start, end *int64, home StatsPoint, opts TripOptions) ([]Trip, error) {
+	var trips []Trip
+	var trip *Trip
+	var prev *Location
+
+	// Stops are clustered one local day at a time, as the timeline does
+	var curDate string
+	var curPoints []PathPoint
+	flushDay := func() {
+		if len(curPoints) == 0 {
+			return
+		}
+		_, stops := computeDayStats(curDate, curPoints, opts.Stops)
+		for _, stop := range stops {
+			trip.Places = addTripPlace(trip.Places, stop, home, opts.Stops.MergeDistMeters)
+		}
+		curPoints = curPoints[:0]
+	}
+	addPoint := func(loc Location) {
+		date := LocalDateFromTimestamp(loc.Timestamp, loc.Lat, loc.Lon)
+		if date != curDate {
+			flushDay()
+			curDate = date
+		}
+		curPoints = append(curPoints, PathPoint{Lat: loc.Lat, Lon: loc.Lon, Timestamp: loc.Timestamp})
+	}
+	finishTrip := func() {
+		flushDay()
+		curDate = ""
+		if trip.EndTS-trip.StartTS >= opts.MinSeconds {
+			trips = append(trips, *trip)
+		}
+		trip = nil
+	}
+
+	err := db.StreamLocations(userID, start, end, func(loc Location) error {
+		away := DistanceMeters(home.Lat, home.Lon, loc.Lat, loc.Lon) > opts.MinDistanceMeters
+
+		if trip == nil && away {
+			// Start from the last point before leaving, so the outbound leg is counted
+			trip = &Trip{StartTS: loc.Timestamp}
+			if prev != nil {
+				trip.StartTS = prev.Timestamp
+				addPoint(*prev)
+			}
+		}
+
+		if trip != nil {
+			if prev != nil && prev.Timestamp >= trip.StartTS {
+				trip.DistanceMeters += DistanceMeters(prev.Lat, prev.Lon, loc.Lat, loc.Lon)
+			}
+			addPoint(loc)
+			trip.EndTS = loc.Timestamp
+			if !away {
+				finishTrip()
+			}
+		}
+
+		prev = &loc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if trip != nil {
+		trip.Ongoing = true
+		finishTrip()
+	}
+
+	for i := range trips {
+		places := trips[i].Places
+		if len(places) > tripMaxPlaces {
+			sort.Slice(places, func(a, b int) bool {
+				return places[a].Seconds > places[b].Seconds
+			})
+			places = places[:tripMaxPlaces]
+		}
+		sort.Slice(places, func(a, b int) bool {
+			return places[a].ArrivalTS < places[b].ArrivalTS
+		})
+		if places == nil {
+			places = []TripPlace{}
+		}
+		trips[i].Places = places
+	}
+
+	return trips, nil
+}
+
+// addTripPlace adds a stop to the nearest known trip place within mergeDistMeters,
+// or records it as a new place
+func addTripPlace(places []TripPlace, stop StationaryCluster, home StatsPoint, mergeDistMeters float64) []TripPlace {
+	duration := stop.EndTS - stop.StartTS
+	for i := range places {
+		if DistanceMeters(places[i].Lat, places[i].Lon, stop.CentroidLat, stop.CentroidLon) <= mergeDistMeters {
+			places[i].Seconds += duration
+			return places
+		}
+	}
+	return append(places, TripPlace{
+		Lat:               stop.CentroidLat,
+		Lon:               stop.CentroidLon,
+		ArrivalTS:         stop.StartTS,
+		Seconds:           duration,
+		DistanceFromHomeM: DistanceMeters(home.Lat, home.Lon, stop.CentroidLat, stop.CentroidLon),
+	})
+}
+
+// tripTitle names a trip after its farthest named place, falling back to the longest stay
+func tripTitle(trip Trip) string {
+	var farthest, longest *TripPlace
+	for i := range trip.Places {
+		p := &trip.Places[i]
+		if p.Name == "" {
+			continue
+		}
+		if farthest == nil || p.DistanceFromHomeM > farthest.DistanceFromHomeM {
+			farthest = p
+		}
+		if longest == nil || p.Seconds > longest.Seconds {
+			longest = p
+		}
+	}
+	switch {
+	case farthest != nil:
+		return "Trip to " + farthest.Name
+	case longest != nil:
+		return "Trip to " + longest.Name
+	default:
+		return "Trip"
+	}
+}
+
+// GET /api/trips - Returns multi-day journeys away from home
+// Home is the detected significant place unless given as home=lat,lon.
+func (s *Server) handleAPITrips(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	start, end := parseOptionalTimeRange(q)
+	userID := s.queryUserID(r)
+
+	opts, err := parseTripOptions(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var home *StatsPoint
+	if homeStr := q.Get("home"); homeStr != "" {
+		home, err = parseStatsHome(homeStr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if s.places != nil {
+		places, err := s.places.Get(userID)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		for _, p := range places {
+			if p.Label == "Home" {
+				home = &StatsPoint{Lat: p.Lat, Lon: p.Lon}
+				break
+			}
+		}
+	}
+	if home == nil {
+		http.Error(w, "home not detected, pass home=lat,lon", http.StatusUnprocessableEntity)
+		return
+	}
+
+	trips, err := s.db.DetectTrips(userID, start, end, *home, opts)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Name all trips' places in one batch
+	var points []LatLon
+	for _, trip := range trips {
+		for _, p := range trip.Places {
+			points = append(points, LatLon{Lat: p.Lat, Lon: p.Lon})
+		}
+	}
+	names := s.placeNames(context.Background(), userID, points)
+	idx := 0
+	for i := range trips {
+		for j := range trips[i].Places {
+			trips[i].Places[j].Name = names[idx]
+			idx++
+		}
+		trips[i].Title = tripTitle(trips[i])
+	}
+
+	if trips == nil {
+		trips = []Trip{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trips)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Webhook event types, as listed in a webhook's events config
+const (
+	WebhookGeofenceEnter = "geofence_enter"
+	WebhookGeofenceExit  = "geofence_exit"
+	WebhookLocation      = "location"
+)
+
+const (
+	// webhookTimeout bounds each delivery attempt
+	webhookTimeout = 10 * time.Second
+
+	// webhookRetries is how many times a failed delivery is retried
+	webhookRetries = 2
+
+	// webhookRetryDelay is the delay before the first retry, doubling after each
+	webhookRetryDelay = time.Second
+
+	// maxWebhookDeliveries caps in-flight deliveries; events beyond it are dropped
+	// so a slow receiver can't pile up goroutines under heavy ingestion
+	maxWebhookDeliveries = 32
+
+	// webhookSignatureHeader carries the hex HMAC-SHA256 of the body, as "sha256=<hex>"
+	webhookSignatureHeader = "X-Whence-Signature"
+)
+
+// WebhookPayload is the JSON body POSTed to webhooks
+type WebhookPayload struct {
+	Event     string `json:"event"`     // One of the Webhook* event types
+	Timestamp int64  `json:"timestamp"` // When the notification was sent
+	Data      any    `json:"data"`      // GeofenceEvent, or []LocationEvent for "location"
+}
+
+// WebhookDispatcher delivers events to the configured webhooks in the background
+type WebhookDispatcher struct {
+	hooks    []WebhookConfig
+	client   *http.Client
+	inflight chan struct{}
+}
+
+// NewWebhookDispatcher creates a dispatcher, or nil if no webhooks are configured
+func NewWebhookDispatcher(hooks []WebhookConfig) *WebhookDispatcher {
+	if len(hooks) == 0 {
+		return nil
+	}
+	return &WebhookDispatcher{
+		hooks:    hooks,
+		client:   &http.Client{Timeout: webhookTimeout},
+		inflight: make(chan struct{}, maxWebhookDeliveries),
+	}
+}
+
+// Send notifies every webhook subscribed to the event type without blocking.
+// Safe to call on a nil dispatcher.
+func (d *WebhookDispatcher) Send(event string, data any) {
+	if d == nil {
+		return
+	}
+
+	var body []byte
+	for _, hook := range d.hooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, event) {
+			continue
+		}
+
+		if body == nil {
+			var err error
+			body, err = json.Marshal(WebhookPayload{Event: event, Timestamp: time.Now().Unix(), Data: data})
+			if err != nil {
+				log.Printf("webhook: failed to encode %s event: %v", event, err)
+				return
+			}
+		}
+
+		select {
+		case d.inflight <- struct{}{}:
+		default:
+			log.Printf("webhook: dropping %s event for %s, too many deliveries in flight", event, hook.URL)
+			continue
+		}
+		go func() {
+			defer func() { <-d.inflight }()
+			d.deliver(hook, event, body)
+		}()
+	}
+}
+
+// SendGeofenceEvent notifies webhooks of a geofence transition
+func (d *WebhookDispatcher) SendGeofenceEvent(event GeofenceEvent) {
+	if event.Event == "enter" {
+		d.Send(WebhookGeofenceEnter, event)
+	} else {
+		d.Send(WebhookGeofenceExit, event)
+	}
+}
+
+// SendLocations notifies webhooks of newly ingested points
+func (d *WebhookDispatcher) SendLocations(locs []Location) {
+	if d == nil || len(locs) == 0 {
+		return
+	}
+	events := make([]LocationEvent, len(locs))
+	for i, loc := range locs {
+		events[i] = newLocationEvent(loc)
+	}
+	d.Send(WebhookLocation, events)
+}
+
+// deliver POSTs a payload to one webhook, retrying network errors and 5xx responses
+func (d *WebhookDispatcher) deliver(hook WebhookConfig, event string, body []byte) {
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := d.post(hook, body)
+		if err == nil {
+			return
+		}
+		if attempt >= webhookRetries || !isRetryableWebhookError(err) {
+			log.Printf("webhook: %s delivery to %s failed: %v", event, hook.URL, err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// webhookStatusError is a non-2xx webhook response
+type webhookStatusError struct {
+	status int
+}
+
+func (e *webhookStatusError) Error() string {
+	return "unexpected status " + http.StatusText(e.status)
+}
+
+// isRetryableWebhookError reports whether a failed delivery may succeed on retry
+func isRetryableWebhookError(err error) bool {
+	if statusErr, ok := err.(*webhookStatusError); ok {
+		return statusErr.status >= 500
+	}
+	return true // Network error
+}
+
+// post makes a single delivery attempt
+func (d *WebhookDispatcher) post(hook WebhookConfig, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hook.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookBody(hook.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &webhookStatusError{status: resp.StatusCode}
+	}
+	return nil
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of body keyed by secret
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}